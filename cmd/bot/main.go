@@ -1,48 +1,276 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
 	"strings" // [Pembaruan] Import strings untuk memecah API Key
+	"syscall"
 	"telechatbot/config"
+	"telechatbot/internal/access"
 	"telechatbot/internal/api"
 	"telechatbot/internal/bot"
 	"telechatbot/internal/database"
 	"telechatbot/internal/handlers"
 	"telechatbot/internal/i18n"
+	"telechatbot/internal/limits"
+	"telechatbot/internal/models"
+	"telechatbot/internal/search"
+	"telechatbot/internal/tools"
+	"telechatbot/internal/usage"
+	"telechatbot/internal/webfetch"
+	"time"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+
 	log.Println("Starting TeleChatBot with Group Support...")
 
 	cfg := config.LoadConfig()
 
 	db := database.InitDB(cfg.DatabaseFile)
-	defer db.Conn.Close()
 
 	loc := i18n.NewLocalizer()
 
-	botClient := bot.NewClient(cfg.TelegramToken)
+	botClient := bot.NewClientWithAPIURL(cfg.TelegramToken, cfg.TelegramAPIURL)
+	botClient.ParseMode = cfg.TelegramParseMode
+	botClient.DocumentThreshold = cfg.LongResponseDocumentChars
 
 	// [Pembaruan] Logika Rotasi API Key
 	// Kita memecah string dari .env (contoh: "key1,key2,key3") menjadi array/slice
-	apiKeys := strings.Split(cfg.GroqApiKey, ",")
-	for i := range apiKeys {
-		apiKeys[i] = strings.TrimSpace(apiKeys[i]) // Hapus spasi jika ada
-	}
+	// Satu pool dipakai semua client dengan key yang sama, jadi key yang
+	// kena 401 atau rate limit diketahui oleh semua model
+	apiKeys := api.NewKeyPool(splitKeys(cfg.AIApiKey))
+	apiKeys.Name = "AI_API_KEY"
 
-	// Masukkan array apiKeys ke client, bukan cuma satu string
-	aiClient := api.NewGroqClient(apiKeys, cfg.GroqModel)
+	// Provider dipilih dari config (groq, openai, openrouter, ollama, ...)
+	// Setiap model di AI_MODEL adalah cadangan untuk model sebelumnya
+	aiClient, err := api.NewModelChain(cfg.AIProvider, cfg.AIBaseURL, apiKeys, cfg.AIModels)
+	if err != nil {
+		log.Fatalf("Error creating AI provider: %v", err)
+	}
+	log.Printf("Using AI provider %s with models %s", cfg.AIProvider, aiClient)
 
 	// Update: Pass cfg.BotUsername to the dispatcher
 	d := handlers.NewDispatcher(botClient, aiClient, db, loc, cfg.SystemPrompt, cfg.BotUsername)
+	d.Queue = handlers.NewWorkQueue(cfg.MaxConcurrency, cfg.MaxQueueDepth)
+	d.Admins = make(map[int64]bool)
+	for _, id := range cfg.AdminUserIDs {
+		d.Admins[id] = true
+	}
+
+	// Siapa yang boleh memakai bot: daftar dari config plus aturan /grant dan /revoke di DB
+	policy := access.NewPolicy(db)
+	policy.Mode = cfg.AccessMode
+	policy.Admins = d.Admins
+	policy.GroupAdminsOnly = cfg.GroupAdminsOnly
+	policy.Members = botClient
+	for _, id := range cfg.AllowedUserIDs {
+		policy.AllowUsers[id] = true
+	}
+	for _, id := range cfg.BlockedUserIDs {
+		policy.DenyUsers[id] = true
+	}
+	for _, id := range cfg.AllowedChatIDs {
+		policy.AllowChats[id] = true
+	}
+	for _, id := range cfg.BlockedChatIDs {
+		policy.DenyChats[id] = true
+	}
+	d.Access = policy
+	if cfg.AccessMode == access.ModeAllowlist && len(d.Admins) == 0 {
+		log.Println("Warning: ACCESS_MODE=allowlist without ADMIN_USER_IDS, access can only be changed in the config")
+	}
+
+	budget := cfg.ContextTokenBudget
+	window := api.MinContextWindow(cfg.AIModels)
+	if budget > window {
+		budget = window
+	}
+	// Checked again after clipping: a small model window can leave no room
+	// for the prompt even when the configured budget is fine
+	if cfg.ResponseTokenReserve >= budget {
+		log.Fatalf("Error: RESPONSE_TOKEN_RESERVE (%d) leaves no room for the prompt in the %d token context window of %s", cfg.ResponseTokenReserve, window, strings.Join(cfg.AIModels, ", "))
+	}
+	d.ContextTokens = budget - cfg.ResponseTokenReserve
+
+	if len(cfg.TitleModels) > 0 {
+		if d.TitleAI, err = api.NewModelChain(cfg.AIProvider, cfg.AIBaseURL, apiKeys, cfg.TitleModels); err != nil {
+			log.Fatalf("Error creating title model: %v", err)
+		}
+	}
+	if len(cfg.InlineModels) > 0 {
+		if d.InlineAI, err = api.NewModelChain(cfg.AIProvider, cfg.AIBaseURL, apiKeys, cfg.InlineModels); err != nil {
+			log.Fatalf("Error creating inline model: %v", err)
+		}
+	}
+	d.Tokens = api.EstimatorFor(cfg.AIModel)
+	d.SummaryKeepTurns = cfg.SummaryKeepTurns
+	d.MaxDocumentBytes = int64(cfg.MaxDocumentBytes)
+
+	if cfg.VoiceTranscription {
+		transcriber, err := api.NewTranscriber(cfg.AIProvider, cfg.AIBaseURL, apiKeys, cfg.TranscriptionModel)
+		if err != nil {
+			log.Printf("[WARN] Voice messages disabled: %v", err)
+		} else {
+			d.Transcriber = transcriber
+			d.EchoTranscript = cfg.EchoTranscript
+		}
+	}
+
+	if cfg.MemoryTopK > 0 {
+		embeddingKeys := apiKeys
+		if cfg.EmbeddingApiKey != cfg.AIApiKey || cfg.EmbeddingProvider != cfg.AIProvider || cfg.EmbeddingBaseURL != cfg.AIBaseURL {
+			embeddingKeys = api.NewKeyPool(splitKeys(cfg.EmbeddingApiKey))
+			embeddingKeys.Name = "EMBEDDING_API_KEY"
+		}
+		embedder, err := api.NewEmbedder(cfg.EmbeddingProvider, cfg.EmbeddingBaseURL, embeddingKeys, cfg.EmbeddingModel)
+		if err != nil {
+			log.Printf("[WARN] Long-term memory disabled: %v", err)
+		} else {
+			d.Embedder = embedder
+			d.MemoryTopK = cfg.MemoryTopK
+			d.MemoryMinScore = cfg.MemoryMinScore
+			log.Printf("Using %s embeddings for long-term memory", embedder.Model())
+		}
+	}
+
+	if cfg.WebFetch {
+		fetcher := webfetch.NewFetcher(nil)
+		fetcher.MaxBytes = int64(cfg.WebFetchMaxBytes)
+		fetcher.Timeout = cfg.WebFetchTimeout
+		d.Fetcher = fetcher
+		if cfg.LinkTriggers != nil {
+			d.LinkTriggers = cfg.LinkTriggers
+		}
+	}
+
+	if cfg.ToolsEnabled {
+		d.Tools = tools.NewRegistry(
+			tools.Calculator{},
+			tools.NewClock(time.Local),
+			tools.NewHistorySearch(db),
+		)
+		if d.Fetcher != nil {
+			d.Tools.Register(tools.NewFetchURL(d.Fetcher))
+		}
+		if cfg.SearchProvider != "" {
+			provider, err := search.New(cfg.SearchProvider, cfg.SearchBaseURL, cfg.SearchApiKey, nil)
+			if err != nil {
+				log.Printf("[WARN] Web search disabled: %v", err)
+			} else {
+				webSearch := tools.NewWebSearch(provider)
+				webSearch.Results = cfg.SearchResults
+				d.Tools.Register(webSearch)
+				log.Printf("Using %s for web search", provider.Name())
+			}
+		}
+	}
+
+	if cfg.ImageInput {
+		vision, err := api.NewVisionProvider(cfg.AIProvider, cfg.AIBaseURL, apiKeys, cfg.VisionModels)
+		if err != nil {
+			log.Printf("[WARN] Image input disabled: %v", err)
+		} else {
+			d.Vision = vision
+		}
+	}
+
+	// Setiap request chat dicatat ke tabel token_usage untuk /usage
+	d.Prices, err = usage.ParsePrices(cfg.ModelPrices)
+	if err != nil {
+		log.Fatalf("Error: invalid MODEL_PRICES: %v", err)
+	}
+	recorder := &usage.Recorder{DB: db}
+	for _, p := range []interface{}{d.AI, d.TitleAI, d.InlineAI, d.Vision} {
+		if r, ok := p.(api.UsageReporter); ok {
+			r.SetUsageHandler(recorder.Record)
+		}
+	}
+
+	// Batas per user, per chat dan global; token harian dihitung dari token_usage
+	limiter := limits.NewLimiter(db)
+	limiter.Default = limits.Tier{
+		User: limits.Limits{RequestsPerMinute: cfg.LimitUserRPM, TokensPerDay: cfg.LimitUserTokensPerDay},
+		Chat: limits.Limits{RequestsPerMinute: cfg.LimitChatRPM, TokensPerDay: cfg.LimitChatTokensPerDay},
+	}
+	limiter.Trusted = limits.Tier{
+		User: limits.Limits{RequestsPerMinute: cfg.TrustedUserRPM, TokensPerDay: cfg.TrustedUserTokensPerDay},
+		Chat: limits.Limits{RequestsPerMinute: cfg.TrustedChatRPM, TokensPerDay: cfg.TrustedChatTokensPerDay},
+	}
+	limiter.Global = limits.Limits{RequestsPerMinute: cfg.LimitGlobalRPM, TokensPerDay: cfg.LimitGlobalTokensPerDay}
+	for _, id := range cfg.TrustedChatIDs {
+		limiter.TrustedChats[id] = true
+	}
+	for id := range d.Admins {
+		limiter.Exempt[id] = true
+	}
+	d.Limiter = limiter
+
+	// ctx berhenti saat SIGINT/SIGTERM, handlerCtx baru dibatalkan kalau
+	// handler yang masih jalan melewati batas waktu shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	handlerCtx, cancelHandlers := context.WithCancel(context.Background())
+	defer cancelHandlers()
+
+	if cfg.UsageDailyReport {
+		if len(d.Admins) == 0 {
+			log.Println("Warning: USAGE_DAILY_REPORT is on but ADMIN_USER_IDS is empty")
+		}
+		go d.RunUsageReports(ctx)
+	}
+	if cfg.SyncCommandMenus {
+		go d.SyncCommandMenus(ctx)
+	}
+
+	if cfg.BotMode == "webhook" {
+		runWebhook(ctx, handlerCtx, cfg, botClient, d)
+	} else {
+		runPolling(ctx, handlerCtx, botClient, d)
+	}
+
+	log.Printf("Shutting down, waiting up to %s for in-flight handlers...", cfg.ShutdownTimeout)
+	if !d.Wait(cfg.ShutdownTimeout) {
+		log.Println("Warning: handlers did not finish in time, cancelling them")
+		cancelHandlers()
+		d.Wait(5 * time.Second)
+	}
+
+	if err := db.Conn.Close(); err != nil {
+		log.Printf("Error closing database: %v", err)
+	}
+	log.Println("Bot stopped.")
+}
+
+func runPolling(ctx, handlerCtx context.Context, botClient *bot.Client, d *handlers.Dispatcher) {
+	// getUpdates tidak bisa dipakai selama webhook masih terdaftar
+	if err := botClient.DeleteWebhook(ctx, false); err != nil {
+		log.Printf("Warning: failed to delete webhook: %v", err)
+	}
 
 	log.Println("Bot is running. Waiting for updates...")
 
 	offset := 0
-	for {
-		updates, err := botClient.GetUpdates(offset)
+	for ctx.Err() == nil {
+		updates, err := botClient.GetUpdates(ctx, offset, 60)
 		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
 			log.Printf("Error getting updates: %v", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(3 * time.Second):
+			}
 			continue
 		}
 
@@ -51,7 +279,100 @@ func main() {
 				offset = update.UpdateID + 1
 			}
 
-			go d.HandleUpdate(update)
+			d.Dispatch(handlerCtx, update)
+		}
+	}
+
+	// Konfirmasi offset terakhir supaya update yang sudah diproses tidak
+	// dikirim ulang oleh Telegram saat bot dinyalakan lagi
+	if offset > 0 {
+		confirmCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if _, err := botClient.GetUpdates(confirmCtx, offset, 0); err != nil {
+			log.Printf("Warning: failed to confirm update offset: %v", err)
+		}
+	}
+}
+
+func runWebhook(ctx, handlerCtx context.Context, cfg *config.Config, botClient *bot.Client, d *handlers.Dispatcher) {
+	hookURL, err := url.Parse(cfg.WebhookURL)
+	if err != nil {
+		log.Fatalf("Error: invalid WEBHOOK_URL: %v", err)
+	}
+	path := hookURL.Path
+	if path == "" {
+		path = "/"
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(path, bot.WebhookHandler(cfg.WebhookSecret, func(update models.Update) {
+		d.Dispatch(handlerCtx, update)
+	}))
+
+	if err := botClient.SetWebhook(ctx, cfg.WebhookURL, cfg.WebhookSecret); err != nil {
+		log.Fatalf("Error setting webhook: %v", err)
+	}
+
+	server := &http.Server{Addr: cfg.WebhookListenAddr, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		// Stop accepting updates; Telegram retries anything not acknowledged
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("Bot is running in webhook mode on %s%s", cfg.WebhookListenAddr, path)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Fatalf("Webhook server error: %v", err)
+	}
+}
+
+// runMigrate implements "bot migrate [status|up]".
+func runMigrate(args []string) {
+	action := "status"
+	if len(args) > 0 {
+		action = args[0]
+	}
+
+	db, err := database.OpenDB(config.LoadDatabaseFile())
+	if err != nil {
+		log.Fatalf("Error opening database: %v", err)
+	}
+	defer db.Conn.Close()
+
+	switch action {
+	case "status":
+		status, err := db.MigrationStatus()
+		if err != nil {
+			log.Fatalf("Error reading migration status: %v", err)
+		}
+		for _, m := range status {
+			state := "pending"
+			if m.Applied {
+				state = "applied " + m.AppliedAt
+			}
+			fmt.Printf("%04d  %-30s %s\n", m.Version, m.Name, state)
+		}
+	case "up":
+		applied, err := db.Migrate()
+		if err != nil {
+			log.Fatalf("Error migrating database: %v", err)
+		}
+		fmt.Printf("Applied %d migration(s)\n", applied)
+	default:
+		fmt.Fprintf(os.Stderr, "usage: %s migrate [status|up]\n", os.Args[0])
+		os.Exit(2)
+	}
+}
+
+// splitKeys parses a comma separated list of API keys.
+func splitKeys(list string) []string {
+	var keys []string
+	for _, k := range strings.Split(list, ",") {
+		if k = strings.TrimSpace(k); k != "" { // Hapus spasi jika ada
+			keys = append(keys, k)
 		}
 	}
-}
\ No newline at end of file
+	return keys
+}
@@ -4,46 +4,171 @@ import (
 	"bufio"
 	"log"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type Config struct {
 	TelegramToken string
 	DatabaseFile  string
 	SystemPrompt  string
-	GroqApiKey    string
-	GroqModel     string
 	BotUsername   string
+	// AdminUserIDs may use maintenance commands (/keys, /grant, ...) and
+	// are never refused or limited
+	AdminUserIDs []int64
+
+	// AccessMode is "open" (everyone not blocked) or "allowlist" (only
+	// allowed users and approved groups). Admins can change the lists at
+	// runtime with /grant and /revoke.
+	AccessMode      string
+	AllowedUserIDs  []int64
+	BlockedUserIDs  []int64
+	AllowedChatIDs  []int64
+	BlockedChatIDs  []int64
+	GroupAdminsOnly bool
+	// SyncCommandMenus publishes the command menus (setMyCommands) at
+	// startup
+	SyncCommandMenus bool
+
+	// AI backend selection. AIProvider is one of groq, openai, openrouter,
+	// ollama or openai-compatible (requires AIBaseURL).
+	AIProvider string
+	AIBaseURL  string
+	AIApiKey   string
+	// AIModels is the chat model chain from AI_MODEL (comma separated); the
+	// next model is used when one is unavailable. AIModel is the first.
+	AIModel  string
+	AIModels []string
+	// Per-purpose chains; empty means the chat chain is used
+	TitleModels  []string
+	InlineModels []string
+
+	// TelegramParseMode is HTML or MarkdownV2, model output is converted to it
+	TelegramParseMode string
+	// LongResponseDocumentChars sends longer answers as a .md file (0 = never)
+	LongResponseDocumentChars int
+
+	// TelegramAPIURL allows a self-hosted Bot API server (or a fake one in tests)
+	TelegramAPIURL string
+
+	// BotMode is "polling" (getUpdates) or "webhook"
+	BotMode           string
+	WebhookURL        string
+	WebhookSecret     string
+	WebhookListenAddr string
+
+	// ShutdownTimeout is how long in-flight handlers get to finish on SIGTERM
+	ShutdownTimeout time.Duration
+
+	// MaxConcurrency caps conversations processed at the same time,
+	// MaxQueueDepth caps updates waiting per conversation
+	MaxConcurrency int
+	MaxQueueDepth  int
+
+	// ContextTokenBudget caps prompt plus answer tokens per request (also
+	// clipped to the model's context window); ResponseTokenReserve of it is
+	// kept free for the answer
+	ContextTokenBudget   int
+	ResponseTokenReserve int
+
+	// SummaryKeepTurns recent turns are always sent verbatim, older ones are
+	// folded into a rolling summary (0 disables summarization)
+	SummaryKeepTurns int
+
+	// Voice notes are transcribed with TranscriptionModel on the same
+	// provider (default whisper-large-v3-turbo on Groq)
+	VoiceTranscription bool
+	TranscriptionModel string
+	EchoTranscript     bool
+
+	// Photos are answered by the VisionModels chain on the same provider
+	// (default meta-llama/llama-4-scout-17b-16e-instruct on Groq)
+	ImageInput   bool
+	VisionModels []string
+
+	// MaxDocumentBytes caps text/code/PDF files read from chats (the Bot API
+	// allows downloads up to 20 MB)
+	MaxDocumentBytes int
+
+	// Long-term memory. EmbeddingProvider is "hash" (offline, lexical) or an
+	// OpenAI-compatible provider name; MemoryTopK 0 disables memory
+	EmbeddingProvider string
+	EmbeddingBaseURL  string
+	EmbeddingApiKey   string
+	EmbeddingModel    string
+	MemoryTopK        int
+	MemoryMinScore    float64
+
+	// ToolsEnabled lets the model call the bot-side tools (calculator,
+	// clock, conversation search)
+	ToolsEnabled bool
+
+	// Web page fetching, as the fetch_url tool and for "summarize <link>"
+	// messages. LinkTriggers nil keeps the built-in trigger words.
+	WebFetch         bool
+	WebFetchMaxBytes int
+	WebFetchTimeout  time.Duration
+	LinkTriggers     []string
+
+	// Web search tool. SearchProvider is searxng or brave; empty disables it
+	SearchProvider string
+	SearchBaseURL  string
+	SearchApiKey   string
+	SearchResults  int
+
+	// ModelPrices adds to or overrides the built-in price table, as
+	// "model=input/output" in USD per million tokens
+	ModelPrices string
+	// UsageDailyReport sends admins yesterday's usage every night
+	UsageDailyReport bool
+
+	// Rate limits per minute and token budgets per day; 0 means
+	// unlimited. Chats in TrustedChatIDs get the Trusted* limits instead,
+	// admins are never limited.
+	LimitUserRPM            int
+	LimitUserTokensPerDay   int
+	LimitChatRPM            int
+	LimitChatTokensPerDay   int
+	TrustedChatIDs          []int64
+	TrustedUserRPM          int
+	TrustedUserTokensPerDay int
+	TrustedChatRPM          int
+	TrustedChatTokensPerDay int
+	LimitGlobalRPM          int
+	LimitGlobalTokensPerDay int
 }
 
 func LoadConfig() *Config {
-	file, err := os.Open(".env")
-	if err != nil {
-		log.Println("Warning: .env file not found, relying on system environment variables")
-	} else {
-		defer file.Close()
-		scanner := bufio.NewScanner(file)
-		for scanner.Scan() {
-			line := scanner.Text()
-			if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
-				continue
-			}
-			parts := strings.SplitN(line, "=", 2)
-			if len(parts) == 2 {
-				key := strings.TrimSpace(parts[0])
-				value := strings.TrimSpace(parts[1])
-				os.Setenv(key, value)
-			}
-		}
-	}
+	loadDotEnv()
 
 	cfg := &Config{
 		TelegramToken: os.Getenv("TELEGRAM_BOT_TOKEN"),
 		DatabaseFile:  os.Getenv("DATABASE_FILE"),
 		SystemPrompt:  os.Getenv("SYSTEM_PROMPT"),
-		GroqApiKey:    os.Getenv("GROQ_API_KEY"),
-		GroqModel:     os.Getenv("GROQ_MODEL"),
 		BotUsername:   os.Getenv("BOT_USERNAME"),
+		AIProvider:    strings.ToLower(os.Getenv("AI_PROVIDER")),
+		AIBaseURL:     os.Getenv("AI_BASE_URL"),
+		AIApiKey:      os.Getenv("AI_API_KEY"),
+		AIModel:       os.Getenv("AI_MODEL"),
+
+		TelegramAPIURL:    os.Getenv("TELEGRAM_API_URL"),
+		TelegramParseMode: os.Getenv("TELEGRAM_PARSE_MODE"),
+		BotMode:           strings.ToLower(os.Getenv("BOT_MODE")),
+		WebhookURL:        os.Getenv("WEBHOOK_URL"),
+		WebhookSecret:     os.Getenv("WEBHOOK_SECRET"),
+		WebhookListenAddr: os.Getenv("WEBHOOK_LISTEN_ADDR"),
+	}
+
+	// GROQ_* variables are kept for existing deployments
+	if cfg.AIApiKey == "" {
+		cfg.AIApiKey = os.Getenv("GROQ_API_KEY")
+	}
+	if cfg.AIModel == "" {
+		cfg.AIModel = os.Getenv("GROQ_MODEL")
+	}
+	if cfg.AIProvider == "" {
+		cfg.AIProvider = "groq"
 	}
 
 	if cfg.TelegramToken == "" {
@@ -55,15 +180,231 @@ func LoadConfig() *Config {
 	if cfg.SystemPrompt == "" {
 		cfg.SystemPrompt = "You are a helpful AI assistant."
 	}
-	if cfg.GroqApiKey == "" {
-		log.Fatal("Error: GROQ_API_KEY is required in .env")
+	// Local servers (Ollama, llama.cpp) usually run without auth
+	keyless := cfg.AIProvider == "ollama" || cfg.AIProvider == "openai-compatible"
+	if cfg.AIApiKey == "" && !keyless {
+		log.Fatal("Error: AI_API_KEY (or GROQ_API_KEY) is required in .env")
+	}
+	if cfg.AIModel == "" {
+		if cfg.AIProvider != "groq" {
+			log.Fatal("Error: AI_MODEL is required when AI_PROVIDER is not groq")
+		}
+		cfg.AIModel = "qwen/qwen3-32b" // Fallback default
+	}
+	cfg.AIModels = splitList(cfg.AIModel)
+	if len(cfg.AIModels) == 0 {
+		log.Fatal("Error: AI_MODEL is empty")
+	}
+	cfg.AIModel = cfg.AIModels[0]
+	cfg.AdminUserIDs = getEnvIDs("ADMIN_USER_IDS")
+	cfg.AccessMode = strings.ToLower(strings.TrimSpace(os.Getenv("ACCESS_MODE")))
+	if cfg.AccessMode == "" {
+		cfg.AccessMode = "open"
+	}
+	if cfg.AccessMode != "open" && cfg.AccessMode != "allowlist" {
+		log.Fatalf("Error: ACCESS_MODE must be open or allowlist, got %q", cfg.AccessMode)
+	}
+	cfg.AllowedUserIDs = getEnvIDs("ALLOWED_USER_IDS")
+	cfg.BlockedUserIDs = getEnvIDs("BLOCKED_USER_IDS")
+	cfg.AllowedChatIDs = getEnvIDs("ALLOWED_CHAT_IDS")
+	cfg.BlockedChatIDs = getEnvIDs("BLOCKED_CHAT_IDS")
+	cfg.GroupAdminsOnly = getEnvBool("GROUP_ADMINS_ONLY", false)
+	cfg.SyncCommandMenus = getEnvBool("SYNC_COMMAND_MENUS", true)
+	cfg.TitleModels = splitList(os.Getenv("TITLE_MODEL"))
+	cfg.InlineModels = splitList(os.Getenv("INLINE_MODEL"))
+	if cfg.TelegramParseMode == "" {
+		cfg.TelegramParseMode = "HTML"
+	}
+	if cfg.TelegramParseMode != "HTML" && cfg.TelegramParseMode != "MarkdownV2" {
+		log.Fatalf("Error: TELEGRAM_PARSE_MODE must be HTML or MarkdownV2, got %q", cfg.TelegramParseMode)
+	}
+	if cfg.BotMode == "" {
+		cfg.BotMode = "polling"
+	}
+	if cfg.BotMode != "polling" && cfg.BotMode != "webhook" {
+		log.Fatalf("Error: BOT_MODE must be polling or webhook, got %q", cfg.BotMode)
+	}
+	if cfg.BotMode == "webhook" {
+		if cfg.WebhookURL == "" {
+			log.Fatal("Error: WEBHOOK_URL is required when BOT_MODE=webhook")
+		}
+		if cfg.WebhookSecret == "" {
+			log.Fatal("Error: WEBHOOK_SECRET is required when BOT_MODE=webhook")
+		}
+		if cfg.WebhookListenAddr == "" {
+			cfg.WebhookListenAddr = ":8080"
+		}
+	}
+	cfg.ShutdownTimeout = 30 * time.Second
+	if v := os.Getenv("SHUTDOWN_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("Error: invalid SHUTDOWN_TIMEOUT %q: %v", v, err)
+		}
+		cfg.ShutdownTimeout = d
+	}
+	cfg.LongResponseDocumentChars = getEnvInt("LONG_RESPONSE_DOCUMENT_CHARS", 0)
+	cfg.MaxConcurrency = getEnvInt("MAX_CONCURRENCY", 8)
+	cfg.MaxQueueDepth = getEnvInt("MAX_QUEUE_DEPTH", 5)
+	cfg.ContextTokenBudget = getEnvInt("CONTEXT_TOKEN_BUDGET", 8000)
+	cfg.ResponseTokenReserve = getEnvInt("RESPONSE_TOKEN_RESERVE", 1024)
+	cfg.SummaryKeepTurns = getEnvInt("SUMMARY_KEEP_TURNS", 6)
+	cfg.VoiceTranscription = getEnvBool("VOICE_TRANSCRIPTION", true)
+	cfg.TranscriptionModel = os.Getenv("TRANSCRIPTION_MODEL")
+	cfg.EchoTranscript = getEnvBool("VOICE_ECHO_TRANSCRIPT", false)
+	cfg.ImageInput = getEnvBool("IMAGE_INPUT", true)
+	cfg.VisionModels = splitList(os.Getenv("VISION_MODEL"))
+	cfg.MaxDocumentBytes = getEnvInt("MAX_DOCUMENT_BYTES", 10<<20)
+	if cfg.MaxDocumentBytes > 20<<20 {
+		cfg.MaxDocumentBytes = 20 << 20
+	}
+	cfg.EmbeddingProvider = strings.ToLower(os.Getenv("EMBEDDING_PROVIDER"))
+	if cfg.EmbeddingProvider == "" {
+		cfg.EmbeddingProvider = "hash"
+	}
+	cfg.EmbeddingBaseURL = os.Getenv("EMBEDDING_BASE_URL")
+	cfg.EmbeddingModel = os.Getenv("EMBEDDING_MODEL")
+	cfg.EmbeddingApiKey = os.Getenv("EMBEDDING_API_KEY")
+	if cfg.EmbeddingApiKey == "" && cfg.EmbeddingProvider == cfg.AIProvider {
+		cfg.EmbeddingApiKey = cfg.AIApiKey
+	}
+	cfg.MemoryTopK = getEnvInt("MEMORY_TOP_K", 4)
+	cfg.MemoryMinScore = getEnvFloat("MEMORY_MIN_SCORE", 0.3)
+	cfg.ToolsEnabled = getEnvBool("TOOLS_ENABLED", true)
+	cfg.WebFetch = getEnvBool("WEB_FETCH", true)
+	cfg.WebFetchMaxBytes = getEnvInt("WEB_FETCH_MAX_BYTES", 2<<20)
+	cfg.WebFetchTimeout = 15 * time.Second
+	if v := os.Getenv("WEB_FETCH_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("Error: invalid WEB_FETCH_TIMEOUT %q: %v", v, err)
+		}
+		cfg.WebFetchTimeout = d
+	}
+	cfg.SearchProvider = strings.ToLower(os.Getenv("SEARCH_PROVIDER"))
+	cfg.SearchBaseURL = os.Getenv("SEARCH_BASE_URL")
+	cfg.SearchApiKey = os.Getenv("SEARCH_API_KEY")
+	cfg.SearchResults = getEnvInt("SEARCH_RESULTS", 5)
+	cfg.ModelPrices = os.Getenv("MODEL_PRICES")
+	cfg.UsageDailyReport = getEnvBool("USAGE_DAILY_REPORT", false)
+	cfg.LimitUserRPM = getEnvInt("LIMIT_USER_RPM", 6)
+	cfg.LimitUserTokensPerDay = getEnvInt("LIMIT_USER_TOKENS_PER_DAY", 200000)
+	cfg.LimitChatRPM = getEnvInt("LIMIT_CHAT_RPM", 20)
+	cfg.LimitChatTokensPerDay = getEnvInt("LIMIT_CHAT_TOKENS_PER_DAY", 0)
+	cfg.TrustedChatIDs = getEnvIDs("TRUSTED_CHAT_IDS")
+	cfg.TrustedUserRPM = getEnvInt("TRUSTED_USER_RPM", 20)
+	cfg.TrustedUserTokensPerDay = getEnvInt("TRUSTED_USER_TOKENS_PER_DAY", 0)
+	cfg.TrustedChatRPM = getEnvInt("TRUSTED_CHAT_RPM", 60)
+	cfg.TrustedChatTokensPerDay = getEnvInt("TRUSTED_CHAT_TOKENS_PER_DAY", 0)
+	cfg.LimitGlobalRPM = getEnvInt("LIMIT_GLOBAL_RPM", 0)
+	cfg.LimitGlobalTokensPerDay = getEnvInt("LIMIT_GLOBAL_TOKENS_PER_DAY", 0)
+	if v, ok := os.LookupEnv("LINK_TRIGGERS"); ok {
+		cfg.LinkTriggers = append([]string{}, splitList(v)...)
 	}
-	if cfg.GroqModel == "" {
-		cfg.GroqModel = "qwen/qwen3-32b" // Fallback default
+	if cfg.ResponseTokenReserve >= cfg.ContextTokenBudget {
+		log.Fatal("Error: RESPONSE_TOKEN_RESERVE must be smaller than CONTEXT_TOKEN_BUDGET")
 	}
 	if cfg.BotUsername == "" {
 		log.Println("Warning: BOT_USERNAME is not set in .env. Group mentions might not work perfectly.")
 	}
 
 	return cfg
-}
\ No newline at end of file
+}
+
+// loadDotEnv copies variables from .env into the environment.
+func loadDotEnv() {
+	file, err := os.Open(".env")
+	if err != nil {
+		log.Println("Warning: .env file not found, relying on system environment variables")
+		return
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) == 2 {
+			key := strings.TrimSpace(parts[0])
+			value := strings.TrimSpace(parts[1])
+			os.Setenv(key, value)
+		}
+	}
+}
+
+// LoadDatabaseFile returns only the database path, for maintenance
+// commands that must work without bot credentials.
+func LoadDatabaseFile() string {
+	loadDotEnv()
+	if file := os.Getenv("DATABASE_FILE"); file != "" {
+		return file
+	}
+	return "telechatbot.db"
+}
+
+// splitList splits a comma separated value, dropping empty entries.
+func splitList(v string) []string {
+	var out []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// getEnvIDs parses a comma separated list of Telegram user or chat IDs and
+// stops the bot on anything that is not a number.
+func getEnvIDs(key string) []int64 {
+	var ids []int64
+	for _, v := range splitList(os.Getenv(key)) {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			log.Fatalf("Error: %s must be numeric Telegram IDs, got %q", key, v)
+		}
+		ids = append(ids, n)
+	}
+	return ids
+}
+
+// getEnvInt reads an integer variable, falling back to def when unset.
+func getEnvInt(key string, def int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Fatalf("Error: %s must be a number, got %q", key, v)
+	}
+	return n
+}
+
+// getEnvFloat reads a decimal variable, falling back to def when unset.
+func getEnvFloat(key string, def float64) float64 {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		log.Fatalf("Error: %s must be a number, got %q", key, v)
+	}
+	return f
+}
+
+// getEnvBool reads a true/false variable, falling back to def when unset.
+func getEnvBool(key string, def bool) bool {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Fatalf("Error: %s must be true or false, got %q", key, v)
+	}
+	return b
+}
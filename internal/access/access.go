@@ -0,0 +1,211 @@
+// Package access decides who may use the bot. Allow and deny lists come
+// from the config and from the access_rules table that admins edit at
+// runtime; a rule in the table wins over the config.
+package access
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"telechatbot/internal/database"
+	"telechatbot/internal/models"
+	"time"
+)
+
+// Modes: in open mode everyone not blocked may use the bot, in allowlist
+// mode only allowed users (in private) and approved groups
+const (
+	ModeOpen      = "open"
+	ModeAllowlist = "allowlist"
+)
+
+// ErrNoDatabase is returned when rules are changed on a policy that has
+// nowhere to store them.
+var ErrNoDatabase = errors.New("access rules need a database")
+
+// memberCacheTTL is how long a getChatMember answer is trusted
+const memberCacheTTL = 5 * time.Minute
+
+// Decision is the outcome of a Check.
+type Decision int
+
+const (
+	Allowed Decision = iota
+	// UserDenied: the user is blocked, or not allowed in allowlist mode
+	UserDenied
+	// ChatDenied: the group is blocked or not approved
+	ChatDenied
+	// NotGroupAdmin: only group admins may ask and the user isn't one
+	NotGroupAdmin
+)
+
+// MemberChecker looks up a user's status in a chat (bot.Client).
+type MemberChecker interface {
+	GetChatMember(ctx context.Context, chatID, userID int64) (*models.ChatMember, error)
+}
+
+// Policy is safe for concurrent use; a nil Policy allows everything.
+type Policy struct {
+	DB   *database.DB
+	Mode string
+	// Admins are bot admins: always allowed, and they manage the rules
+	Admins map[int64]bool
+
+	AllowUsers map[int64]bool
+	DenyUsers  map[int64]bool
+	AllowChats map[int64]bool
+	DenyChats  map[int64]bool
+
+	// GroupAdminsOnly limits groups to their admins (via Members)
+	GroupAdminsOnly bool
+	Members         MemberChecker
+
+	mu      sync.Mutex
+	members map[memberKey]cachedMember
+}
+
+type memberKey struct {
+	chatID, userID int64
+}
+
+type cachedMember struct {
+	admin   bool
+	checked time.Time
+}
+
+func NewPolicy(db *database.DB) *Policy {
+	return &Policy{
+		DB:         db,
+		Mode:       ModeOpen,
+		Admins:     make(map[int64]bool),
+		AllowUsers: make(map[int64]bool),
+		DenyUsers:  make(map[int64]bool),
+		AllowChats: make(map[int64]bool),
+		DenyChats:  make(map[int64]bool),
+		members:    make(map[memberKey]cachedMember),
+	}
+}
+
+// Check decides whether userID may talk to the bot in chat. In approved
+// groups every member may, unless blocked or GroupAdminsOnly is set.
+func (p *Policy) Check(ctx context.Context, chat *models.Chat, userID int64) Decision {
+	if p == nil || p.Admins[userID] {
+		return Allowed
+	}
+	if chat.Type == "private" {
+		if p.UserAllowed(userID) {
+			return Allowed
+		}
+		return UserDenied
+	}
+
+	if !p.ChatApproved(chat.ID) {
+		return ChatDenied
+	}
+	if p.decide(database.AccessUser, userID, p.AllowUsers, p.DenyUsers) == database.AccessDeny {
+		return UserDenied
+	}
+	if p.GroupAdminsOnly && !p.isGroupAdmin(ctx, chat.ID, userID) {
+		return NotGroupAdmin
+	}
+	return Allowed
+}
+
+// UserAllowed reports whether userID may use the bot outside of groups
+// (private chat, inline mode).
+func (p *Policy) UserAllowed(userID int64) bool {
+	if p == nil || p.Admins[userID] {
+		return true
+	}
+	return p.allowed(p.decide(database.AccessUser, userID, p.AllowUsers, p.DenyUsers))
+}
+
+// ChatApproved reports whether the bot may stay in a group.
+func (p *Policy) ChatApproved(chatID int64) bool {
+	if p == nil {
+		return true
+	}
+	return p.allowed(p.decide(database.AccessChat, chatID, p.AllowChats, p.DenyChats))
+}
+
+// IsAdmin reports whether userID is a bot admin.
+func (p *Policy) IsAdmin(userID int64) bool {
+	return p != nil && p.Admins[userID]
+}
+
+// decide returns the rule for id: the stored one if any, else the config
+// lists (deny first), else "".
+func (p *Policy) decide(kind string, id int64, allow, deny map[int64]bool) string {
+	var rule string
+	if p.DB != nil {
+		var err error
+		rule, err = p.DB.GetAccessRule(kind, id)
+		if err != nil {
+			log.Printf("[ERROR] Failed to load access rule for %s %d: %v", kind, id, err)
+		}
+	}
+	switch {
+	case rule != "":
+		return rule
+	case deny[id]:
+		return database.AccessDeny
+	case allow[id]:
+		return database.AccessAllow
+	}
+	return ""
+}
+
+func (p *Policy) allowed(rule string) bool {
+	if rule == "" {
+		return p.Mode != ModeAllowlist
+	}
+	return rule == database.AccessAllow
+}
+
+// isGroupAdmin asks Telegram whether userID administers chatID. Lookup
+// errors deny, the mode exists to keep others out.
+func (p *Policy) isGroupAdmin(ctx context.Context, chatID, userID int64) bool {
+	key := memberKey{chatID, userID}
+	p.mu.Lock()
+	c, ok := p.members[key]
+	p.mu.Unlock()
+	if ok && time.Since(c.checked) < memberCacheTTL {
+		return c.admin
+	}
+
+	member, err := p.Members.GetChatMember(ctx, chatID, userID)
+	if err != nil {
+		log.Printf("[WARN] Failed to check if user %d is admin of chat %d: %v", userID, chatID, err)
+		return false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// Drop expired entries now and then so the cache doesn't grow forever
+	if len(p.members) > 1000 {
+		for k, v := range p.members {
+			if time.Since(v.checked) >= memberCacheTTL {
+				delete(p.members, k)
+			}
+		}
+	}
+	p.members[key] = cachedMember{admin: member.IsAdmin(), checked: time.Now()}
+	return member.IsAdmin()
+}
+
+// Set stores an allow or deny rule for a user or chat.
+func (p *Policy) Set(kind string, id int64, rule string, by int64) error {
+	if p == nil || p.DB == nil {
+		return ErrNoDatabase
+	}
+	return p.DB.SetAccessRule(kind, id, rule, by)
+}
+
+// Reset removes the stored rule, so the config decides again.
+func (p *Policy) Reset(kind string, id int64) error {
+	if p == nil || p.DB == nil {
+		return ErrNoDatabase
+	}
+	return p.DB.DeleteAccessRule(kind, id)
+}
@@ -0,0 +1,177 @@
+package access
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"telechatbot/internal/database"
+	"telechatbot/internal/models"
+	"testing"
+)
+
+func newTestPolicy(t *testing.T) *Policy {
+	t.Helper()
+	db, err := database.OpenDB(filepath.Join(t.TempDir(), "bot.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Conn.Close() })
+	if _, err := db.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	return NewPolicy(db)
+}
+
+// fakeMembers answers getChatMember from statuses and counts the lookups.
+type fakeMembers struct {
+	statuses map[int64]string
+	err      error
+	lookups  int
+}
+
+func (f *fakeMembers) GetChatMember(ctx context.Context, chatID, userID int64) (*models.ChatMember, error) {
+	f.lookups++
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &models.ChatMember{Status: f.statuses[userID]}, nil
+}
+
+var (
+	private = &models.Chat{ID: 1, Type: "private"}
+	group   = &models.Chat{ID: -100, Type: "supergroup"}
+)
+
+func TestRulesInOpenMode(t *testing.T) {
+	p := newTestPolicy(t)
+	p.DenyUsers[2] = true
+	p.DenyChats[-200] = true
+
+	for _, tt := range []struct {
+		name   string
+		chat   *models.Chat
+		userID int64
+		want   Decision
+	}{
+		{"anyone in private", private, 1, Allowed},
+		{"anyone in a group", group, 1, Allowed},
+		{"blocked user in private", private, 2, UserDenied},
+		{"blocked user in a group", group, 2, UserDenied},
+		{"blocked group", &models.Chat{ID: -200, Type: "group"}, 1, ChatDenied},
+	} {
+		if got := p.Check(context.Background(), tt.chat, tt.userID); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRulesInAllowlistMode(t *testing.T) {
+	p := newTestPolicy(t)
+	p.Mode = ModeAllowlist
+	p.Admins[9] = true
+	p.AllowUsers[1] = true
+	p.AllowChats[group.ID] = true
+	p.DenyUsers[3] = true
+
+	for _, tt := range []struct {
+		name   string
+		chat   *models.Chat
+		userID int64
+		want   Decision
+	}{
+		{"allowed user in private", private, 1, Allowed},
+		{"unknown user in private", private, 2, UserDenied},
+		{"unknown user in an approved group", group, 2, Allowed},
+		{"blocked user in an approved group", group, 3, UserDenied},
+		{"allowed user in an unknown group", &models.Chat{ID: -300, Type: "group"}, 1, ChatDenied},
+		{"bot admin anywhere", &models.Chat{ID: -300, Type: "group"}, 9, Allowed},
+	} {
+		if got := p.Check(context.Background(), tt.chat, tt.userID); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestStoredRulesWinOverConfig(t *testing.T) {
+	p := newTestPolicy(t)
+	p.Mode = ModeAllowlist
+	p.AllowUsers[1] = true
+	p.DenyUsers[2] = true
+
+	if err := p.Set(database.AccessUser, 1, database.AccessDeny, 9); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Set(database.AccessUser, 2, database.AccessAllow, 9); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Set(database.AccessChat, -300, database.AccessAllow, 9); err != nil {
+		t.Fatal(err)
+	}
+	if p.UserAllowed(1) || !p.UserAllowed(2) || !p.ChatApproved(-300) {
+		t.Errorf("stored rules ignored: user 1 %v, user 2 %v, chat %v", p.UserAllowed(1), p.UserAllowed(2), p.ChatApproved(-300))
+	}
+
+	// Without the stored rules the config decides again
+	for _, id := range []int64{1, 2} {
+		if err := p.Reset(database.AccessUser, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p.Reset(database.AccessChat, -300)
+	if !p.UserAllowed(1) || p.UserAllowed(2) || p.ChatApproved(-300) {
+		t.Errorf("after reset: user 1 %v, user 2 %v, chat %v", p.UserAllowed(1), p.UserAllowed(2), p.ChatApproved(-300))
+	}
+}
+
+func TestGroupAdminsOnly(t *testing.T) {
+	p := newTestPolicy(t)
+	members := &fakeMembers{statuses: map[int64]string{1: "creator", 2: "administrator", 3: "member"}}
+	p.GroupAdminsOnly = true
+	p.Members = members
+	p.Admins[9] = true
+
+	for userID, want := range map[int64]Decision{1: Allowed, 2: Allowed, 3: NotGroupAdmin, 9: Allowed} {
+		if got := p.Check(context.Background(), group, userID); got != want {
+			t.Errorf("user %d: got %v, want %v", userID, got, want)
+		}
+	}
+	// Private chats are not affected, answers are cached and bot admins
+	// are never looked up
+	if got := p.Check(context.Background(), private, 3); got != Allowed {
+		t.Errorf("private chat: got %v", got)
+	}
+	p.Check(context.Background(), group, 3)
+	if members.lookups != 3 {
+		t.Errorf("%d lookups, want 3", members.lookups)
+	}
+
+	// A blocked user is denied before the lookup; failed lookups deny
+	p.DenyUsers[4] = true
+	if got := p.Check(context.Background(), group, 4); got != UserDenied {
+		t.Errorf("blocked user: got %v", got)
+	}
+	members.err = errors.New("chat not found")
+	if got := p.Check(context.Background(), group, 5); got != NotGroupAdmin {
+		t.Errorf("failed lookup: got %v", got)
+	}
+}
+
+func TestPolicyWithoutDatabase(t *testing.T) {
+	var nilPolicy *Policy
+	if got := nilPolicy.Check(context.Background(), group, 1); got != Allowed {
+		t.Errorf("nil policy: got %v", got)
+	}
+	if err := nilPolicy.Set(database.AccessUser, 1, database.AccessDeny, 9); !errors.Is(err, ErrNoDatabase) {
+		t.Errorf("Set on a nil policy: got %v", err)
+	}
+
+	p := NewPolicy(nil)
+	p.DenyUsers[2] = true
+	if err := p.Reset(database.AccessUser, 2); !errors.Is(err, ErrNoDatabase) {
+		t.Errorf("Reset without a database: got %v", err)
+	}
+	// The config lists still apply
+	if p.UserAllowed(2) || !p.UserAllowed(1) {
+		t.Errorf("config lists ignored without a database")
+	}
+}
@@ -0,0 +1,176 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+	"telechatbot/internal/terms"
+)
+
+// Embedder turns texts into vectors for similarity search. Vectors of one
+// Embedder are only comparable with each other, so stored vectors are
+// tagged with Model().
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+	Model() string
+}
+
+// NewEmbedder builds an embedder by provider name. "hash" is the offline
+// HashEmbedder; other names are OpenAI-compatible /embeddings endpoints as
+// in NewChatProvider (Groq has no embeddings API).
+func NewEmbedder(name, baseURL string, keys *KeyPool, model string) (Embedder, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	switch name {
+	case "", "hash":
+		return NewHashEmbedder(hashEmbeddingDim), nil
+	case "groq":
+		return nil, fmt.Errorf("groq has no embeddings API, use EMBEDDING_PROVIDER=hash or another provider")
+	}
+	if model == "" {
+		return nil, fmt.Errorf("EMBEDDING_MODEL is required for embedding provider %q", name)
+	}
+
+	provider, err := NewChatProvider(name, baseURL, keys, model)
+	if err != nil {
+		return nil, err
+	}
+	e, ok := provider.(*OpenAIClient)
+	if !ok {
+		return nil, fmt.Errorf("provider %q does not support embeddings", name)
+	}
+	return &openAIEmbedder{e}, nil
+}
+
+// openAIEmbedder adapts OpenAIClient (whose Model is the embedding model)
+// to Embedder without clashing with its chat methods.
+type openAIEmbedder struct {
+	c *OpenAIClient
+}
+
+func (e *openAIEmbedder) Model() string { return e.c.Name + ":" + e.c.Model }
+
+func (e *openAIEmbedder) KeyPools() []*KeyPool { return e.c.KeyPools() }
+
+type embeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type embeddingResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+// Embed implements Embedder, using the key pool like SendChat.
+func (e *openAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	var vectors [][]float32
+	err := e.c.withKeys(ctx, "Embedding request", func(lease *KeyLease) error {
+		var err error
+		vectors, err = e.attemptEmbed(ctx, lease, texts)
+		return err
+	})
+	return vectors, err
+}
+
+func (e *openAIEmbedder) attemptEmbed(ctx context.Context, lease *KeyLease, texts []string) ([][]float32, error) {
+	body, err := json.Marshal(embeddingRequest{Model: e.c.Model, Input: texts})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := e.c.post(ctx, e.c.HttpClient, lease, "/embeddings", "application/json", "application/json", body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result embeddingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	if len(result.Data) != len(texts) {
+		return nil, fmt.Errorf("%s returned %d embeddings for %d inputs", e.c.Name, len(result.Data), len(texts))
+	}
+
+	vectors := make([][]float32, len(texts))
+	for _, d := range result.Data {
+		if d.Index < 0 || d.Index >= len(vectors) {
+			return nil, fmt.Errorf("%s returned embedding index %d out of range", e.c.Name, d.Index)
+		}
+		vectors[d.Index] = Normalize(d.Embedding)
+	}
+	return vectors, nil
+}
+
+const hashEmbeddingDim = 512
+
+// HashEmbedder is a deterministic, offline embedder: words (without stop
+// words, see terms.Split) and word pairs are hashed into a fixed
+// number of signed buckets. It only captures lexical overlap, not meaning,
+// but needs no API and is stable across runs, which also makes it the
+// fake for tests.
+type HashEmbedder struct {
+	Dim int
+}
+
+func NewHashEmbedder(dim int) *HashEmbedder {
+	if dim <= 0 {
+		dim = hashEmbeddingDim
+	}
+	return &HashEmbedder{Dim: dim}
+}
+
+func (h *HashEmbedder) Model() string { return fmt.Sprintf("hash-%d", h.Dim) }
+
+func (h *HashEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, t := range texts {
+		vectors[i] = h.embed(t)
+	}
+	return vectors, nil
+}
+
+func (h *HashEmbedder) embed(text string) []float32 {
+	v := make([]float32, h.Dim)
+	words := terms.Split(text)
+
+	add := func(feature string, weight float32) {
+		f := fnv.New64a()
+		f.Write([]byte(feature))
+		sum := f.Sum64()
+		bucket := int(sum % uint64(h.Dim))
+		if sum&(1<<63) != 0 {
+			weight = -weight
+		}
+		v[bucket] += weight
+	}
+	for i, w := range words {
+		add(w, 1)
+		if i > 0 {
+			add(words[i-1]+" "+w, 0.5)
+		}
+	}
+	return Normalize(v)
+}
+
+// Normalize scales v to unit length so cosine similarity is a dot product.
+func Normalize(v []float32) []float32 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return v
+	}
+	norm := float32(1 / math.Sqrt(sum))
+	out := make([]float32, len(v))
+	for i, x := range v {
+		out[i] = x * norm
+	}
+	return out
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+func dotProduct(a, b []float32) float64 {
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
+
+func TestHashEmbedder(t *testing.T) {
+	h := NewHashEmbedder(0)
+	if h.Dim != hashEmbeddingDim || h.Model() != "hash-512" {
+		t.Errorf("got dim %d model %q", h.Dim, h.Model())
+	}
+
+	texts := []string{
+		"The invoice for the server rental is due in March",
+		"When is the server rental invoice due?",
+		"My cat likes to sleep on the keyboard",
+		"",
+	}
+	vectors, err := h.Embed(context.Background(), texts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range vectors[:3] {
+		if len(v) != h.Dim {
+			t.Fatalf("vector %d has %d dims", i, len(v))
+		}
+		if norm := dotProduct(v, v); math.Abs(norm-1) > 1e-5 {
+			t.Errorf("vector %d has squared norm %f, want 1", i, norm)
+		}
+	}
+	if dotProduct(vectors[3], vectors[3]) != 0 {
+		t.Error("empty text should embed to the zero vector")
+	}
+
+	// Same input, same vector
+	again, _ := h.Embed(context.Background(), texts[:1])
+	if dotProduct(again[0], vectors[0]) < 1-1e-5 {
+		t.Error("embedding is not deterministic")
+	}
+
+	related, unrelated := dotProduct(vectors[0], vectors[1]), dotProduct(vectors[0], vectors[2])
+	if related <= unrelated || related < 0.3 {
+		t.Errorf("related score %f, unrelated %f", related, unrelated)
+	}
+}
+
+func TestNewEmbedder(t *testing.T) {
+	if e, err := NewEmbedder("", "", nil, ""); err != nil || e.Model() != "hash-512" {
+		t.Errorf("default embedder %v, %v", e, err)
+	}
+	if _, err := NewEmbedder("groq", "", nil, "m"); err == nil {
+		t.Error("groq accepted as embedding provider")
+	}
+	if _, err := NewEmbedder("openai", "", nil, ""); err == nil {
+		t.Error("missing model accepted")
+	}
+}
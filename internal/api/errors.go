@@ -0,0 +1,95 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// APIError is a non-200 answer from a provider.
+type APIError struct {
+	Provider   string
+	StatusCode int
+	// Code and Message come from the OpenAI-style {"error": {...}} body
+	// when the server sends one
+	Code    string
+	Message string
+	Body    string
+	// RetryAfter is how long the server asked us to wait (429 responses)
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s api error %d: %s", e.Provider, e.StatusCode, e.Body)
+}
+
+func newAPIError(provider string, status int, header http.Header, body []byte) *APIError {
+	e := &APIError{Provider: provider, StatusCode: status, Body: strings.TrimSpace(string(body))}
+	if status == http.StatusTooManyRequests {
+		e.RetryAfter = retryAfter(header)
+	}
+
+	var parsed struct {
+		Error struct {
+			Message string          `json:"message"`
+			Type    string          `json:"type"`
+			Code    json.RawMessage `json:"code"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &parsed) == nil {
+		e.Message = parsed.Error.Message
+		// code is a string on most servers, a number on some
+		var code string
+		if json.Unmarshal(parsed.Error.Code, &code) != nil {
+			code = strings.Trim(string(parsed.Error.Code), `"`)
+		}
+		if code == "" || code == "null" {
+			code = parsed.Error.Type
+		}
+		e.Code = code
+	}
+	return e
+}
+
+func asAPIError(err error) (*APIError, bool) {
+	var apiErr *APIError
+	ok := errors.As(err, &apiErr)
+	return apiErr, ok
+}
+
+// IsModelUnavailable reports whether err means the model itself can't
+// serve the request right now (unknown, decommissioned or overloaded), so
+// another model may succeed where other keys would not.
+func IsModelUnavailable(err error) bool {
+	apiErr, ok := asAPIError(err)
+	if !ok {
+		return false
+	}
+	switch apiErr.StatusCode {
+	case http.StatusNotFound, http.StatusServiceUnavailable:
+		return true
+	}
+	code := strings.ToLower(apiErr.Code)
+	msg := strings.ToLower(apiErr.Message)
+	return code == "model_decommissioned" || code == "model_not_found" || code == "model_not_active" ||
+		strings.Contains(msg, "decommissioned") || strings.Contains(msg, "does not exist")
+}
+
+// retryWithOtherKey reports whether another API key (or the same one
+// after its cooldown) may succeed: rate limits, rejected keys, server
+// errors and network failures. Bad requests and unavailable models fail
+// the same with every key.
+func retryWithOtherKey(err error) bool {
+	apiErr, ok := asAPIError(err)
+	if !ok {
+		return true
+	}
+	switch apiErr.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests:
+		return true
+	}
+	return apiErr.StatusCode >= 500 && !IsModelUnavailable(err)
+}
@@ -0,0 +1,192 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"telechatbot/internal/models"
+	"time"
+)
+
+// Models that failed are skipped for a while so every request doesn't pay
+// for the failed attempt first. A missing model will not come back soon,
+// an overloaded one might.
+const (
+	unavailableCooldown = 1 * time.Hour
+	overloadedCooldown  = 2 * time.Minute
+)
+
+// ModelChain tries an ordered list of models and falls back to the next
+// one when a model is unavailable (404, 503, decommissioned). Other errors
+// are returned as they are.
+type ModelChain struct {
+	Providers []ChatProvider
+	Models    []string
+
+	mu        sync.Mutex
+	downUntil map[int]time.Time
+}
+
+// NewModelChain builds one provider per model of the same backend, all
+// using the key pool keys. A chain of one model behaves exactly like that
+// model's provider.
+func NewModelChain(name, baseURL string, keys *KeyPool, modelNames []string) (*ModelChain, error) {
+	if len(modelNames) == 0 {
+		return nil, fmt.Errorf("no models configured")
+	}
+	chain := &ModelChain{downUntil: make(map[int]time.Time)}
+	for _, m := range modelNames {
+		p, err := NewChatProvider(name, baseURL, keys, m)
+		if err != nil {
+			return nil, err
+		}
+		chain.Providers = append(chain.Providers, p)
+		chain.Models = append(chain.Models, m)
+	}
+	return chain, nil
+}
+
+// Primary returns the first model of the chain.
+func (m *ModelChain) Primary() string {
+	return m.Models[0]
+}
+
+func (m *ModelChain) String() string {
+	return strings.Join(m.Models, " → ")
+}
+
+// Capabilities are the features every model of the chain has, so a
+// request shaped for them still works after a fallback.
+func (m *ModelChain) Capabilities() Capabilities {
+	caps := m.Providers[0].Capabilities()
+	for _, p := range m.Providers[1:] {
+		c := p.Capabilities()
+		caps.Streaming = caps.Streaming && c.Streaming
+		caps.Reasoning = caps.Reasoning && c.Reasoning
+		caps.Vision = caps.Vision && c.Vision
+		caps.Tools = caps.Tools && c.Tools
+	}
+	return caps
+}
+
+// setCaps applies fn to the capabilities of every model, e.g. to mark a
+// vision chain.
+func (m *ModelChain) setCaps(fn func(*Capabilities)) {
+	for _, p := range m.Providers {
+		switch c := p.(type) {
+		case *GroqClient:
+			fn(&c.Caps)
+		case *OpenAIClient:
+			fn(&c.Caps)
+		}
+	}
+}
+
+func (m *ModelChain) SendChat(ctx context.Context, messages []models.GroqMessage) (string, string, error) {
+	res, err := m.Complete(ctx, ChatRequest{Messages: messages}, nil)
+	return res.Content, res.Reasoning, err
+}
+
+func (m *ModelChain) SendChatStream(ctx context.Context, messages []models.GroqMessage, onDelta StreamHandler) (string, string, error) {
+	res, err := m.Complete(ctx, ChatRequest{Messages: messages}, onDelta)
+	return res.Content, res.Reasoning, err
+}
+
+// Complete implements ChatProvider. Models in cooldown are skipped unless
+// all of them are, then the chain is tried in order anyway.
+func (m *ModelChain) Complete(ctx context.Context, req ChatRequest, onDelta StreamHandler) (ChatResult, error) {
+	order := m.order()
+	var lastErr error
+
+	for n, i := range order {
+		started := false
+		wrapped := onDelta
+		if onDelta != nil {
+			wrapped = func(delta StreamDelta) {
+				started = true
+				onDelta(delta)
+			}
+		}
+
+		res, err := m.Providers[i].Complete(ctx, req, wrapped)
+		if err == nil {
+			m.markUp(i)
+			if res.Model == "" {
+				res.Model = m.Models[i]
+			}
+			if n > 0 {
+				log.Printf("[INFO] Answered by fallback model %s", m.Models[i])
+			}
+			return res, nil
+		}
+		if started || ctx.Err() != nil || !IsModelUnavailable(err) {
+			return res, err
+		}
+
+		lastErr = err
+		m.markDown(i, err)
+		if n+1 < len(order) {
+			log.Printf("[WARN] Model %s unavailable, falling back to %s: %v", m.Models[i], m.Models[order[n+1]], err)
+		}
+	}
+
+	return ChatResult{}, fmt.Errorf("all models unavailable, last error: %w", lastErr)
+}
+
+// KeyPools implements KeyReporter for every model of the chain.
+func (m *ModelChain) KeyPools() []*KeyPool {
+	var out []*KeyPool
+	for _, p := range m.Providers {
+		if r, ok := p.(KeyReporter); ok {
+			out = append(out, r.KeyPools()...)
+		}
+	}
+	return out
+}
+
+// SetUsageHandler implements UsageReporter for every model of the chain.
+func (m *ModelChain) SetUsageHandler(h UsageHandler) {
+	for _, p := range m.Providers {
+		if r, ok := p.(UsageReporter); ok {
+			r.SetUsageHandler(h)
+		}
+	}
+}
+
+// order lists the models not in cooldown first, keeping the configured
+// order, followed by the ones in cooldown as a last resort.
+func (m *ModelChain) order() []int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var up, down []int
+	for i := range m.Providers {
+		if until, ok := m.downUntil[i]; ok && now.Before(until) {
+			down = append(down, i)
+		} else {
+			up = append(up, i)
+		}
+	}
+	return append(up, down...)
+}
+
+func (m *ModelChain) markUp(i int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.downUntil, i)
+}
+
+func (m *ModelChain) markDown(i int, err error) {
+	cooldown := unavailableCooldown
+	if apiErr, ok := asAPIError(err); ok && apiErr.StatusCode == http.StatusServiceUnavailable {
+		cooldown = overloadedCooldown
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.downUntil[i] = time.Now().Add(cooldown)
+}
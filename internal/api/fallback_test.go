@@ -0,0 +1,179 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"telechatbot/internal/models"
+	"testing"
+	"time"
+)
+
+// fakeModel answers Complete with result or err, streaming deltas first
+// when the caller asked for a stream.
+type fakeModel struct {
+	result ChatResult
+	err    error
+	deltas []StreamDelta
+	caps   Capabilities
+	calls  int
+}
+
+func (f *fakeModel) SendChat(ctx context.Context, messages []models.GroqMessage) (string, string, error) {
+	res, err := f.Complete(ctx, ChatRequest{Messages: messages}, nil)
+	return res.Content, res.Reasoning, err
+}
+
+func (f *fakeModel) SendChatStream(ctx context.Context, messages []models.GroqMessage, onDelta StreamHandler) (string, string, error) {
+	res, err := f.Complete(ctx, ChatRequest{Messages: messages}, onDelta)
+	return res.Content, res.Reasoning, err
+}
+
+func (f *fakeModel) Complete(ctx context.Context, req ChatRequest, onDelta StreamHandler) (ChatResult, error) {
+	f.calls++
+	if onDelta != nil {
+		for _, d := range f.deltas {
+			onDelta(d)
+		}
+	}
+	return f.result, f.err
+}
+
+func (f *fakeModel) Capabilities() Capabilities { return f.caps }
+
+func testChain(providers ...*fakeModel) *ModelChain {
+	chain := &ModelChain{downUntil: make(map[int]time.Time)}
+	for i, p := range providers {
+		chain.Providers = append(chain.Providers, p)
+		chain.Models = append(chain.Models, string(rune('a'+i)))
+	}
+	return chain
+}
+
+func TestModelChainFallsBack(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		err      error
+		fallback bool
+	}{
+		{"not found", &APIError{StatusCode: http.StatusNotFound}, true},
+		{"overloaded", &APIError{StatusCode: http.StatusServiceUnavailable}, true},
+		{"decommissioned", &APIError{StatusCode: http.StatusBadRequest, Code: "model_decommissioned"}, true},
+		{"decommissioned message", &APIError{StatusCode: http.StatusBadRequest, Message: "The model has been decommissioned"}, true},
+		{"bad request", &APIError{StatusCode: http.StatusBadRequest, Message: "context too long"}, false},
+		{"rate limited", &APIError{StatusCode: http.StatusTooManyRequests}, false},
+		{"network", errors.New("connection reset"), false},
+	} {
+		primary := &fakeModel{err: tt.err}
+		backup := &fakeModel{result: ChatResult{Content: "from b"}}
+		res, err := testChain(primary, backup).Complete(context.Background(), ChatRequest{}, nil)
+
+		if tt.fallback {
+			if err != nil || res.Content != "from b" || backup.calls != 1 {
+				t.Errorf("%s: got %q, %v after %d backup calls", tt.name, res.Content, err, backup.calls)
+			}
+		} else if !errors.Is(err, tt.err) || backup.calls != 0 {
+			t.Errorf("%s: got %v after %d backup calls, want the error", tt.name, err, backup.calls)
+		}
+	}
+}
+
+func TestModelChainAllUnavailable(t *testing.T) {
+	notFound := &APIError{StatusCode: http.StatusNotFound}
+	_, err := testChain(&fakeModel{err: notFound}, &fakeModel{err: notFound}).Complete(context.Background(), ChatRequest{}, nil)
+	if !errors.Is(err, notFound) || !strings.Contains(err.Error(), "all models unavailable") {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestModelChainNoFallbackAfterStreaming(t *testing.T) {
+	// The user has already seen part of the first answer
+	primary := &fakeModel{err: &APIError{StatusCode: http.StatusServiceUnavailable}, deltas: []StreamDelta{{Content: "Hel"}}}
+	backup := &fakeModel{result: ChatResult{Content: "from b"}}
+
+	var seen []StreamDelta
+	_, err := testChain(primary, backup).Complete(context.Background(), ChatRequest{}, func(d StreamDelta) { seen = append(seen, d) })
+	if err == nil || backup.calls != 0 {
+		t.Errorf("got %v after %d backup calls", err, backup.calls)
+	}
+	if len(seen) != 1 {
+		t.Errorf("got deltas %+v", seen)
+	}
+
+	// Before the first delta a streamed request still falls back
+	primary.deltas = nil
+	res, err := testChain(primary, backup).Complete(context.Background(), ChatRequest{}, func(StreamDelta) {})
+	if err != nil || res.Content != "from b" {
+		t.Errorf("got %q, %v", res.Content, err)
+	}
+}
+
+func TestModelChainCooldown(t *testing.T) {
+	primary := &fakeModel{err: &APIError{StatusCode: http.StatusNotFound}}
+	backup := &fakeModel{result: ChatResult{Content: "from b"}}
+	chain := testChain(primary, backup)
+
+	chain.Complete(context.Background(), ChatRequest{}, nil)
+	// The missing model is skipped while in cooldown
+	if order := chain.order(); order[0] != 1 || order[1] != 0 {
+		t.Fatalf("order %v, want the backup first", order)
+	}
+	chain.Complete(context.Background(), ChatRequest{}, nil)
+	if primary.calls != 1 || backup.calls != 2 {
+		t.Errorf("primary called %d times, backup %d", primary.calls, backup.calls)
+	}
+
+	// An overloaded model gets a shorter cooldown than a missing one
+	overloaded := testChain(&fakeModel{err: &APIError{StatusCode: http.StatusServiceUnavailable}}, backup)
+	overloaded.Complete(context.Background(), ChatRequest{}, nil)
+	if short, long := time.Until(overloaded.downUntil[0]), time.Until(chain.downUntil[0]); short > overloadedCooldown || short >= long {
+		t.Errorf("cooldowns %s and %s", short, long)
+	}
+
+	// Once the cooldown is over the configured order is back; a success
+	// clears the cooldown
+	chain.downUntil[0] = time.Now().Add(-time.Second)
+	primary.err, primary.result = nil, ChatResult{Content: "from a"}
+	if res, _ := chain.Complete(context.Background(), ChatRequest{}, nil); res.Content != "from a" {
+		t.Errorf("got %q", res.Content)
+	}
+	if _, down := chain.downUntil[0]; down {
+		t.Error("cooldown kept after a success")
+	}
+
+	// With every model in cooldown they are still tried in order
+	both := testChain(&fakeModel{result: ChatResult{Content: "from a"}}, backup)
+	both.downUntil[0] = time.Now().Add(time.Hour)
+	both.downUntil[1] = time.Now().Add(time.Minute)
+	if order := both.order(); order[0] != 0 {
+		t.Errorf("order %v", order)
+	}
+}
+
+func TestModelChainRecordsModel(t *testing.T) {
+	primary := &fakeModel{err: &APIError{StatusCode: http.StatusNotFound}}
+	backup := &fakeModel{result: ChatResult{Content: "from b"}}
+	res, _ := testChain(primary, backup).Complete(context.Background(), ChatRequest{}, nil)
+	if res.Model != "b" {
+		t.Errorf("model %q, want the fallback's name", res.Model)
+	}
+
+	// The name reported by the server wins
+	backup.result.Model = "b-2024-06"
+	res, _ = testChain(primary, backup).Complete(context.Background(), ChatRequest{}, nil)
+	if res.Model != "b-2024-06" {
+		t.Errorf("model %q, want the server's name", res.Model)
+	}
+}
+
+func TestModelChainCapabilities(t *testing.T) {
+	full := Capabilities{Streaming: true, Reasoning: true, Vision: true, Tools: true}
+	chain := testChain(&fakeModel{caps: full}, &fakeModel{caps: Capabilities{Streaming: true, Tools: true}})
+	if got := chain.Capabilities(); got != (Capabilities{Streaming: true, Tools: true}) {
+		t.Errorf("got %+v, want what every model supports", got)
+	}
+	if got := testChain(&fakeModel{caps: full}).Capabilities(); got != full {
+		t.Errorf("single model: got %+v", got)
+	}
+}
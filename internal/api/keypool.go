@@ -0,0 +1,295 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Cooldown after a 429 without usable headers, doubled per repeated
+	// failure of the same key up to maxKeyCooldown
+	baseKeyCooldown = 2 * time.Second
+	maxKeyCooldown  = 5 * time.Minute
+	// maxKeyWait is the longest a request waits for a key to cool down;
+	// beyond that the user gets an error instead of a hanging bot
+	maxKeyWait  = 20 * time.Second
+	backoffBase = 250 * time.Millisecond
+)
+
+var (
+	ErrNoKeys         = errors.New("all api keys are disabled")
+	ErrAllKeysCooling = errors.New("all api keys are rate limited")
+)
+
+// KeyPool hands out API keys per request. Each request gets the healthy
+// key with the fewest requests in flight; keys that hit a rate limit cool
+// down for as long as the server asks (Retry-After, x-ratelimit-reset-*)
+// and keys rejected with 401 are disabled until restart. An empty pool is
+// valid for servers without auth and always hands out "".
+//
+// One pool is shared by every client using the same key list, so the
+// health of a key is known across models, chains and endpoints.
+type KeyPool struct {
+	// Name is shown by /keys, e.g. the variable the keys come from
+	Name string
+
+	mu   sync.Mutex
+	keys []*keyState
+}
+
+type keyState struct {
+	key           string
+	index         int
+	inFlight      int
+	cooldownUntil time.Time
+	disabled      bool
+	failures      int // consecutive rate limits, for the fallback cooldown
+	lastUsed      time.Time
+	requests      int
+	errors        int
+	lastError     string
+}
+
+// KeyStatus is a snapshot of one key for the admin /keys command.
+type KeyStatus struct {
+	Key           string // masked
+	InFlight      int
+	Disabled      bool
+	CooldownUntil time.Time
+	Requests      int
+	Errors        int
+	LastError     string
+}
+
+// KeyReporter is implemented by providers that use a KeyPool. Pools
+// shared by several providers are listed by each of them.
+type KeyReporter interface {
+	KeyPools() []*KeyPool
+}
+
+func NewKeyPool(keys []string) *KeyPool {
+	p := &KeyPool{}
+	for i, k := range keys {
+		p.keys = append(p.keys, &keyState{key: k, index: i})
+	}
+	return p
+}
+
+func (p *KeyPool) Len() int {
+	return len(p.keys)
+}
+
+// KeyLease is a key checked out for one request. Release must be called
+// with the outcome.
+type KeyLease struct {
+	Key string
+	// Index is the position of Key in the pool, -1 for an empty pool
+	Index int
+	pool  *KeyPool
+	state *keyState
+}
+
+// Acquire returns the least loaded usable key. When all keys are cooling
+// down it waits for the first one (plus jitter growing with attempt), as
+// long as that is within maxKeyWait.
+func (p *KeyPool) Acquire(ctx context.Context, attempt int) (*KeyLease, error) {
+	if len(p.keys) == 0 {
+		return &KeyLease{Index: -1, pool: p}, nil
+	}
+
+	for {
+		p.mu.Lock()
+		now := time.Now()
+		var best, cooling *keyState
+		for _, k := range p.keys {
+			if k.disabled {
+				continue
+			}
+			if now.Before(k.cooldownUntil) {
+				if cooling == nil || k.cooldownUntil.Before(cooling.cooldownUntil) {
+					cooling = k
+				}
+				continue
+			}
+			if best == nil || k.inFlight < best.inFlight ||
+				(k.inFlight == best.inFlight && k.lastUsed.Before(best.lastUsed)) {
+				best = k
+			}
+		}
+		if best != nil {
+			best.inFlight++
+			best.requests++
+			best.lastUsed = now
+			p.mu.Unlock()
+			return &KeyLease{Key: best.key, Index: best.index, pool: p, state: best}, nil
+		}
+		p.mu.Unlock()
+
+		if cooling == nil {
+			return nil, ErrNoKeys
+		}
+		wait := time.Until(cooling.cooldownUntil) + jitter(attempt)
+		if wait > maxKeyWait {
+			return nil, fmt.Errorf("%w, next key free in %s", ErrAllKeysCooling, time.Until(cooling.cooldownUntil).Round(time.Second))
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+		attempt++
+	}
+}
+
+// jitter is a random wait of up to backoffBase * 2^attempt (capped), so
+// requests waiting for the same key don't all fire at once.
+func jitter(attempt int) time.Duration {
+	if attempt > 6 {
+		attempt = 6
+	}
+	return time.Duration(rand.Int63n(int64(backoffBase << attempt)))
+}
+
+// Release returns the key and records the outcome of the request.
+func (l *KeyLease) Release(err error) {
+	if l.state == nil {
+		return
+	}
+	p := l.pool
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	k := l.state
+	k.inFlight--
+	if err == nil {
+		k.failures = 0
+		return
+	}
+
+	apiErr, ok := asAPIError(err)
+	if !ok {
+		return
+	}
+	k.errors++
+	k.lastError = fmt.Sprintf("%d %s", apiErr.StatusCode, http.StatusText(apiErr.StatusCode))
+
+	switch apiErr.StatusCode {
+	case http.StatusUnauthorized:
+		k.disabled = true
+	case http.StatusTooManyRequests:
+		k.failures++
+		wait := apiErr.RetryAfter
+		if wait <= 0 {
+			wait = baseKeyCooldown << (k.failures - 1)
+		}
+		if wait > maxKeyCooldown || wait <= 0 {
+			wait = maxKeyCooldown
+		}
+		k.cooldownUntil = time.Now().Add(wait)
+	}
+}
+
+// Observe applies rate limit headers of a successful response: a key
+// with no requests or tokens left cools down until the reset.
+func (l *KeyLease) Observe(h http.Header) {
+	if l.state == nil {
+		return
+	}
+	var wait time.Duration
+	if h.Get("x-ratelimit-remaining-requests") == "0" {
+		wait = maxDuration(wait, parseReset(h.Get("x-ratelimit-reset-requests")))
+	}
+	if h.Get("x-ratelimit-remaining-tokens") == "0" {
+		wait = maxDuration(wait, parseReset(h.Get("x-ratelimit-reset-tokens")))
+	}
+	if wait <= 0 {
+		return
+	}
+	if wait > maxKeyCooldown {
+		wait = maxKeyCooldown
+	}
+
+	l.pool.mu.Lock()
+	defer l.pool.mu.Unlock()
+	if until := time.Now().Add(wait); until.After(l.state.cooldownUntil) {
+		l.state.cooldownUntil = until
+	}
+}
+
+// Status returns a snapshot of all keys.
+func (p *KeyPool) Status() []KeyStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	out := make([]KeyStatus, len(p.keys))
+	for i, k := range p.keys {
+		out[i] = KeyStatus{
+			Key:           MaskKey(k.key),
+			InFlight:      k.inFlight,
+			Disabled:      k.disabled,
+			CooldownUntil: k.cooldownUntil,
+			Requests:      k.requests,
+			Errors:        k.errors,
+			LastError:     k.lastError,
+		}
+	}
+	return out
+}
+
+// MaskKey shows only the prefix and the last 4 characters of a key.
+func MaskKey(key string) string {
+	if len(key) <= 8 {
+		return strings.Repeat("•", len(key))
+	}
+	prefix := ""
+	if i := strings.IndexAny(key, "_-"); i > 0 && i < 6 {
+		prefix = key[:i+1]
+	}
+	return prefix + "…" + key[len(key)-4:]
+}
+
+// retryAfter reads how long the server wants us to wait: Retry-After
+// (seconds or HTTP date), else the later of the x-ratelimit-reset-*
+// headers Groq and OpenAI send ("2m59.56s", "7.66s", "120ms").
+func retryAfter(h http.Header) time.Duration {
+	if v := strings.TrimSpace(h.Get("Retry-After")); v != "" {
+		if secs, err := strconv.ParseFloat(v, 64); err == nil {
+			return time.Duration(secs * float64(time.Second))
+		}
+		if t, err := http.ParseTime(v); err == nil {
+			return time.Until(t)
+		}
+	}
+	return maxDuration(parseReset(h.Get("x-ratelimit-reset-requests")), parseReset(h.Get("x-ratelimit-reset-tokens")))
+}
+
+func parseReset(v string) time.Duration {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0
+	}
+	if d, err := time.ParseDuration(v); err == nil {
+		return d
+	}
+	if secs, err := strconv.ParseFloat(v, 64); err == nil {
+		return time.Duration(secs * float64(time.Second))
+	}
+	return 0
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
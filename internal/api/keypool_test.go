@@ -0,0 +1,186 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"telechatbot/internal/models"
+	"testing"
+	"time"
+)
+
+func rateLimited(header http.Header) error {
+	return newAPIError("test", http.StatusTooManyRequests, header, nil)
+}
+
+func acquire(t *testing.T, p *KeyPool) *KeyLease {
+	t.Helper()
+	lease, err := p.Acquire(context.Background(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lease
+}
+
+func TestKeyPoolRetryAfter(t *testing.T) {
+	p := NewKeyPool([]string{"key-a", "key-b"})
+
+	lease := acquire(t, p)
+	lease.Release(rateLimited(http.Header{"Retry-After": {"30"}}))
+
+	status := p.Status()[lease.Index]
+	if wait := time.Until(status.CooldownUntil); wait < 29*time.Second || wait > 30*time.Second {
+		t.Errorf("cooldown %s, want about 30s", wait)
+	}
+	// The other key is handed out while the first cools down
+	for i := 0; i < 3; i++ {
+		next := acquire(t, p)
+		if next.Key == lease.Key {
+			t.Fatalf("got cooling key %s", next.Key)
+		}
+		next.Release(nil)
+	}
+}
+
+func TestKeyPoolRateLimitReset(t *testing.T) {
+	for _, tc := range []struct {
+		header http.Header
+		want   time.Duration
+	}{
+		{http.Header{"X-Ratelimit-Reset-Requests": {"2m59.56s"}}, 2*time.Minute + 59560*time.Millisecond},
+		{http.Header{"X-Ratelimit-Reset-Tokens": {"7.66s"}}, 7660 * time.Millisecond},
+		{http.Header{"X-Ratelimit-Reset-Requests": {"120ms"}, "X-Ratelimit-Reset-Tokens": {"3s"}}, 3 * time.Second},
+		{http.Header{"Retry-After": {"2"}, "X-Ratelimit-Reset-Tokens": {"9s"}}, 2 * time.Second},
+		{http.Header{}, 0},
+	} {
+		if got := retryAfter(tc.header); got != tc.want {
+			t.Errorf("retryAfter(%v) = %s, want %s", tc.header, got, tc.want)
+		}
+	}
+
+	// A success with no requests left cools the key until the reset
+	p := NewKeyPool([]string{"key-a"})
+	lease := acquire(t, p)
+	lease.Observe(http.Header{
+		"X-Ratelimit-Remaining-Requests": {"0"},
+		"X-Ratelimit-Reset-Requests":     {"10s"},
+	})
+	lease.Release(nil)
+	if wait := time.Until(p.Status()[0].CooldownUntil); wait < 9*time.Second || wait > 10*time.Second {
+		t.Errorf("cooldown %s, want about 10s", wait)
+	}
+
+	// Without Retry-After the fallback cooldown doubles per failure
+	p = NewKeyPool([]string{"key-a"})
+	for i, want := range []time.Duration{baseKeyCooldown, 2 * baseKeyCooldown} {
+		lease := &KeyLease{Key: "key-a", Index: 0, pool: p, state: p.keys[0]}
+		p.keys[0].inFlight++
+		lease.Release(rateLimited(http.Header{}))
+		wait := time.Until(p.Status()[0].CooldownUntil)
+		if wait > want || wait < want-time.Second {
+			t.Errorf("failure %d: cooldown %s, want %s", i+1, wait, want)
+		}
+	}
+}
+
+func TestKeyPoolDisablesUnauthorized(t *testing.T) {
+	p := NewKeyPool([]string{"key-a", "key-b"})
+
+	lease := acquire(t, p)
+	lease.Release(newAPIError("test", http.StatusUnauthorized, nil, nil))
+	if !p.Status()[lease.Index].Disabled {
+		t.Fatal("key not disabled after 401")
+	}
+
+	other := acquire(t, p)
+	if other.Key == lease.Key {
+		t.Fatalf("got disabled key %s", other.Key)
+	}
+	other.Release(newAPIError("test", http.StatusUnauthorized, nil, nil))
+
+	if _, err := p.Acquire(context.Background(), 0); !errors.Is(err, ErrNoKeys) {
+		t.Errorf("got error %v, want ErrNoKeys", err)
+	}
+}
+
+func TestKeyPoolWaitsForCooldown(t *testing.T) {
+	p := NewKeyPool([]string{"key-a", "key-b"})
+	for range p.keys {
+		lease := acquire(t, p)
+		defer lease.Release(nil)
+	}
+	for _, k := range p.keys {
+		k.cooldownUntil = time.Now().Add(100 * time.Millisecond)
+	}
+
+	start := time.Now()
+	lease, err := p.Acquire(context.Background(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lease.Release(nil)
+	if waited := time.Since(start); waited < 100*time.Millisecond {
+		t.Errorf("acquired after %s, before the cooldown ended", waited)
+	}
+
+	// Beyond maxKeyWait the caller gets an error instead of waiting
+	for _, k := range p.keys {
+		k.cooldownUntil = time.Now().Add(maxKeyWait + time.Minute)
+	}
+	if _, err := p.Acquire(context.Background(), 0); !errors.Is(err, ErrAllKeysCooling) {
+		t.Errorf("got error %v, want ErrAllKeysCooling", err)
+	}
+
+	// Cancelling the context stops the wait
+	for _, k := range p.keys {
+		k.cooldownUntil = time.Now().Add(time.Second)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := p.Acquire(ctx, 0); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestKeyPoolSharedAcrossClients(t *testing.T) {
+	var mu sync.Mutex
+	used := make(map[string]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		mu.Lock()
+		used[key]++
+		mu.Unlock()
+		if key == "bad-key" {
+			http.Error(w, `{"error":{"message":"invalid key"}}`, http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"model":"m","choices":[{"message":{"role":"assistant","content":"ok"}}]}`))
+	}))
+	defer srv.Close()
+
+	keys := NewKeyPool([]string{"bad-key", "good-key"})
+	chain, err := NewModelChain("openai-compatible", srv.URL, keys, []string{"model-a", "model-b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := NewOpenAIClient(srv.URL, keys, "model-c")
+
+	msgs := []models.GroqMessage{{Role: "user", Content: "hi"}}
+	for _, p := range []ChatProvider{chain, other, chain.Providers[1]} {
+		for i := 0; i < 2; i++ {
+			if _, _, err := p.SendChat(context.Background(), msgs); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if used["bad-key"] != 1 {
+		t.Errorf("bad key used %d times, want once across all clients", used["bad-key"])
+	}
+	if len(chain.KeyPools()) != 2 || chain.KeyPools()[0] != keys || other.KeyPools()[0] != keys {
+		t.Error("clients don't report the shared pool")
+	}
+}
@@ -0,0 +1,263 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"telechatbot/internal/models"
+	"time"
+)
+
+// OpenAIClient talks to any server that implements the OpenAI
+// /chat/completions API (OpenAI, OpenRouter, Ollama, llama.cpp, vLLM, ...).
+type OpenAIClient struct {
+	Name       string
+	BaseURL    string
+	Keys       *KeyPool
+	Model      string
+	Caps       Capabilities
+	HttpClient *http.Client
+
+	// OnUsage is called after every successful chat request; may be nil
+	OnUsage UsageHandler
+}
+
+// NewOpenAIClient creates a client for an OpenAI-compatible endpoint.
+// baseURL is the API root, e.g. "https://api.openai.com/v1".
+// keys may be empty (or nil) for local servers that do not require auth.
+func NewOpenAIClient(baseURL string, keys *KeyPool, model string) *OpenAIClient {
+	if keys == nil {
+		keys = NewKeyPool(nil)
+	}
+	return &OpenAIClient{
+		Name:       "openai",
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		Keys:       keys,
+		Model:      model,
+		Caps:       Capabilities{Streaming: true, Tools: true},
+		HttpClient: &http.Client{Timeout: 120 * time.Second},
+	}
+}
+
+func (c *OpenAIClient) Capabilities() Capabilities {
+	return c.Caps
+}
+
+// KeyPools implements KeyReporter.
+func (c *OpenAIClient) KeyPools() []*KeyPool {
+	return []*KeyPool{c.Keys}
+}
+
+// SetUsageHandler implements UsageReporter.
+func (c *OpenAIClient) SetUsageHandler(h UsageHandler) {
+	c.OnUsage = h
+}
+
+// finalError marks an attempt error that must not be retried with another
+// key, e.g. a stream that already delivered deltas.
+type finalError struct {
+	err error
+}
+
+func (e finalError) Error() string { return e.err.Error() }
+func (e finalError) Unwrap() error { return e.err }
+
+// withKeys runs attempt with keys from the pool until it succeeds or fails
+// in a way another key can't fix. Every key gets one try, plus one more
+// that may wait for a rate-limited key to cool down.
+func (c *OpenAIClient) withKeys(ctx context.Context, what string, attempt func(lease *KeyLease) error) error {
+	tries := c.Keys.Len() + 1
+	if c.Keys.Len() == 0 {
+		tries = 1
+	}
+	var lastErr error
+
+	for i := 0; i < tries; i++ {
+		lease, err := c.Keys.Acquire(ctx, i)
+		if err != nil {
+			if lastErr != nil {
+				return fmt.Errorf("%v, last error: %w", err, lastErr)
+			}
+			return err
+		}
+
+		err = attempt(lease)
+		lease.Release(err)
+		if err == nil {
+			return nil
+		}
+		var final finalError
+		if errors.As(err, &final) {
+			return final.err
+		}
+		// Shutdown or caller gave up, other keys won't help
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !retryWithOtherKey(err) {
+			return err
+		}
+
+		lastErr = err
+		log.Printf("[WARN] %s failed with key %s (attempt %d/%d): %v", what, MaskKey(lease.Key), i+1, tries, err)
+	}
+
+	return fmt.Errorf("all api keys exhausted, last error: %w", lastErr)
+}
+
+func (c *OpenAIClient) SendChat(ctx context.Context, messages []models.GroqMessage) (string, string, error) {
+	res, err := c.Complete(ctx, ChatRequest{Messages: messages}, nil)
+	return res.Content, res.Reasoning, err
+}
+
+func (c *OpenAIClient) SendChatStream(ctx context.Context, messages []models.GroqMessage, onDelta StreamHandler) (string, string, error) {
+	res, err := c.Complete(ctx, ChatRequest{Messages: messages}, onDelta)
+	return res.Content, res.Reasoning, err
+}
+
+// Complete implements ChatProvider. Failed requests are retried with
+// another key, except for a stream that already delivered deltas, since
+// those cannot be taken back.
+func (c *OpenAIClient) Complete(ctx context.Context, req ChatRequest, onDelta StreamHandler) (ChatResult, error) {
+	var res ChatResult
+	err := c.withKeys(ctx, "Chat request", func(lease *KeyLease) error {
+		start := time.Now()
+		defer func() {
+			res.Usage.Provider = c.Name
+			res.Usage.Model = res.Model
+			res.Usage.KeyIndex = lease.Index
+			res.Usage.Latency = time.Since(start)
+		}()
+
+		var err error
+		if onDelta == nil {
+			res, err = c.attemptRequest(ctx, lease, req)
+			return err
+		}
+
+		started := false
+		res, err = c.attemptStream(ctx, lease, req, func(delta StreamDelta) {
+			started = true
+			onDelta(delta)
+		})
+		if err != nil && started {
+			return finalError{err}
+		}
+		return err
+	})
+	if err == nil && c.OnUsage != nil {
+		c.OnUsage(ctx, res.Usage)
+	}
+	return res, err
+}
+
+func (c *OpenAIClient) attemptRequest(ctx context.Context, lease *KeyLease, req ChatRequest) (ChatResult, error) {
+	resp, err := c.doRequest(ctx, c.HttpClient, lease, req, false)
+	if err != nil {
+		return ChatResult{}, err
+	}
+	defer resp.Body.Close()
+
+	return c.decodeResponse(resp.Body)
+}
+
+func (c *OpenAIClient) decodeResponse(body io.Reader) (ChatResult, error) {
+	var chatResp models.GroqChatResponse
+	if err := json.NewDecoder(body).Decode(&chatResp); err != nil {
+		return ChatResult{}, err
+	}
+
+	if len(chatResp.Choices) == 0 {
+		return ChatResult{}, fmt.Errorf("%s returned no choices", c.Name)
+	}
+
+	choice := chatResp.Choices[0]
+	model := chatResp.Model
+	if model == "" {
+		model = c.Model
+	}
+	return ChatResult{
+		Model:        model,
+		Content:      choice.Message.Content,
+		Reasoning:    choice.Message.Reasoning,
+		ToolCalls:    choice.Message.ToolCalls,
+		FinishReason: choice.FinishReason,
+		Usage:        tokenUsage(chatResp.Usage),
+	}, nil
+}
+
+// tokenUsage copies the token counts of a response; the caller fills in
+// where the request went.
+func tokenUsage(u *models.GroqUsage) Usage {
+	if u == nil {
+		return Usage{}
+	}
+	return Usage{
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		ReasoningTokens:  u.ReasoningTokens(),
+	}
+}
+
+// doRequest posts a chat completion request with the current key and returns
+// the response if the status is 200. The caller must close the body.
+func (c *OpenAIClient) doRequest(ctx context.Context, httpClient *http.Client, lease *KeyLease, req ChatRequest, stream bool) (*http.Response, error) {
+	reqBody := models.GroqChatRequest{
+		Model:    c.Model,
+		Messages: req.Messages,
+		Stream:   stream,
+	}
+	if stream {
+		reqBody.StreamOptions = &models.StreamOptions{IncludeUsage: true}
+	}
+	if len(req.Tools) > 0 {
+		reqBody.Tools = req.Tools
+		reqBody.ToolChoice = req.ToolChoice
+	}
+
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	accept := "application/json"
+	if stream {
+		accept = "text/event-stream"
+	}
+	return c.post(ctx, httpClient, lease, "/chat/completions", "application/json", accept, jsonData)
+}
+
+// post sends body to path with the leased key and returns the response if
+// the status is 200. The caller must close the body.
+func (c *OpenAIClient) post(ctx context.Context, httpClient *http.Client, lease *KeyLease, path, contentType, accept string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", accept)
+	if lease.Key != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", lease.Key))
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		bodyBytes, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		return nil, newAPIError(c.Name, resp.StatusCode, resp.Header, bodyBytes)
+	}
+
+	lease.Observe(resp.Header)
+	return resp, nil
+}
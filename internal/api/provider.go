@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"telechatbot/internal/models"
+)
+
+// ChatProvider is the interface every LLM backend implements.
+// The dispatcher only depends on this, never on a concrete client.
+type ChatProvider interface {
+	// SendChat returns the answer content and, if the backend provides it,
+	// the separate reasoning text.
+	SendChat(ctx context.Context, messages []models.GroqMessage) (string, string, error)
+	// SendChatStream works like SendChat but calls onDelta for every
+	// content/reasoning fragment as it arrives. The full content and
+	// reasoning are returned once the stream is complete.
+	SendChatStream(ctx context.Context, messages []models.GroqMessage, onDelta StreamHandler) (string, string, error)
+	// Complete is the general form of both: with req.Tools the model may
+	// answer with ToolCalls instead of content. A nil onDelta makes a
+	// non-streaming request.
+	Complete(ctx context.Context, req ChatRequest, onDelta StreamHandler) (ChatResult, error)
+	Capabilities() Capabilities
+}
+
+// ChatRequest is a completion request with optional tools.
+type ChatRequest struct {
+	Messages   []models.GroqMessage
+	Tools      []models.Tool
+	ToolChoice string // "auto", "none", "required" or "" for the server default
+}
+
+// ChatResult is a finished completion.
+type ChatResult struct {
+	// Model is the model that produced the answer, as reported by the server
+	Model        string
+	Content      string
+	Reasoning    string
+	ToolCalls    []models.ToolCall
+	FinishReason string
+	// Usage of the request that produced this result; zero token counts
+	// if the server doesn't report them
+	Usage Usage
+}
+
+// StreamDelta is one incremental fragment of a streamed completion.
+type StreamDelta struct {
+	Content   string
+	Reasoning string
+}
+
+type StreamHandler func(delta StreamDelta)
+
+// Capabilities describes optional features of a provider so callers can
+// decide which code path to use.
+type Capabilities struct {
+	Streaming bool // supports "stream": true SSE responses
+	Reasoning bool // returns reasoning in a separate field
+	Vision    bool // accepts image_url content parts
+	Tools     bool // supports tools / tool_calls
+}
+
+var defaultBaseURLs = map[string]string{
+	"groq":       groqURL,
+	"openai":     "https://api.openai.com/v1",
+	"openrouter": "https://openrouter.ai/api/v1",
+	"ollama":     "http://localhost:11434/v1",
+}
+
+// NewChatProvider builds a provider by name. Known names are "groq", "openai",
+// "openrouter", "ollama" and "openai-compatible" (which requires baseURL).
+// A non-empty baseURL always overrides the provider default.
+func NewChatProvider(name, baseURL string, keys *KeyPool, model string) (ChatProvider, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		name = "groq"
+	}
+
+	if name == "groq" && baseURL == "" {
+		return NewGroqClient(keys, model), nil
+	}
+
+	if baseURL == "" {
+		baseURL = defaultBaseURLs[name]
+	}
+	if baseURL == "" {
+		return nil, fmt.Errorf("unknown AI provider %q (set AI_BASE_URL for openai-compatible servers)", name)
+	}
+
+	c := NewOpenAIClient(baseURL, keys, model)
+	c.Name = name
+	if name == "groq" {
+		c.Caps.Reasoning = true
+	}
+	return c, nil
+}
+
+var defaultVisionModels = map[string]string{
+	"groq":   "meta-llama/llama-4-scout-17b-16e-instruct",
+	"openai": "gpt-4o-mini",
+}
+
+// NewVisionProvider builds a model chain for image input. modelNames
+// defaults to a vision model of the provider where one is known.
+func NewVisionProvider(name, baseURL string, keys *KeyPool, modelNames []string) (ChatProvider, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		name = "groq"
+	}
+	if len(modelNames) == 0 && defaultVisionModels[name] != "" {
+		modelNames = []string{defaultVisionModels[name]}
+	}
+	if len(modelNames) == 0 {
+		return nil, fmt.Errorf("no default vision model for provider %q (set VISION_MODEL)", name)
+	}
+
+	chain, err := NewModelChain(name, baseURL, keys, modelNames)
+	if err != nil {
+		return nil, err
+	}
+	chain.setCaps(func(c *Capabilities) { c.Vision = true })
+	return chain, nil
+}
@@ -0,0 +1,166 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"telechatbot/internal/models"
+	"time"
+)
+
+// streamTimeout caps a whole streamed completion. Tokens keep arriving so
+// this can be much longer than the non-streaming timeout.
+const streamTimeout = 5 * time.Minute
+
+// maxToolCalls bounds the tool call index a stream may use, so a broken
+// server cannot make us allocate arbitrarily many calls
+const maxToolCalls = 32
+
+// errStreamCut is returned by readSSE when the body ends without [DONE],
+// e.g. because the connection dropped.
+var errStreamCut = errors.New("stream ended before [DONE]")
+
+func (c *OpenAIClient) attemptStream(ctx context.Context, lease *KeyLease, req ChatRequest, onDelta StreamHandler) (ChatResult, error) {
+	httpClient := *c.HttpClient
+	httpClient.Timeout = streamTimeout
+
+	resp, err := c.doRequest(ctx, &httpClient, lease, req, true)
+	if err != nil {
+		return ChatResult{}, err
+	}
+	defer resp.Body.Close()
+
+	// Some servers ignore "stream": true and answer with a normal JSON body
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		res, err := c.decodeResponse(resp.Body)
+		if err != nil {
+			return ChatResult{}, err
+		}
+		onDelta(StreamDelta{Content: res.Content, Reasoning: res.Reasoning})
+		return res, nil
+	}
+
+	var content, reasoning strings.Builder
+	var calls []models.ToolCall
+	finishReason := ""
+	model := c.Model
+	var usage *models.GroqUsage
+
+	err = readSSE(resp, func(data string) error {
+		var chunk models.GroqStreamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("invalid stream chunk: %v", err)
+		}
+		if chunk.Error != nil {
+			return fmt.Errorf("%s stream error: %s", c.Name, chunk.Error.Message)
+		}
+		if chunk.Model != "" {
+			model = chunk.Model
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		} else if chunk.XGroq != nil && chunk.XGroq.Usage != nil {
+			usage = chunk.XGroq.Usage
+		}
+		if len(chunk.Choices) == 0 {
+			return nil
+		}
+
+		choice := chunk.Choices[0]
+		if choice.FinishReason != nil {
+			finishReason = *choice.FinishReason
+		}
+		delta := choice.Delta
+		merged, err := mergeToolCallDeltas(calls, delta.ToolCalls)
+		if err != nil {
+			return err
+		}
+		calls = merged
+		if delta.Content == "" && delta.Reasoning == "" {
+			return nil
+		}
+		content.WriteString(delta.Content)
+		reasoning.WriteString(delta.Reasoning)
+		onDelta(StreamDelta{Content: delta.Content, Reasoning: delta.Reasoning})
+		return nil
+	})
+	// Servers that end with a finish_reason but no [DONE] sent a complete
+	// answer; without either the answer was cut off and must not be saved
+	if errors.Is(err, errStreamCut) {
+		if finishReason != "" {
+			err = nil
+		} else {
+			err = fmt.Errorf("%s: %w", c.Name, err)
+		}
+	}
+
+	return ChatResult{
+		Model:        model,
+		Content:      content.String(),
+		Reasoning:    reasoning.String(),
+		ToolCalls:    calls,
+		FinishReason: finishReason,
+		Usage:        tokenUsage(usage),
+	}, err
+}
+
+// mergeToolCallDeltas assembles streamed tool call fragments: the first
+// fragment of a call brings its ID and name, later ones append arguments.
+func mergeToolCallDeltas(calls []models.ToolCall, deltas []models.ToolCallDelta) ([]models.ToolCall, error) {
+	for _, d := range deltas {
+		if d.Index < 0 || d.Index >= maxToolCalls {
+			return calls, fmt.Errorf("invalid tool call index %d in stream", d.Index)
+		}
+		for len(calls) <= d.Index {
+			calls = append(calls, models.ToolCall{Type: "function"})
+		}
+		call := &calls[d.Index]
+		if d.ID != "" {
+			call.ID = d.ID
+		}
+		if d.Type != "" {
+			call.Type = d.Type
+		}
+		if d.Function.Name != "" {
+			call.Function.Name = d.Function.Name
+		}
+		call.Function.Arguments += d.Function.Arguments
+	}
+	return calls, nil
+}
+
+// readSSE calls handle with the payload of every "data:" event until the
+// server sends "[DONE]". A stream that ends without it returns
+// errStreamCut.
+func readSSE(resp *http.Response, handle func(data string) error) error {
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		// Empty lines separate events, ":" lines are keep-alive comments
+		if line == "" || strings.HasPrefix(line, ":") {
+			continue
+		}
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			return nil
+		}
+		if err := handle(data); err != nil {
+			return err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return errStreamCut
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"telechatbot/internal/models"
+	"testing"
+)
+
+// sseServer streams events as "data:" lines, one per chunk.
+func sseServer(t *testing.T, events ...string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, ": keep-alive\n\n")
+		for _, e := range events {
+			fmt.Fprintf(w, "data: %s\n\n", e)
+			w.(http.Flusher).Flush()
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func streamChat(t *testing.T, srv *httptest.Server, req ChatRequest) (ChatResult, []StreamDelta, error) {
+	t.Helper()
+	c := NewOpenAIClient(srv.URL, NewKeyPool([]string{"key"}), "model-a")
+	if req.Messages == nil {
+		req.Messages = []models.GroqMessage{{Role: "user", Content: "hi"}}
+	}
+	var deltas []StreamDelta
+	res, err := c.Complete(context.Background(), req, func(d StreamDelta) { deltas = append(deltas, d) })
+	return res, deltas, err
+}
+
+func TestStreamContentAndReasoning(t *testing.T) {
+	srv := sseServer(t,
+		`{"model":"model-b","choices":[{"delta":{"role":"assistant","reasoning":"Thinking"}}]}`,
+		`{"choices":[{"delta":{"reasoning":" hard"}}]}`,
+		`{"choices":[{"delta":{"content":"Hello"}}]}`,
+		`{"choices":[{"delta":{"content":", world"},"finish_reason":"stop"}]}`,
+		`{"choices":[],"usage":{"prompt_tokens":12,"completion_tokens":5}}`,
+		`[DONE]`,
+	)
+	res, deltas, err := streamChat(t, srv, ChatRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Content != "Hello, world" || res.Reasoning != "Thinking hard" {
+		t.Errorf("got content %q reasoning %q", res.Content, res.Reasoning)
+	}
+	if res.Model != "model-b" || res.FinishReason != "stop" {
+		t.Errorf("got model %q finish %q", res.Model, res.FinishReason)
+	}
+	if res.Usage.PromptTokens != 12 || res.Usage.CompletionTokens != 5 {
+		t.Errorf("got usage %+v", res.Usage)
+	}
+	if len(deltas) != 4 || deltas[2].Content != "Hello" || deltas[0].Reasoning != "Thinking" {
+		t.Errorf("got deltas %+v", deltas)
+	}
+}
+
+func TestStreamToolCalls(t *testing.T) {
+	srv := sseServer(t,
+		`{"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_a","type":"function","function":{"name":"calculator","arguments":""}}]}}]}`,
+		`{"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"expression\":"}}]}}]}`,
+		`{"choices":[{"delta":{"tool_calls":[{"index":1,"id":"call_b","function":{"name":"clock","arguments":"{}"}}]}}]}`,
+		`{"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"1+1\"}"}}]},"finish_reason":"tool_calls"}]}`,
+		`[DONE]`,
+	)
+	res, deltas, err := streamChat(t, srv, ChatRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deltas) != 0 {
+		t.Errorf("tool call fragments reported as deltas: %+v", deltas)
+	}
+	want := []models.ToolCall{
+		{ID: "call_a", Type: "function", Function: models.ToolCallFunction{Name: "calculator", Arguments: `{"expression":"1+1"}`}},
+		{ID: "call_b", Type: "function", Function: models.ToolCallFunction{Name: "clock", Arguments: "{}"}},
+	}
+	if len(res.ToolCalls) != len(want) || res.ToolCalls[0] != want[0] || res.ToolCalls[1] != want[1] {
+		t.Errorf("got %+v", res.ToolCalls)
+	}
+}
+
+func TestStreamBadToolCallIndex(t *testing.T) {
+	for _, index := range []int{-1, maxToolCalls, 1 << 30} {
+		srv := sseServer(t,
+			fmt.Sprintf(`{"choices":[{"delta":{"tool_calls":[{"index":%d,"id":"x","function":{"name":"f"}}]}}]}`, index),
+			`[DONE]`,
+		)
+		if _, _, err := streamChat(t, srv, ChatRequest{}); err == nil || !strings.Contains(err.Error(), "invalid tool call index") {
+			t.Errorf("index %d: got error %v", index, err)
+		}
+	}
+}
+
+func TestStreamCutOff(t *testing.T) {
+	// The connection drops in the middle of the answer
+	srv := sseServer(t,
+		`{"choices":[{"delta":{"content":"The first half"}}]}`,
+	)
+	res, deltas, err := streamChat(t, srv, ChatRequest{})
+	if !errors.Is(err, errStreamCut) {
+		t.Errorf("got error %v, want errStreamCut", err)
+	}
+	if len(deltas) != 1 || res.Content != "The first half" {
+		t.Errorf("got %q after %d deltas", res.Content, len(deltas))
+	}
+
+	// A finish_reason without [DONE] is a complete answer
+	srv = sseServer(t,
+		`{"choices":[{"delta":{"content":"All of it"},"finish_reason":"stop"}]}`,
+	)
+	if res, _, err := streamChat(t, srv, ChatRequest{}); err != nil || res.Content != "All of it" {
+		t.Errorf("got %q, %v", res.Content, err)
+	}
+}
+
+func TestStreamErrorChunk(t *testing.T) {
+	srv := sseServer(t,
+		`{"choices":[{"delta":{"content":"partial"}}]}`,
+		`{"error":{"message":"overloaded"}}`,
+	)
+	if _, _, err := streamChat(t, srv, ChatRequest{}); err == nil || !strings.Contains(err.Error(), "overloaded") {
+		t.Errorf("got error %v", err)
+	}
+}
+
+func TestStreamNonSSEResponse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"model":"m","choices":[{"message":{"role":"assistant","content":"whole"},"finish_reason":"stop"}]}`)
+	}))
+	defer srv.Close()
+
+	res, deltas, err := streamChat(t, srv, ChatRequest{})
+	if err != nil || res.Content != "whole" || len(deltas) != 1 || deltas[0].Content != "whole" {
+		t.Errorf("got %q, %+v, %v", res.Content, deltas, err)
+	}
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"strings"
+	"telechatbot/internal/models"
+	"unicode"
+)
+
+// TokenEstimator approximates how many tokens a model's tokenizer produces.
+// It is intentionally cheap: the numbers are only used to decide how much
+// history fits in the prompt, so being a little pessimistic is fine.
+type TokenEstimator struct {
+	// CharsPerToken is the average for Latin-script text
+	CharsPerToken float64
+	// PerMessage is the chat template overhead (role markers etc.)
+	PerMessage int
+}
+
+// modelProfile holds what we know about a model family. Entries are matched
+// by substring of the lowercased model name, first match wins.
+type modelProfile struct {
+	match         string
+	contextWindow int
+	charsPerToken float64
+}
+
+var modelProfiles = []modelProfile{
+	{"qwen", 131072, 3.3},
+	{"llama-3", 131072, 3.8},
+	{"llama3", 131072, 3.8},
+	{"gemma", 8192, 3.8},
+	{"mixtral", 32768, 3.5},
+	{"deepseek", 131072, 3.5},
+	{"gpt-oss", 131072, 4.0},
+	{"gpt-4", 128000, 4.0},
+	{"gpt-3.5", 16385, 4.0},
+	{"claude", 200000, 3.5},
+}
+
+const (
+	defaultContextWindow = 8192
+	defaultCharsPerToken = 3.5
+	// imageTokens is a rough cost of one image part; providers tile images
+	// differently but most land around this for a phone screenshot
+	imageTokens = 1000
+)
+
+func profileFor(model string) (modelProfile, bool) {
+	model = strings.ToLower(model)
+	for _, p := range modelProfiles {
+		if strings.Contains(model, p.match) {
+			return p, true
+		}
+	}
+	return modelProfile{}, false
+}
+
+// EstimatorFor returns the estimator for model, or a conservative default
+// for unknown models.
+func EstimatorFor(model string) TokenEstimator {
+	e := TokenEstimator{CharsPerToken: defaultCharsPerToken, PerMessage: 4}
+	if p, ok := profileFor(model); ok {
+		e.CharsPerToken = p.charsPerToken
+	}
+	return e
+}
+
+// ContextWindow returns the context size of model in tokens.
+func ContextWindow(model string) int {
+	if p, ok := profileFor(model); ok {
+		return p.contextWindow
+	}
+	return defaultContextWindow
+}
+
+// MinContextWindow is the smallest context window of a model chain, so a
+// prompt built for it fits whichever model answers.
+func MinContextWindow(modelNames []string) int {
+	window := 0
+	for _, m := range modelNames {
+		if w := ContextWindow(m); window == 0 || w < window {
+			window = w
+		}
+	}
+	if window == 0 {
+		return defaultContextWindow
+	}
+	return window
+}
+
+// Count estimates the tokens in text. CJK and other wide characters are
+// usually a token each, everything else is averaged by CharsPerToken.
+func (e TokenEstimator) Count(text string) int {
+	cpt := e.CharsPerToken
+	if cpt <= 0 {
+		cpt = defaultCharsPerToken
+	}
+
+	narrow, wide := 0, 0
+	for _, r := range text {
+		if r > unicode.MaxLatin1 && (unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) ||
+			unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r) || r >= 0x1F000) {
+			wide++
+		} else {
+			narrow++
+		}
+	}
+	return wide + int(float64(narrow)/cpt+0.999)
+}
+
+// Message estimates one chat message including the template overhead.
+func (e TokenEstimator) Message(msg models.GroqMessage) int {
+	n := e.PerMessage + e.Count(msg.Role)
+	for _, c := range msg.ToolCalls {
+		n += e.Count(c.Function.Name) + e.Count(c.Function.Arguments)
+	}
+	if len(msg.Parts) == 0 {
+		return n + e.Count(msg.Content)
+	}
+	for _, p := range msg.Parts {
+		if p.ImageURL != nil {
+			n += imageTokens
+		} else {
+			n += e.Count(p.Text)
+		}
+	}
+	return n
+}
+
+// Messages estimates a whole prompt.
+func (e TokenEstimator) Messages(msgs []models.GroqMessage) int {
+	total := 0
+	for _, m := range msgs {
+		total += e.Message(m)
+	}
+	return total
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"strings"
+)
+
+// Transcriber turns recorded speech into text.
+type Transcriber interface {
+	// Transcribe returns the text spoken in audio. filename is only used
+	// by the server to detect the format (.ogg, .mp3, .mp4, ...).
+	Transcribe(ctx context.Context, filename string, audio []byte) (string, error)
+}
+
+var defaultTranscriptionModels = map[string]string{
+	"groq":   "whisper-large-v3-turbo",
+	"openai": "whisper-1",
+}
+
+// NewTranscriber builds a client for the OpenAI-compatible
+// /audio/transcriptions endpoint of provider name. model defaults to the
+// provider's Whisper model where one is known.
+func NewTranscriber(name, baseURL string, keys *KeyPool, model string) (Transcriber, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		name = "groq"
+	}
+	if model == "" {
+		model = defaultTranscriptionModels[name]
+	}
+	if model == "" {
+		return nil, fmt.Errorf("no default transcription model for provider %q (set TRANSCRIPTION_MODEL)", name)
+	}
+
+	provider, err := NewChatProvider(name, baseURL, keys, model)
+	if err != nil {
+		return nil, err
+	}
+	t, ok := provider.(Transcriber)
+	if !ok {
+		return nil, fmt.Errorf("provider %q does not support transcription", name)
+	}
+	return t, nil
+}
+
+type transcriptionResponse struct {
+	Text string `json:"text"`
+}
+
+// Transcribe implements Transcriber, using the key pool like SendChat.
+func (c *OpenAIClient) Transcribe(ctx context.Context, filename string, audio []byte) (string, error) {
+	var text string
+	err := c.withKeys(ctx, "Transcription", func(lease *KeyLease) error {
+		var err error
+		text, err = c.attemptTranscribe(ctx, lease, filename, audio)
+		return err
+	})
+	return text, err
+}
+
+func (c *OpenAIClient) attemptTranscribe(ctx context.Context, lease *KeyLease, filename string, audio []byte) (string, error) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+
+	w.WriteField("model", c.Model)
+	w.WriteField("response_format", "json")
+	part, err := w.CreateFormFile("file", filename)
+	if err != nil {
+		return "", err
+	}
+	if _, err := part.Write(audio); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+
+	resp, err := c.post(ctx, c.HttpClient, lease, "/audio/transcriptions", w.FormDataContentType(), "application/json", buf.Bytes())
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result transcriptionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(result.Text), nil
+}
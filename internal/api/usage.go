@@ -0,0 +1,30 @@
+package api
+
+import (
+	"context"
+	"time"
+)
+
+// Usage is the accounting of one completion request, passed to the
+// UsageHandler of the client that made it.
+type Usage struct {
+	Provider string
+	Model    string
+	// KeyIndex is the position of the key in the pool, -1 for servers
+	// without keys
+	KeyIndex         int
+	PromptTokens     int
+	CompletionTokens int
+	// ReasoningTokens are part of CompletionTokens
+	ReasoningTokens int
+	Latency         time.Duration
+}
+
+// UsageHandler is called after every successful completion request. ctx
+// is the request context, so callers can attach who the request was for.
+type UsageHandler func(ctx context.Context, u Usage)
+
+// UsageReporter is implemented by providers that report usage.
+type UsageReporter interface {
+	SetUsageHandler(h UsageHandler)
+}
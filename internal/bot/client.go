@@ -2,11 +2,16 @@ package bot
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
+	"mime/multipart"
 	"net/http"
+	"strconv"
+	"strings"
 	"telechatbot/internal/models"
+	"telechatbot/internal/render"
 	"time"
 )
 
@@ -14,176 +19,400 @@ type Client struct {
 	Token      string
 	HttpClient *http.Client
 	BaseURL    string
+	// FileURL is where files returned by getFile are downloaded from
+	FileURL string
+
+	// ParseMode is the Telegram parse mode text is rendered for, see
+	// render.ModeHTML and render.ModeMarkdownV2
+	ParseMode string
+
+	// MaxMessageLength is where SendMessage splits long text. Slightly
+	// below Telegram's 4096 to leave room for list bullets etc.
+	MaxMessageLength int
+	// DocumentThreshold sends longer text as a .md file; 0 disables it.
+	DocumentThreshold int
+
+	// MaxRetryWait is the longest retry_after a 429 is automatically
+	// retried for; longer waits are returned as errors.
+	MaxRetryWait time.Duration
+	// OnMigrate is called when a group turns out to be migrated to a
+	// supergroup, so stored per-chat data can be moved.
+	OnMigrate func(oldChatID, newChatID int64)
 }
 
+// maxRateLimitRetries bounds automatic 429 retries per request
+const maxRateLimitRetries = 3
+
+const defaultAPIURL = "https://api.telegram.org"
+
 func NewClient(token string) *Client {
+	return NewClientWithAPIURL(token, defaultAPIURL)
+}
+
+// NewClientWithAPIURL points the client to another Bot API server, e.g. a
+// self-hosted telegram-bot-api or a local fake server in tests.
+func NewClientWithAPIURL(token, apiURL string) *Client {
+	if apiURL == "" {
+		apiURL = defaultAPIURL
+	}
 	return &Client{
 		Token:      token,
-		HttpClient: &http.Client{Timeout: 30 * time.Second},
-		BaseURL:    fmt.Sprintf("https://api.telegram.org/bot%s", token),
+		HttpClient: &http.Client{Timeout: 75 * time.Second}, // > getUpdates long-poll timeout
+		BaseURL:    fmt.Sprintf("%s/bot%s", strings.TrimRight(apiURL, "/"), token),
+		FileURL:    fmt.Sprintf("%s/file/bot%s", strings.TrimRight(apiURL, "/"), token),
+
+		ParseMode:        render.ModeHTML,
+		MaxMessageLength: 4000,
+		MaxRetryWait:     30 * time.Second,
 	}
 }
 
-func (c *Client) GetUpdates(offset int) ([]models.Update, error) {
-	url := fmt.Sprintf("%s/getUpdates?offset=%d&timeout=60", c.BaseURL, offset)
-	resp, err := c.HttpClient.Get(url)
+// call posts payload as JSON to a Bot API method and decodes the "result"
+// field into result (which may be nil). API errors are returned as
+// *TelegramError; 429 responses are retried after retry_after seconds when
+// the wait is at most MaxRetryWait.
+func (c *Client) call(ctx context.Context, method string, payload interface{}, result interface{}) error {
+	body, err := json.Marshal(payload)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	return c.callRaw(ctx, method, "application/json", body, result)
+}
+
+// callRaw is call with an already encoded body, e.g. multipart uploads.
+func (c *Client) callRaw(ctx context.Context, method, contentType string, body []byte, result interface{}) error {
+	for attempt := 0; ; attempt++ {
+		err := c.do(ctx, method, contentType, body, result)
+
+		retryAfter, limited := IsTooManyRequests(err)
+		if !limited || attempt >= maxRateLimitRetries {
+			return err
+		}
+		wait := time.Duration(retryAfter) * time.Second
+		if wait > c.MaxRetryWait {
+			return err
+		}
+
+		log.Printf("[WARN] Telegram rate limit on %s, retrying in %s", method, wait)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (c *Client) do(ctx context.Context, method, contentType string, body []byte, result interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+"/"+method, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := c.HttpClient.Do(req)
+	if err != nil {
+		return err
 	}
 	defer resp.Body.Close()
 
-	var result models.TelegramResponse
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, err
+	var apiResp models.APIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
+		return fmt.Errorf("telegram %s: status %d, invalid response: %v", method, resp.StatusCode, err)
+	}
+
+	if !apiResp.Ok {
+		tgErr := &TelegramError{
+			Method:      method,
+			Code:        apiResp.ErrorCode,
+			Description: apiResp.Description,
+		}
+		if apiResp.Parameters != nil {
+			tgErr.RetryAfter = apiResp.Parameters.RetryAfter
+			tgErr.MigrateToChatID = apiResp.Parameters.MigrateToChatID
+		}
+		return tgErr
+	}
+
+	if result != nil && len(apiResp.Result) > 0 {
+		return json.Unmarshal(apiResp.Result, result)
+	}
+	return nil
+}
+
+// Render converts Markdown for the client's parse mode and returns the
+// text together with the parse_mode value to send with it.
+func (c *Client) Render(markdown string) (string, string) {
+	return render.Render(markdown, c.ParseMode), c.ParseMode
+}
+
+// migrated notifies OnMigrate that a group became a supergroup.
+func (c *Client) migrated(oldChatID, newChatID int64) {
+	log.Printf("[INFO] Chat %d migrated to supergroup %d", oldChatID, newChatID)
+	if c.OnMigrate != nil {
+		c.OnMigrate(oldChatID, newChatID)
 	}
+}
 
-	if !result.Ok {
-		return nil, fmt.Errorf("telegram api error: result not ok")
+// AllowedUpdates are the update types the bot handles. Telegram remembers
+// the list, so polling and the webhook must both send it.
+var AllowedUpdates = []string{"message", "callback_query", "inline_query", "chosen_inline_result", "my_chat_member"}
+
+// GetUpdates long-polls for updates. timeout is in seconds, 0 returns at once.
+func (c *Client) GetUpdates(ctx context.Context, offset, timeout int) ([]models.Update, error) {
+	reqBody := models.GetUpdatesRequest{
+		Offset:         offset,
+		Timeout:        timeout,
+		AllowedUpdates: AllowedUpdates,
 	}
 
-	return result.Result, nil
+	var updates []models.Update
+	if err := c.call(ctx, "getUpdates", reqBody, &updates); err != nil {
+		return nil, err
+	}
+	return updates, nil
 }
 
-func (c *Client) SendChatAction(chatID int64, threadID int, action string) error {
+func (c *Client) SendChatAction(ctx context.Context, chatID int64, threadID int, action string) error {
 	reqBody := models.SendChatActionRequest{
 		ChatID:          chatID,
 		MessageThreadID: threadID,
 		Action:          action,
 	}
 
-	body, err := json.Marshal(reqBody)
-	if err != nil {
-		return err
-	}
-
-	url := fmt.Sprintf("%s/sendChatAction", c.BaseURL)
-	_, err = c.HttpClient.Post(url, "application/json", bytes.NewBuffer(body))
-	return err
+	return c.call(ctx, "sendChatAction", reqBody, nil)
 }
 
-func (c *Client) SendMessageDraft(chatID int64, threadID int, replyToMsgID int, draftID, text string) error {
+// SendMessageDraft shows (or updates) a draft bubble. Calling it again with
+// the same draftID replaces the text. text is Markdown, see Render.
+func (c *Client) SendMessageDraft(ctx context.Context, chatID int64, threadID int, replyToMsgID int, draftID, text string) error {
+	rendered, parseMode := c.Render(text)
 	reqBody := models.SendMessageDraftRequest{
-		ChatID:          chatID,
-		MessageThreadID: threadID,
-		DraftID:         draftID,
-		Text:            text,
-		ParseMode:       "Markdown",
-		ReplyToMessageID: replyToMsgID, 
+		ChatID:           chatID,
+		MessageThreadID:  threadID,
+		DraftID:          draftID,
+		Text:             rendered,
+		ParseMode:        parseMode,
+		ReplyToMessageID: replyToMsgID,
 	}
 
-	body, err := json.Marshal(reqBody)
-	if err != nil {
-		return err
+	err := c.call(ctx, "sendMessageDraft", reqBody, nil)
+	if IsCantParseEntities(err) {
+		reqBody.Text, reqBody.ParseMode = render.ToPlain(text), ""
+		err = c.call(ctx, "sendMessageDraft", reqBody, nil)
 	}
+	return err
+}
 
-	url := fmt.Sprintf("%s/sendMessageDraft", c.BaseURL)
-	resp, err := c.HttpClient.Post(url, "application/json", bytes.NewBuffer(body))
-	if err != nil {
-		return err
+// SendMessage sends a Markdown message and returns the ID of the last
+// message sent. Text longer than MaxMessageLength is split into a chain of
+// replies with replyMarkup only on the last part; text longer than
+// DocumentThreshold (if set) is sent as a .md file instead.
+func (c *Client) SendMessage(ctx context.Context, chatID int64, threadID int, replyToMsgID int, text string, replyMarkup interface{}) (int, error) {
+	if c.DocumentThreshold > 0 && utf16Len(text) > c.DocumentThreshold {
+		return c.SendDocument(ctx, chatID, threadID, replyToMsgID, "response.md", []byte(text), documentCaption(text), replyMarkup)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("draft status: %d", resp.StatusCode)
+	parts := SplitMarkdown(text, c.MaxMessageLength)
+	lastID := 0
+	for i, part := range parts {
+		var markup interface{}
+		if i == len(parts)-1 {
+			markup = replyMarkup
+		}
+
+		id, err := c.sendMessagePart(ctx, &chatID, threadID, replyToMsgID, part, markup)
+		if err != nil {
+			return lastID, err
+		}
+		// Next part replies to this one so the parts stay together
+		lastID, replyToMsgID = id, id
 	}
-	return nil
+
+	return lastID, nil
 }
 
-func (c *Client) SendMessage(chatID int64, threadID int, replyToMsgID int, text string, replyMarkup interface{}) error {
+// sendMessagePart sends one message that fits the length limit. The text is
+// rendered for ParseMode; if Telegram still rejects the entities it is
+// resent as plain text. chatID is updated if the group was migrated.
+func (c *Client) sendMessagePart(ctx context.Context, chatID *int64, threadID int, replyToMsgID int, text string, replyMarkup interface{}) (int, error) {
+	rendered, parseMode := c.Render(text)
 	reqBody := models.SendMessageRequest{
-		ChatID:          chatID,
-		MessageThreadID: threadID,
-		Text:            text,
-		ParseMode:       "Markdown", 
-		ReplyToMessageID: replyToMsgID, 
-		ReplyMarkup:     replyMarkup,
+		ChatID:           *chatID,
+		MessageThreadID:  threadID,
+		Text:             rendered,
+		ParseMode:        parseMode,
+		ReplyToMessageID: replyToMsgID,
+		ReplyMarkup:      replyMarkup,
 	}
 
-	body, err := json.Marshal(reqBody)
+	var sent models.Message
+	err := c.call(ctx, "sendMessage", reqBody, &sent)
+	if newChatID, ok := MigratedTo(err); ok {
+		// Grup di-upgrade jadi supergroup, kirim ulang ke chat ID yang baru
+		c.migrated(*chatID, newChatID)
+		*chatID = newChatID
+		reqBody.ChatID = newChatID
+		reqBody.ReplyToMessageID = 0 // old message IDs are not valid there
+		err = c.call(ctx, "sendMessage", reqBody, &sent)
+	}
+	if IsCantParseEntities(err) {
+		log.Printf("Formatted send failed, sending plain text: %v", err)
+		reqBody.Text, reqBody.ParseMode = render.ToPlain(text), ""
+		err = c.call(ctx, "sendMessage", reqBody, &sent)
+	}
 	if err != nil {
-		return err
+		log.Printf("Failed to send message: %v", err)
+		return 0, err
 	}
 
-	url := fmt.Sprintf("%s/sendMessage", c.BaseURL)
-	resp, err := c.HttpClient.Post(url, "application/json", bytes.NewBuffer(body))
+	return sent.MessageID, nil
+}
+
+// SendsAsDocument reports whether SendMessage would send text as a file.
+func (c *Client) SendsAsDocument(text string) bool {
+	return c.DocumentThreshold > 0 && utf16Len(text) > c.DocumentThreshold
+}
+
+// SendDocument uploads data as a file and returns the new message ID.
+// caption is plain text.
+func (c *Client) SendDocument(ctx context.Context, chatID int64, threadID int, replyToMsgID int, filename string, data []byte, caption string, replyMarkup interface{}) (int, error) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+
+	w.WriteField("chat_id", strconv.FormatInt(chatID, 10))
+	if threadID != 0 {
+		w.WriteField("message_thread_id", strconv.Itoa(threadID))
+	}
+	if replyToMsgID != 0 {
+		w.WriteField("reply_to_message_id", strconv.Itoa(replyToMsgID))
+	}
+	if caption != "" {
+		w.WriteField("caption", caption)
+	}
+	if replyMarkup != nil {
+		markup, err := json.Marshal(replyMarkup)
+		if err != nil {
+			return 0, err
+		}
+		w.WriteField("reply_markup", string(markup))
+	}
+
+	part, err := w.CreateFormFile("document", filename)
 	if err != nil {
-		return err
+		return 0, err
+	}
+	if _, err := part.Write(data); err != nil {
+		return 0, err
+	}
+	if err := w.Close(); err != nil {
+		return 0, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("Failed to send message, status: %d", resp.StatusCode)
-		return fmt.Errorf("failed to send message, status: %d", resp.StatusCode)
+	var sent models.Message
+	if err := c.callRaw(ctx, "sendDocument", w.FormDataContentType(), buf.Bytes(), &sent); err != nil {
+		log.Printf("Failed to send document: %v", err)
+		return 0, err
 	}
+	return sent.MessageID, nil
+}
 
-	return nil
+// documentCaption uses the first line of the text, without markup.
+func documentCaption(text string) string {
+	first := strings.TrimSpace(strings.SplitN(strings.TrimSpace(text), "\n", 2)[0])
+	first = strings.TrimSpace(render.ToPlain(first))
+	if r := []rune(first); len(r) > 200 {
+		first = string(r[:200]) + "…"
+	}
+	return "📄 " + first
 }
 
-func (c *Client) EditForumTopic(chatID int64, threadID int, name string) error {
+func (c *Client) EditForumTopic(ctx context.Context, chatID int64, threadID int, name string) error {
 	reqBody := models.EditForumTopicRequest{
 		ChatID:          chatID,
 		MessageThreadID: threadID,
 		Name:            name,
 	}
 
-	body, err := json.Marshal(reqBody)
-	if err != nil {
+	if err := c.call(ctx, "editForumTopic", reqBody, nil); err != nil {
+		log.Printf("Failed to edit topic: %v", err)
 		return err
 	}
+	return nil
+}
 
-	url := fmt.Sprintf("%s/editForumTopic", c.BaseURL)
-	resp, err := c.HttpClient.Post(url, "application/json", bytes.NewBuffer(body))
-	if err != nil {
-		return err
+// GetChatMember returns the membership of userID in chatID.
+func (c *Client) GetChatMember(ctx context.Context, chatID, userID int64) (*models.ChatMember, error) {
+	reqBody := models.GetChatMemberRequest{ChatID: chatID, UserID: userID}
+
+	var member models.ChatMember
+	if err := c.call(ctx, "getChatMember", reqBody, &member); err != nil {
+		return nil, err
 	}
-	defer resp.Body.Close()
+	return &member, nil
+}
+
+// LeaveChat makes the bot leave a group or channel.
+func (c *Client) LeaveChat(ctx context.Context, chatID int64) error {
+	reqBody := models.LeaveChatRequest{ChatID: chatID}
+	return c.call(ctx, "leaveChat", reqBody, nil)
+}
 
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("Failed to edit topic, status: %d", resp.StatusCode)
-		return fmt.Errorf("failed to edit topic, status: %d", resp.StatusCode)
+// SetMyCommands sets the command menu of a scope and language ("" for
+// users without a list in their language).
+func (c *Client) SetMyCommands(ctx context.Context, commands []models.BotCommand, scope models.BotCommandScope, languageCode string) error {
+	reqBody := models.MyCommandsRequest{Commands: commands, Scope: &scope, LanguageCode: languageCode}
+	return c.call(ctx, "setMyCommands", reqBody, nil)
+}
+
+// GetMyCommands returns the command menu of exactly this scope and
+// language, empty when none is set.
+func (c *Client) GetMyCommands(ctx context.Context, scope models.BotCommandScope, languageCode string) ([]models.BotCommand, error) {
+	reqBody := models.MyCommandsRequest{Scope: &scope, LanguageCode: languageCode}
+
+	var commands []models.BotCommand
+	if err := c.call(ctx, "getMyCommands", reqBody, &commands); err != nil {
+		return nil, err
 	}
+	return commands, nil
+}
 
-	return nil
+// DeleteMyCommands removes the command menu of a scope and language, so a
+// broader one applies again.
+func (c *Client) DeleteMyCommands(ctx context.Context, scope models.BotCommandScope, languageCode string) error {
+	reqBody := models.MyCommandsRequest{Scope: &scope, LanguageCode: languageCode}
+	return c.call(ctx, "deleteMyCommands", reqBody, nil)
 }
 
-func (c *Client) AnswerCallbackQuery(callbackID string) {
-	url := fmt.Sprintf("%s/answerCallbackQuery?callback_query_id=%s", c.BaseURL, callbackID)
-	c.HttpClient.Get(url)
+func (c *Client) AnswerCallbackQuery(ctx context.Context, callbackID string) {
+	reqBody := models.AnswerCallbackQueryRequest{CallbackQueryID: callbackID}
+	if err := c.call(ctx, "answerCallbackQuery", reqBody, nil); err != nil {
+		log.Printf("Failed to answer callback query: %v", err)
+	}
 }
 
-func (c *Client) AnswerInlineQuery(queryID string, results []models.InlineQueryResult) error {
+func (c *Client) AnswerInlineQuery(ctx context.Context, queryID string, results []models.InlineQueryResult) error {
 	reqBody := models.AnswerInlineQueryRequest{
 		InlineQueryID: queryID,
 		Results:       results,
 		CacheTime:     0, // Set 0 agar development mudah, naikkan ke 300 nanti
 	}
 
-	body, err := json.Marshal(reqBody)
-	if err != nil {
+	if err := c.call(ctx, "answerInlineQuery", reqBody, nil); err != nil {
+		log.Printf("Failed to answer inline query: %v", err)
 		return err
 	}
-
-	url := fmt.Sprintf("%s/answerInlineQuery", c.BaseURL)
-	resp, err := c.HttpClient.Post(url, "application/json", bytes.NewBuffer(body))
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("Failed to answer inline query, status: %d", resp.StatusCode)
-		return fmt.Errorf("failed status: %d", resp.StatusCode)
-	}
 	return nil
 }
 
 // Update fungsi EditMessageText agar bisa pakai InlineMessageID
-func (c *Client) EditMessageText(chatID int64, messageID int, inlineMessageID string, text string) error {
+// text is Markdown, see SendMessage. A nil replyMarkup removes the keyboard.
+func (c *Client) EditMessageText(ctx context.Context, chatID int64, messageID int, inlineMessageID string, text string, replyMarkup *models.InlineKeyboardMarkup) error {
 	// Logic: Jika inlineMessageID ada, chatID dan messageID akan otomatis diabaikan oleh JSON omitempty
+	rendered, parseMode := c.Render(text)
 	reqBody := models.EditMessageTextRequest{
-		Text:        text,
-		ParseMode:   "Markdown",
-		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{}},
+		Text:        rendered,
+		ParseMode:   parseMode,
+		ReplyMarkup: replyMarkup,
 	}
 
 	if inlineMessageID != "" {
@@ -193,22 +422,11 @@ func (c *Client) EditMessageText(chatID int64, messageID int, inlineMessageID st
 		reqBody.MessageID = messageID
 	}
 
-	body, err := json.Marshal(reqBody)
-	if err != nil {
-		return err
-	}
-
-	url := fmt.Sprintf("%s/editMessageText", c.BaseURL)
-	resp, err := c.HttpClient.Post(url, "application/json", bytes.NewBuffer(body))
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	// Abaikan error "message is not modified" atau error minor lainnya
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("status: %d", resp.StatusCode)
+	err := c.call(ctx, "editMessageText", reqBody, nil)
+	if IsCantParseEntities(err) {
+		reqBody.Text, reqBody.ParseMode = render.ToPlain(text), ""
+		err = c.call(ctx, "editMessageText", reqBody, nil)
 	}
-
-	return nil
-}
\ No newline at end of file
+	// Caller decides what to ignore, e.g. IsMessageNotModified
+	return err
+}
@@ -0,0 +1,182 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"telechatbot/internal/models"
+	"testing"
+	"time"
+)
+
+// apiCall is one request seen by scriptedTelegram.
+type apiCall struct {
+	Method string
+	Body   map[string]interface{}
+}
+
+// scriptedTelegram answers requests with responses in order, repeating the
+// last one once the script runs out. Each response is "status body".
+func scriptedTelegram(t *testing.T, responses ...string) (*Client, func() []apiCall) {
+	t.Helper()
+	var mu sync.Mutex
+	var calls []apiCall
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+
+		mu.Lock()
+		calls = append(calls, apiCall{strings.TrimPrefix(r.URL.Path, "/botTOKEN/"), body})
+		resp := responses[min(len(calls), len(responses))-1]
+		mu.Unlock()
+
+		status, payload, _ := strings.Cut(resp, " ")
+		code, _ := strconv.Atoi(status)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		w.Write([]byte(payload))
+	}))
+	t.Cleanup(srv.Close)
+	return NewClientWithAPIURL("TOKEN", srv.URL), func() []apiCall {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]apiCall(nil), calls...)
+	}
+}
+
+func TestCallEnvelope(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     *TelegramError
+		check    func(error) bool
+		result   int
+	}{
+		{
+			name:     "result",
+			response: `200 {"ok":true,"result":{"message_id":42}}`,
+			result:   42,
+		},
+		{
+			name:     "error",
+			response: `400 {"ok":false,"error_code":400,"description":"Bad Request: message is not modified"}`,
+			want:     &TelegramError{Method: "sendMessage", Code: 400, Description: "Bad Request: message is not modified"},
+			check:    IsMessageNotModified,
+		},
+		{
+			name:     "blocked",
+			response: `403 {"ok":false,"error_code":403,"description":"Forbidden: bot was blocked by the user"}`,
+			want:     &TelegramError{Method: "sendMessage", Code: 403, Description: "Forbidden: bot was blocked by the user"},
+			check:    IsBotBlocked,
+		},
+		{
+			name:     "parameters",
+			response: `400 {"ok":false,"error_code":400,"description":"Bad Request: group chat was upgraded to a supergroup chat","parameters":{"migrate_to_chat_id":-1002}}`,
+			want:     &TelegramError{Method: "sendMessage", Code: 400, Description: "Bad Request: group chat was upgraded to a supergroup chat", MigrateToChatID: -1002},
+			check:    func(err error) bool { id, ok := MigratedTo(err); return ok && id == -1002 },
+		},
+		{
+			name:     "not JSON",
+			response: `502 <html>Bad Gateway</html>`,
+			check: func(err error) bool {
+				return err != nil && strings.Contains(err.Error(), "status 502, invalid response")
+			},
+		},
+	}
+	for _, tt := range tests {
+		c, _ := scriptedTelegram(t, tt.response)
+		var sent models.Message
+		err := c.call(context.Background(), "sendMessage", map[string]interface{}{"chat_id": 1}, &sent)
+
+		var tgErr *TelegramError
+		switch {
+		case tt.want == nil && tt.check == nil:
+			if err != nil || sent.MessageID != tt.result {
+				t.Errorf("%s: got %+v, %v", tt.name, sent, err)
+			}
+		case tt.want != nil && (!errors.As(err, &tgErr) || *tgErr != *tt.want):
+			t.Errorf("%s: got error %#v, want %#v", tt.name, err, tt.want)
+		}
+		if tt.check != nil && !tt.check(err) {
+			t.Errorf("%s: check failed for %v", tt.name, err)
+		}
+	}
+}
+
+func TestCallHonoursRetryAfter(t *testing.T) {
+	const limited = `429 {"ok":false,"error_code":429,"description":"Too Many Requests: retry after 1","parameters":{"retry_after":1}}`
+
+	// Retried once the wait is over
+	c, calls := scriptedTelegram(t, limited, `200 {"ok":true,"result":true}`)
+	start := time.Now()
+	if err := c.call(context.Background(), "sendChatAction", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(calls()); n != 2 {
+		t.Errorf("%d requests, want 2", n)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %s, want at least 1s", elapsed)
+	}
+
+	// Waits longer than MaxRetryWait are returned at once
+	c, calls = scriptedTelegram(t, `429 {"ok":false,"error_code":429,"description":"Too Many Requests: retry after 60","parameters":{"retry_after":60}}`)
+	err := c.call(context.Background(), "sendChatAction", nil, nil)
+	if wait, ok := IsTooManyRequests(err); !ok || wait != 60 {
+		t.Errorf("got %v", err)
+	}
+	if n := len(calls()); n != 1 {
+		t.Errorf("%d requests, want 1", n)
+	}
+
+	// Retries are bounded
+	c, calls = scriptedTelegram(t, `429 {"ok":false,"error_code":429,"description":"Too Many Requests","parameters":{"retry_after":0}}`)
+	if _, ok := IsTooManyRequests(c.call(context.Background(), "sendChatAction", nil, nil)); !ok {
+		t.Error("endless 429s did not fail")
+	}
+	if n := len(calls()); n != maxRateLimitRetries+1 {
+		t.Errorf("%d requests, want %d", n, maxRateLimitRetries+1)
+	}
+
+	// Cancelling the context stops the wait
+	c, _ = scriptedTelegram(t, limited)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := c.call(ctx, "sendChatAction", nil, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want the context error", err)
+	}
+}
+
+func TestSendMessageFollowsMigration(t *testing.T) {
+	c, calls := scriptedTelegram(t,
+		`400 {"ok":false,"error_code":400,"description":"Bad Request: group chat was upgraded to a supergroup chat","parameters":{"migrate_to_chat_id":-1002}}`,
+		`200 {"ok":true,"result":{"message_id":7}}`,
+	)
+	var migrated [2]int64
+	c.OnMigrate = func(oldChatID, newChatID int64) { migrated = [2]int64{oldChatID, newChatID} }
+
+	id, err := c.SendMessage(context.Background(), -1, 0, 5, "hello", nil)
+	if err != nil || id != 7 {
+		t.Fatalf("got %d, %v", id, err)
+	}
+	if migrated != [2]int64{-1, -1002} {
+		t.Errorf("OnMigrate got %v", migrated)
+	}
+
+	got := calls()
+	if len(got) != 2 {
+		t.Fatalf("%d requests, want 2", len(got))
+	}
+	if got[0].Body["chat_id"] != float64(-1) || got[1].Body["chat_id"] != float64(-1002) {
+		t.Errorf("sent to %v then %v", got[0].Body["chat_id"], got[1].Body["chat_id"])
+	}
+	// The message replied to lives in the old chat
+	if _, ok := got[1].Body["reply_to_message_id"]; ok {
+		t.Errorf("resend still replies: %v", got[1].Body)
+	}
+}
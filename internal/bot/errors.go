@@ -0,0 +1,86 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// TelegramError is an error returned by the Bot API in its
+// {"ok": false, "error_code": ..., "description": ...} envelope.
+type TelegramError struct {
+	Method          string
+	Code            int
+	Description     string
+	RetryAfter      int   // seconds, set on 429 Too Many Requests
+	MigrateToChatID int64 // set when a group was upgraded to a supergroup
+}
+
+func (e *TelegramError) Error() string {
+	return fmt.Sprintf("telegram %s error %d: %s", e.Method, e.Code, e.Description)
+}
+
+func asTelegramError(err error) (*TelegramError, bool) {
+	var tgErr *TelegramError
+	if errors.As(err, &tgErr) {
+		return tgErr, true
+	}
+	return nil, false
+}
+
+func descriptionContains(err error, code int, parts ...string) bool {
+	tgErr, ok := asTelegramError(err)
+	if !ok || (code != 0 && tgErr.Code != code) {
+		return false
+	}
+	desc := strings.ToLower(tgErr.Description)
+	for _, p := range parts {
+		if strings.Contains(desc, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsMessageNotModified reports an edit with exactly the same text/markup.
+// It is harmless and usually ignored.
+func IsMessageNotModified(err error) bool {
+	return descriptionContains(err, 400, "message is not modified")
+}
+
+// IsCantParseEntities reports a Markdown/HTML formatting error in the text.
+func IsCantParseEntities(err error) bool {
+	return descriptionContains(err, 400, "can't parse entities", "can't find end of")
+}
+
+// IsMessageToEditNotFound reports an edit of a deleted message.
+func IsMessageToEditNotFound(err error) bool {
+	return descriptionContains(err, 400, "message to edit not found")
+}
+
+// IsBotBlocked reports that the bot can no longer write to the chat: the
+// user blocked it, deleted their account, or the bot was removed from the
+// group.
+func IsBotBlocked(err error) bool {
+	return descriptionContains(err, 403, "bot was blocked", "user is deactivated", "bot was kicked", "not a member", "bot can't initiate")
+}
+
+// IsTooManyRequests reports a 429 error that was not retried (because the
+// wait was too long) and returns the wait in seconds.
+func IsTooManyRequests(err error) (int, bool) {
+	tgErr, ok := asTelegramError(err)
+	if !ok || tgErr.Code != 429 {
+		return 0, false
+	}
+	return tgErr.RetryAfter, true
+}
+
+// MigratedTo returns the new supergroup chat ID if err says the group was
+// migrated.
+func MigratedTo(err error) (int64, bool) {
+	tgErr, ok := asTelegramError(err)
+	if !ok || tgErr.MigrateToChatID == 0 {
+		return 0, false
+	}
+	return tgErr.MigrateToChatID, true
+}
@@ -0,0 +1,66 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"telechatbot/internal/models"
+)
+
+// MaxDownloadSize is the largest file the Bot API lets bots download.
+const MaxDownloadSize = 20 << 20
+
+// GetFile prepares a file for download and returns its file_path.
+func (c *Client) GetFile(ctx context.Context, fileID string) (*models.File, error) {
+	var file models.File
+	if err := c.call(ctx, "getFile", models.GetFileRequest{FileID: fileID}, &file); err != nil {
+		return nil, err
+	}
+	if file.FilePath == "" {
+		return nil, fmt.Errorf("telegram getFile returned no file_path for %s", fileID)
+	}
+	return &file, nil
+}
+
+// DownloadFile fetches a file returned by GetFile. Files larger than
+// maxBytes (or MaxDownloadSize if maxBytes is 0) are rejected.
+func (c *Client) DownloadFile(ctx context.Context, file *models.File, maxBytes int64) ([]byte, error) {
+	if maxBytes <= 0 {
+		maxBytes = MaxDownloadSize
+	}
+	if file.FileSize > maxBytes {
+		return nil, fmt.Errorf("file is %d bytes, limit is %d", file.FileSize, maxBytes)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.FileURL+"/"+strings.TrimLeft(file.FilePath, "/"), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.HttpClient.Do(req)
+	if err != nil {
+		// *url.Error includes the URL, which contains the bot token
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, fmt.Errorf("telegram file download failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("telegram file download failed with status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, fmt.Errorf("file is larger than %d bytes", maxBytes)
+	}
+	return data, nil
+}
@@ -0,0 +1,246 @@
+package bot
+
+import (
+	"regexp"
+	"strings"
+	"telechatbot/internal/render"
+	"unicode/utf8"
+)
+
+// telegramMaxLength is the Bot API limit for message text after entity
+// parsing, counted in UTF-16 code units.
+const telegramMaxLength = 4096
+
+var reFenceLine = regexp.MustCompile("^\\s*(```+|~~~+)(.*)$")
+
+// SplitMarkdown splits md into parts whose visible text is at most limit
+// UTF-16 units. It cuts between paragraphs and code blocks where possible;
+// an oversized code block is split by lines and every piece gets its own
+// fence, so formatting stays valid in every part.
+func SplitMarkdown(md string, limit int) []string {
+	if limit <= 0 || limit > telegramMaxLength {
+		limit = telegramMaxLength
+	}
+	if visibleLength(md) <= limit {
+		return []string{md}
+	}
+
+	var parts []string
+	current := ""
+	for _, seg := range splitSegments(md, limit) {
+		candidate := seg
+		if current != "" {
+			candidate = current + "\n\n" + seg
+		}
+		if visibleLength(candidate) <= limit {
+			current = candidate
+			continue
+		}
+		if current != "" {
+			parts = append(parts, current)
+		}
+		current = seg
+	}
+	if current != "" {
+		parts = append(parts, current)
+	}
+	return parts
+}
+
+// splitSegments cuts md into paragraphs and fenced code blocks, each of
+// which fits in limit on its own.
+func splitSegments(md string, limit int) []string {
+	lines := strings.Split(strings.ReplaceAll(md, "\r\n", "\n"), "\n")
+
+	var segments []string
+	var para []string
+	flushPara := func() {
+		if len(para) > 0 {
+			segments = append(segments, splitInline(strings.Join(para, "\n"), limit)...)
+			para = nil
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		m := reFenceLine.FindStringSubmatch(lines[i])
+		if m == nil {
+			if strings.TrimSpace(lines[i]) == "" {
+				flushPara()
+			} else {
+				para = append(para, lines[i])
+			}
+			continue
+		}
+
+		flushPara()
+		fence, header := m[1], strings.TrimSpace(lines[i])
+		var code []string
+		for i++; i < len(lines); i++ {
+			trimmed := strings.TrimSpace(lines[i])
+			if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+				break
+			}
+			code = append(code, lines[i])
+		}
+		segments = append(segments, splitCodeBlock(header, fence, code, limit)...)
+	}
+	flushPara()
+
+	return segments
+}
+
+func splitCodeBlock(header, fence string, code []string, limit int) []string {
+	wrap := func(lines []string) string {
+		return header + "\n" + strings.Join(lines, "\n") + "\n" + fence
+	}
+
+	var blocks []string
+	var current []string
+	for _, line := range code {
+		// A single line longer than the limit is hard-wrapped
+		for _, piece := range hardSplit(line, limit-visibleLength(wrap(nil))) {
+			if len(current) > 0 && visibleLength(wrap(append(current, piece))) > limit {
+				blocks = append(blocks, wrap(current))
+				current = nil
+			}
+			current = append(current, piece)
+		}
+	}
+	if len(current) > 0 || len(blocks) == 0 {
+		blocks = append(blocks, wrap(current))
+	}
+	return blocks
+}
+
+// splitInline splits a paragraph like splitParagraph and closes the bold,
+// italic, code and link spans open at every cut, reopening them in the
+// next piece, since each part is rendered on its own. The markers can push
+// a piece over limit (link URLs count in plain text), so the paragraph is
+// split again with less room until everything fits.
+func splitInline(text string, limit int) []string {
+	room := limit
+	for {
+		pieces := closeSpans(text, splitParagraph(text, room))
+		over := 0
+		for _, p := range pieces {
+			if n := visibleLength(p) - limit; n > over {
+				over = n
+			}
+		}
+		if over == 0 || room-over < limit/2 {
+			return pieces
+		}
+		room -= over
+	}
+}
+
+// closeSpans adds the markers of the spans cut between consecutive pieces
+// of text: closers at the end of a piece, openers at the start of the next.
+func closeSpans(text string, pieces []string) []string {
+	out := make([]string, len(pieces))
+	pos := 0
+	reopen := ""
+	for i, p := range pieces {
+		start := strings.Index(text[pos:], p)
+		if start < 0 {
+			// Not a substring after all; leave the pieces alone
+			return pieces
+		}
+		pos += start + len(p)
+
+		out[i] = reopen + p
+		reopen = ""
+		if i == len(pieces)-1 {
+			break
+		}
+		open, close := render.SpansAt(text, pos)
+		for j := len(close) - 1; j >= 0; j-- {
+			out[i] += close[j]
+		}
+		reopen = strings.Join(open, "")
+	}
+	return out
+}
+
+// splitParagraph cuts a too long paragraph at line, sentence or word
+// boundaries, in that order of preference.
+func splitParagraph(text string, limit int) []string {
+	if visibleLength(text) <= limit {
+		return []string{text}
+	}
+
+	for _, sep := range []string{"\n", ". ", " "} {
+		pieces := strings.SplitAfter(text, sep)
+		if len(pieces) < 2 {
+			continue
+		}
+
+		var out []string
+		current := ""
+		for _, p := range pieces {
+			if current != "" && visibleLength(current+p) > limit {
+				out = append(out, strings.TrimSpace(current))
+				current = ""
+			}
+			current += p
+		}
+		if strings.TrimSpace(current) != "" {
+			out = append(out, strings.TrimSpace(current))
+		}
+
+		var result []string
+		for _, o := range out {
+			result = append(result, splitParagraph(o, limit)...)
+		}
+		return result
+	}
+
+	return hardSplit(text, limit)
+}
+
+// hardSplit cuts s into pieces of at most n UTF-16 units when there is no
+// better boundary. Characters outside the BMP (most emoji) count twice and
+// are never cut in half.
+func hardSplit(s string, n int) []string {
+	if n < 2 {
+		n = 2
+	}
+	if utf16Len(s) <= n {
+		return []string{s}
+	}
+	var out []string
+	start, units := 0, 0
+	for i, r := range s {
+		w := 1
+		if r >= 0x10000 {
+			w = 2
+		}
+		if units+w > n {
+			out = append(out, s[start:i])
+			start, units = i, 0
+		}
+		units += w
+	}
+	return append(out, s[start:])
+}
+
+// visibleLength is the length Telegram checks: the text without markup,
+// in UTF-16 code units.
+func visibleLength(md string) int {
+	return utf16Len(render.ToPlain(md))
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	if !utf8.ValidString(s) {
+		return len(s)
+	}
+	return n
+}
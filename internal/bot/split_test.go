@@ -0,0 +1,148 @@
+package bot
+
+import (
+	"strings"
+	"telechatbot/internal/render"
+	"testing"
+)
+
+func TestSplitMarkdownShort(t *testing.T) {
+	parts := SplitMarkdown("**Hello** world", 100)
+	if len(parts) != 1 || parts[0] != "**Hello** world" {
+		t.Errorf("got %q", parts)
+	}
+}
+
+func TestSplitMarkdownParagraphs(t *testing.T) {
+	md := strings.Repeat("a", 30) + "\n\n" + strings.Repeat("b", 30) + "\n\n" + strings.Repeat("c", 30)
+	parts := SplitMarkdown(md, 70)
+	if len(parts) != 2 {
+		t.Fatalf("got %d parts: %q", len(parts), parts)
+	}
+	if parts[0] != strings.Repeat("a", 30)+"\n\n"+strings.Repeat("b", 30) || parts[1] != strings.Repeat("c", 30) {
+		t.Errorf("got %q", parts)
+	}
+}
+
+func TestSplitMarkdownRewrapsFences(t *testing.T) {
+	var lines []string
+	for i := 0; i < 40; i++ {
+		lines = append(lines, "fmt.Println(\"line\")")
+	}
+	md := "Intro\n\n```go\n" + strings.Join(lines, "\n") + "\n```\n\nOutro"
+
+	parts := SplitMarkdown(md, 200)
+	if len(parts) < 3 {
+		t.Fatalf("got %d parts, want the code block split", len(parts))
+	}
+	code := 0
+	for _, p := range parts {
+		if n := visibleLength(p); n > 200 {
+			t.Errorf("part of %d units exceeds the limit: %q", n, p)
+		}
+		if !strings.Contains(p, "fmt.Println") {
+			continue
+		}
+		code++
+		// Every piece of the block is a complete block of its own, with
+		// the language tag kept
+		block := strings.TrimSuffix(strings.TrimPrefix(p, "Intro\n\n"), "\n\nOutro")
+		if !strings.HasPrefix(block, "```go\n") || !strings.HasSuffix(block, "\n```") {
+			t.Errorf("piece is not fenced: %q", p)
+		}
+	}
+	if code < 2 {
+		t.Errorf("code block in %d parts, want several", code)
+	}
+	if got := strings.Count(strings.Join(parts, "\n"), "fmt.Println"); got != 40 {
+		t.Errorf("%d code lines after splitting, want 40", got)
+	}
+}
+
+func TestSplitMarkdownUTF16Limit(t *testing.T) {
+	// Each emoji is one rune but two UTF-16 units
+	md := strings.Repeat("😀", 150)
+	parts := SplitMarkdown(md, 100)
+	if len(parts) != 3 {
+		t.Fatalf("got %d parts, want 3", len(parts))
+	}
+	for _, p := range parts {
+		if n := visibleLength(p); n > 100 {
+			t.Errorf("part of %d UTF-16 units exceeds the limit", n)
+		}
+		if !strings.HasPrefix(p, "😀") || strings.ContainsRune(p, '�') {
+			t.Errorf("emoji cut in half: %q", p)
+		}
+	}
+	if strings.Join(parts, "") != md {
+		t.Error("text lost while splitting")
+	}
+
+	// Mixed text is counted the same way
+	md = strings.Repeat("ab😀 ", 60)
+	for _, p := range SplitMarkdown(md, 50) {
+		if n := visibleLength(p); n > 50 {
+			t.Errorf("part of %d UTF-16 units exceeds the limit: %q", n, p)
+		}
+	}
+}
+
+func TestSplitMarkdownMarkupNotCounted(t *testing.T) {
+	// The limit is on visible text; markup characters don't count
+	md := "**" + strings.Repeat("x", 95) + "**"
+	if parts := SplitMarkdown(md, 100); len(parts) != 1 {
+		t.Errorf("got %d parts, want 1", len(parts))
+	}
+}
+
+func TestSplitMarkdownKeepsInlineSpans(t *testing.T) {
+	md := "**" + strings.TrimSpace(strings.Repeat("word ", 1000)) + "**"
+	parts := SplitMarkdown(md, 4096)
+	if len(parts) != 2 {
+		t.Fatalf("got %d parts, want 2", len(parts))
+	}
+	for i, p := range parts {
+		if n := visibleLength(p); n > 4096 {
+			t.Errorf("part %d has %d units", i, n)
+		}
+		html := render.ToHTML(p)
+		if !strings.HasPrefix(html, "<b>") || !strings.HasSuffix(html, "</b>") || strings.Contains(html, "*") {
+			t.Errorf("part %d is not bold as a whole: %.40q…%q", i, html, html[len(html)-20:])
+		}
+	}
+	if got := strings.Count(render.ToPlain(strings.Join(parts, " ")), "word"); got != 1000 {
+		t.Errorf("%d words after splitting, want 1000", got)
+	}
+}
+
+func TestSplitMarkdownNestedSpans(t *testing.T) {
+	words := strings.TrimSpace(strings.Repeat("lorem ipsum ", 20))
+	for _, tc := range []struct {
+		md   string
+		tags []string
+	}{
+		{"**bold *italic " + words + "* end**", []string{"<b>", "<i>"}},
+		{"_italic ~~" + words + "~~_", []string{"<i>", "<s>"}},
+		{"see [the " + words + " docs](https://example.com/x) now", []string{`<a href="https://example.com/x">`}},
+		{"run `" + words + "` here", []string{"<code>"}},
+	} {
+		parts := SplitMarkdown(tc.md, 100)
+		if len(parts) < 2 {
+			t.Fatalf("%.20q: got %d parts", tc.md, len(parts))
+		}
+		for _, p := range parts {
+			if n := visibleLength(p); n > 100 {
+				t.Errorf("%.20q: part of %d units", tc.md, n)
+			}
+			html := render.ToHTML(p)
+			if strings.ContainsAny(html, "*_~`[]") {
+				t.Errorf("%.20q: literal markup in %q", tc.md, html)
+			}
+			for _, tag := range tc.tags {
+				if !strings.Contains(html, tag) {
+					t.Errorf("%.20q: %q lacks %s", tc.md, html, tag)
+				}
+			}
+		}
+	}
+}
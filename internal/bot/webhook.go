@@ -0,0 +1,64 @@
+package bot
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"telechatbot/internal/models"
+)
+
+// secretHeader is set by Telegram on every webhook request when a
+// secret_token was given to setWebhook.
+const secretHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// maxWebhookBody protects the server from oversized requests. Real updates
+// are a few KB at most.
+const maxWebhookBody = 1 << 20
+
+// SetWebhook registers url as the update endpoint. Telegram sends secret in
+// the X-Telegram-Bot-Api-Secret-Token header of every request.
+func (c *Client) SetWebhook(ctx context.Context, url, secret string) error {
+	reqBody := models.SetWebhookRequest{
+		URL:            url,
+		SecretToken:    secret,
+		AllowedUpdates: AllowedUpdates,
+	}
+
+	return c.call(ctx, "setWebhook", reqBody, nil)
+}
+
+// DeleteWebhook removes the webhook so getUpdates works again.
+func (c *Client) DeleteWebhook(ctx context.Context, dropPendingUpdates bool) error {
+	reqBody := models.DeleteWebhookRequest{DropPendingUpdates: dropPendingUpdates}
+	return c.call(ctx, "deleteWebhook", reqBody, nil)
+}
+
+// WebhookHandler decodes incoming updates and passes them to handle.
+// Requests without the matching secret token are rejected.
+func WebhookHandler(secret string, handle func(models.Update)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		got := r.Header.Get(secretHeader)
+		if subtle.ConstantTimeCompare([]byte(got), []byte(secret)) != 1 {
+			log.Printf("[WARN] Webhook request with invalid secret token from %s", r.RemoteAddr)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		var update models.Update
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxWebhookBody)).Decode(&update); err != nil {
+			log.Printf("[WARN] Invalid webhook update: %v", err)
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		handle(update)
+		w.WriteHeader(http.StatusOK)
+	})
+}
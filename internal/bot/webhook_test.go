@@ -0,0 +1,113 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"telechatbot/internal/models"
+	"testing"
+)
+
+func postUpdate(h http.Handler, secret, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body))
+	if secret != "" {
+		req.Header.Set(secretHeader, secret)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestWebhookHandlerRejectsSecret(t *testing.T) {
+	called := false
+	h := WebhookHandler("s3cret", func(models.Update) { called = true })
+
+	for _, secret := range []string{"", "wrong", "s3cret-but-longer"} {
+		if rec := postUpdate(h, secret, `{"update_id":1}`); rec.Code != http.StatusForbidden {
+			t.Errorf("secret %q: got status %d, want 403", secret, rec.Code)
+		}
+	}
+	if called {
+		t.Error("handler called for a request without the right secret")
+	}
+}
+
+func TestWebhookHandlerDeliversUpdate(t *testing.T) {
+	var got []models.Update
+	h := WebhookHandler("s3cret", func(u models.Update) { got = append(got, u) })
+
+	rec := postUpdate(h, "s3cret", `{"update_id":42,"message":{"message_id":7,"text":"hi","chat":{"id":5,"type":"private"}}}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200", rec.Code)
+	}
+	if len(got) != 1 || got[0].UpdateID != 42 || got[0].Message == nil || got[0].Message.Text != "hi" {
+		t.Errorf("got updates %+v", got)
+	}
+
+	// Bad JSON and other methods never reach the handler
+	if rec := postUpdate(h, "s3cret", `{"update_id":`); rec.Code != http.StatusBadRequest {
+		t.Errorf("bad JSON: got status %d, want 400", rec.Code)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/webhook", nil)
+	req.Header.Set(secretHeader, "s3cret")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: got status %d, want 405", rec.Code)
+	}
+	if len(got) != 1 {
+		t.Errorf("handler called %d times, want once", len(got))
+	}
+}
+
+// fakeTelegram records the method and JSON body of every Bot API call.
+func fakeTelegram(t *testing.T) (*Client, map[string]map[string]interface{}) {
+	t.Helper()
+	calls := make(map[string]map[string]interface{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method := strings.TrimPrefix(r.URL.Path, "/botTOKEN/")
+		if method == r.URL.Path {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("%s: %v", method, err)
+		}
+		calls[method] = body
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":true,"result":true}`))
+	}))
+	t.Cleanup(srv.Close)
+	return NewClientWithAPIURL("TOKEN", srv.URL), calls
+}
+
+func TestSetWebhook(t *testing.T) {
+	c, calls := fakeTelegram(t)
+	if err := c.SetWebhook(context.Background(), "https://example.com/hook", "s3cret"); err != nil {
+		t.Fatal(err)
+	}
+
+	body, ok := calls["setWebhook"]
+	if !ok {
+		t.Fatalf("setWebhook not called, got %v", calls)
+	}
+	if body["url"] != "https://example.com/hook" || body["secret_token"] != "s3cret" {
+		t.Errorf("got body %v", body)
+	}
+	updates, _ := body["allowed_updates"].([]interface{})
+	if len(updates) != len(AllowedUpdates) {
+		t.Errorf("allowed_updates %v, want %v", body["allowed_updates"], AllowedUpdates)
+	}
+}
+
+func TestDeleteWebhook(t *testing.T) {
+	c, calls := fakeTelegram(t)
+	if err := c.DeleteWebhook(context.Background(), true); err != nil {
+		t.Fatal(err)
+	}
+	if body, ok := calls["deleteWebhook"]; !ok || body["drop_pending_updates"] != true {
+		t.Errorf("got calls %v", calls)
+	}
+}
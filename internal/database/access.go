@@ -0,0 +1,70 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Kinds and values of access rules
+const (
+	AccessUser  = "user"
+	AccessChat  = "chat"
+	AccessAllow = "allow"
+	AccessDeny  = "deny"
+)
+
+// AccessRule allows or denies one user or chat.
+type AccessRule struct {
+	Kind      string
+	ID        int64
+	Rule      string
+	AddedBy   int64
+	CreatedAt time.Time
+}
+
+// SetAccessRule stores rule for a user or chat, replacing an older one.
+func (db *DB) SetAccessRule(kind string, id int64, rule string, addedBy int64) error {
+	query := `INSERT INTO access_rules (kind, id, rule, added_by, created_at) VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(kind, id) DO UPDATE SET
+			rule = excluded.rule,
+			added_by = excluded.added_by,
+			created_at = excluded.created_at`
+	_, err := db.Conn.Exec(query, kind, id, rule, addedBy)
+	return err
+}
+
+// GetAccessRule returns the rule of a user or chat, "" if there is none.
+func (db *DB) GetAccessRule(kind string, id int64) (string, error) {
+	var rule string
+	err := db.Conn.QueryRow(`SELECT rule FROM access_rules WHERE kind = ? AND id = ?`, kind, id).Scan(&rule)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return rule, err
+}
+
+// DeleteAccessRule removes the rule of a user or chat, so the config
+// decides again.
+func (db *DB) DeleteAccessRule(kind string, id int64) error {
+	_, err := db.Conn.Exec(`DELETE FROM access_rules WHERE kind = ? AND id = ?`, kind, id)
+	return err
+}
+
+// ListAccessRules returns all rules, newest first.
+func (db *DB) ListAccessRules() ([]AccessRule, error) {
+	rows, err := db.Conn.Query(`SELECT kind, id, rule, added_by, created_at FROM access_rules ORDER BY created_at DESC, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []AccessRule
+	for rows.Next() {
+		var r AccessRule
+		if err := rows.Scan(&r.Kind, &r.ID, &r.Rule, &r.AddedBy, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, rows.Err()
+}
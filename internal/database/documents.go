@@ -0,0 +1,84 @@
+package database
+
+// DocumentChunk is one stored piece of a document.
+type DocumentChunk struct {
+	ID         int64
+	DocumentID int64
+	FileName   string
+	Index      int
+	Content    string
+}
+
+// AddDocument stores the chunks of a document for a conversation.
+func (db *DB) AddDocument(chatID int64, threadID int, fileName string, chunks []string) (int64, error) {
+	tx, err := db.Conn.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	chars := 0
+	for _, c := range chunks {
+		chars += len([]rune(c))
+	}
+	res, err := tx.Exec(`INSERT INTO documents (chat_id, thread_id, file_name, chars) VALUES (?, ?, ?, ?)`,
+		chatID, threadID, fileName, chars)
+	if err != nil {
+		return 0, err
+	}
+	docID, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	for i, c := range chunks {
+		if _, err := tx.Exec(`INSERT INTO document_chunks (document_id, chunk_index, content) VALUES (?, ?, ?)`,
+			docID, i, c); err != nil {
+			return 0, err
+		}
+	}
+	return docID, tx.Commit()
+}
+
+// GetDocumentChunks returns up to limit chunks of the conversation's
+// documents, newest document first and in order within a document.
+func (db *DB) GetDocumentChunks(chatID int64, threadID int, limit int) ([]DocumentChunk, error) {
+	query := `SELECT c.id, c.document_id, d.file_name, c.chunk_index, c.content
+		FROM document_chunks c JOIN documents d ON d.id = c.document_id
+		WHERE d.chat_id = ? AND d.thread_id = ?
+		ORDER BY d.id DESC, c.chunk_index ASC
+		LIMIT ?`
+	rows, err := db.Conn.Query(query, chatID, threadID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var chunks []DocumentChunk
+	for rows.Next() {
+		var c DocumentChunk
+		if err := rows.Scan(&c.ID, &c.DocumentID, &c.FileName, &c.Index, &c.Content); err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, c)
+	}
+	return chunks, rows.Err()
+}
+
+// ClearDocuments deletes the documents of a conversation.
+func (db *DB) ClearDocuments(chatID int64, threadID int) error {
+	tx, err := db.Conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM document_chunks WHERE document_id IN
+		(SELECT id FROM documents WHERE chat_id = ? AND thread_id = ?)`, chatID, threadID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM documents WHERE chat_id = ? AND thread_id = ?`, chatID, threadID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,168 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Memory sources
+const (
+	MemoryMessage  = "message"  // source_id is a chat_history id
+	MemoryDocument = "document" // source_id is a document_chunks id
+)
+
+// MemoryItem is one embedded snippet of a conversation.
+type MemoryItem struct {
+	Source   string
+	SourceID int64
+	Content  string
+	Vector   []float32
+}
+
+// MemoryMatch is a search result with its cosine similarity.
+type MemoryMatch struct {
+	MemoryItem
+	Score float64
+}
+
+// AddMemory stores embedded items for a conversation. Items already stored
+// for the same source and model are skipped, and so are items whose source
+// row is gone: embedding takes a while, and /newchat may have cleared the
+// conversation in the meantime.
+func (db *DB) AddMemory(chatID int64, threadID int, model string, items []MemoryItem) error {
+	tx, err := db.Conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	const insert = `INSERT OR IGNORE INTO memory_embeddings
+		(chat_id, thread_id, source, source_id, content, model, vector) SELECT ?, ?, ?, ?, ?, ?, ? `
+	stmts := make(map[string]*sql.Stmt)
+	for source, exists := range map[string]string{
+		MemoryMessage: `WHERE EXISTS (SELECT 1 FROM chat_history WHERE id = ? AND chat_id = ? AND thread_id = ?)`,
+		MemoryDocument: `WHERE EXISTS (SELECT 1 FROM document_chunks c JOIN documents d ON d.id = c.document_id
+			WHERE c.id = ? AND d.chat_id = ? AND d.thread_id = ?)`,
+	} {
+		stmt, err := tx.Prepare(insert + exists)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		stmts[source] = stmt
+	}
+
+	for _, it := range items {
+		stmt, ok := stmts[it.Source]
+		if !ok {
+			return fmt.Errorf("unknown memory source %q", it.Source)
+		}
+		if _, err := stmt.Exec(chatID, threadID, it.Source, it.SourceID, it.Content, model, encodeVector(it.Vector),
+			it.SourceID, chatID, threadID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// SearchMemory returns the k stored items most similar to query with a
+// score of at least minScore. It is a brute-force scan of the
+// conversation's vectors, which is fast enough for the few thousand
+// snippets a topic accumulates. Vectors must be normalized.
+func (db *DB) SearchMemory(chatID int64, threadID int, model string, query []float32, k int, minScore float64) ([]MemoryMatch, error) {
+	rows, err := db.Conn.Query(`SELECT source, source_id, content, vector FROM memory_embeddings
+		WHERE chat_id = ? AND thread_id = ? AND model = ?`, chatID, threadID, model)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var matches []MemoryMatch
+	for rows.Next() {
+		var m MemoryMatch
+		var blob []byte
+		if err := rows.Scan(&m.Source, &m.SourceID, &m.Content, &blob); err != nil {
+			return nil, err
+		}
+		m.Score = dot(query, blob)
+		if m.Score >= minScore {
+			matches = append(matches, m)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+	if len(matches) > k {
+		matches = matches[:k]
+	}
+	return matches, nil
+}
+
+// UnembeddedHistory returns up to limit turns of a conversation that have
+// no vector for model yet, oldest first, for backfilling.
+func (db *DB) UnembeddedHistory(chatID int64, threadID int, model string, limit int) ([]ChatMessage, error) {
+	query := `SELECT h.id, h.role, h.content FROM chat_history h
+		WHERE h.chat_id = ? AND h.thread_id = ?
+		AND NOT EXISTS (SELECT 1 FROM memory_embeddings m
+			WHERE m.source = 'message' AND m.source_id = h.id AND m.model = ?)
+		ORDER BY h.id ASC
+		LIMIT ?`
+	return db.queryHistory(query, chatID, threadID, model, limit)
+}
+
+// UnembeddedChunks returns up to limit document chunks of a conversation
+// that have no vector for model yet.
+func (db *DB) UnembeddedChunks(chatID int64, threadID int, model string, limit int) ([]DocumentChunk, error) {
+	rows, err := db.Conn.Query(`SELECT c.id, c.document_id, d.file_name, c.chunk_index, c.content
+		FROM document_chunks c JOIN documents d ON d.id = c.document_id
+		WHERE d.chat_id = ? AND d.thread_id = ?
+		AND NOT EXISTS (SELECT 1 FROM memory_embeddings m
+			WHERE m.source = 'document' AND m.source_id = c.id AND m.model = ?)
+		ORDER BY c.id ASC
+		LIMIT ?`, chatID, threadID, model, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var chunks []DocumentChunk
+	for rows.Next() {
+		var c DocumentChunk
+		if err := rows.Scan(&c.ID, &c.DocumentID, &c.FileName, &c.Index, &c.Content); err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, c)
+	}
+	return chunks, rows.Err()
+}
+
+func (db *DB) ClearMemory(chatID int64, threadID int) error {
+	_, err := db.Conn.Exec(`DELETE FROM memory_embeddings WHERE chat_id = ? AND thread_id = ?`, chatID, threadID)
+	return err
+}
+
+// Vectors are stored as little-endian float32s
+func encodeVector(v []float32) []byte {
+	b := make([]byte, 4*len(v))
+	for i, x := range v {
+		binary.LittleEndian.PutUint32(b[4*i:], math.Float32bits(x))
+	}
+	return b
+}
+
+func dot(v []float32, blob []byte) float64 {
+	n := len(blob) / 4
+	if n != len(v) {
+		return 0
+	}
+	var sum float64
+	for i := 0; i < n; i++ {
+		sum += float64(v[i]) * float64(math.Float32frombits(binary.LittleEndian.Uint32(blob[4*i:])))
+	}
+	return sum
+}
@@ -0,0 +1,131 @@
+package database
+
+import (
+	"math"
+	"testing"
+)
+
+func TestVectorRoundTrip(t *testing.T) {
+	v := []float32{0.6, -0.8, 0, 1e-7}
+	blob := encodeVector(v)
+	if len(blob) != 16 {
+		t.Fatalf("blob has %d bytes, want 16", len(blob))
+	}
+	if got := dot(v, blob); math.Abs(got-1) > 1e-6 {
+		t.Errorf("dot with itself %f, want 1", got)
+	}
+	if got := dot([]float32{1, 0, 0, 0}, blob); math.Abs(got-0.6) > 1e-6 {
+		t.Errorf("dot %f, want 0.6", got)
+	}
+	// Vectors of another dimension never match
+	if got := dot([]float32{1, 0}, blob); got != 0 {
+		t.Errorf("dot across dimensions %f, want 0", got)
+	}
+}
+
+// addTurns stores turns in a conversation and returns their IDs.
+func addTurns(t *testing.T, db *DB, chatID int64, threadID int, contents ...string) []int64 {
+	t.Helper()
+	for _, c := range contents {
+		if err := db.AddHistory(chatID, threadID, "user", c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	history, err := db.GetHistory(chatID, threadID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int64
+	for _, h := range history[len(history)-len(contents):] {
+		ids = append(ids, h.ID)
+	}
+	return ids
+}
+
+func TestSearchMemory(t *testing.T) {
+	db := openTestDB(t)
+	ids := addTurns(t, db, 1, 0, "exact", "close", "opposite")
+	if _, err := db.AddDocument(1, 0, "doc.txt", []string{"half"}); err != nil {
+		t.Fatal(err)
+	}
+	chunks, err := db.GetDocumentChunks(1, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	items := []MemoryItem{
+		{Source: MemoryMessage, SourceID: ids[0], Content: "exact", Vector: []float32{1, 0}},
+		{Source: MemoryMessage, SourceID: ids[1], Content: "close", Vector: []float32{0.8, 0.6}},
+		{Source: MemoryDocument, SourceID: chunks[0].ID, Content: "half", Vector: []float32{0.6, 0.8}},
+		{Source: MemoryMessage, SourceID: ids[2], Content: "opposite", Vector: []float32{-1, 0}},
+	}
+	if err := db.AddMemory(1, 0, "m", items); err != nil {
+		t.Fatal(err)
+	}
+	// Duplicates are ignored; other topics and models are not searched
+	if err := db.AddMemory(1, 0, "m", items[:1]); err != nil {
+		t.Fatal(err)
+	}
+	other := addTurns(t, db, 1, 5, "other topic")
+	db.AddMemory(1, 5, "m", []MemoryItem{{Source: MemoryMessage, SourceID: other[0], Content: "other topic", Vector: []float32{1, 0}}})
+	db.AddMemory(1, 0, "other", []MemoryItem{{Source: MemoryMessage, SourceID: ids[0], Content: "other model", Vector: []float32{1, 0}}})
+
+	query := []float32{1, 0}
+	matches, err := db.SearchMemory(1, 0, "m", query, 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 2 || matches[0].Content != "exact" || matches[1].Content != "close" {
+		t.Fatalf("top 2: got %+v", matches)
+	}
+	if math.Abs(matches[1].Score-0.8) > 1e-6 {
+		t.Errorf("score %f, want 0.8", matches[1].Score)
+	}
+
+	// The minimum score cuts before k does
+	matches, err = db.SearchMemory(1, 0, "m", query, 10, 0.7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 2 {
+		t.Errorf("min score 0.7: got %+v", matches)
+	}
+	matches, _ = db.SearchMemory(1, 0, "m", query, 10, -1)
+	if len(matches) != 4 || matches[3].Content != "opposite" {
+		t.Errorf("min score -1: got %+v", matches)
+	}
+}
+
+func TestWritesAfterClearAreDropped(t *testing.T) {
+	db := openTestDB(t)
+	ids := addTurns(t, db, 1, 0, "first", "second")
+	db.AddDocument(1, 0, "doc.txt", []string{"chunk"})
+	chunks, _ := db.GetDocumentChunks(1, 0, 10)
+
+	// /newchat runs while a summary and embeddings are being computed
+	if err := db.ClearHistory(1, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetSummary(1, 0, Summary{Text: "stale", LastMessageID: ids[1]}); err != nil {
+		t.Fatal(err)
+	}
+	err := db.AddMemory(1, 0, "m", []MemoryItem{
+		{Source: MemoryMessage, SourceID: ids[0], Content: "first", Vector: []float32{1}},
+		{Source: MemoryDocument, SourceID: chunks[0].ID, Content: "chunk", Vector: []float32{1}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s, _ := db.GetSummary(1, 0); s.Text != "" {
+		t.Errorf("stale summary %q written after the reset", s.Text)
+	}
+	if m, _ := db.SearchMemory(1, 0, "m", []float32{1}, 10, -1); len(m) != 0 {
+		t.Errorf("stale memory %+v written after the reset", m)
+	}
+	// A new conversation in the same topic is not confused with the old one
+	fresh := addTurns(t, db, 1, 0, "new start")
+	if fresh[0] <= ids[1] {
+		t.Errorf("history ID %d reused", fresh[0])
+	}
+}
@@ -0,0 +1,156 @@
+package database
+
+import (
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Migrations live in migrations/NNNN_name.sql and are applied in order of
+// NNNN. Never edit a migration that has been released, add a new one.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt string
+}
+
+func loadMigrations() ([]Migration, error) {
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []Migration
+	seen := make(map[int]string)
+	for _, e := range entries {
+		name := strings.TrimSuffix(e.Name(), ".sql")
+		num, label, ok := strings.Cut(name, "_")
+		version, err := strconv.Atoi(num)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("invalid migration file name %q", e.Name())
+		}
+		if other, dup := seen[version]; dup {
+			return nil, fmt.Errorf("migrations %q and %q have the same version", other, e.Name())
+		}
+		seen[version] = e.Name()
+
+		body, err := migrationFiles.ReadFile(path.Join("migrations", e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, Migration{Version: version, Name: label, SQL: string(body)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+func (db *DB) ensureVersionTable() error {
+	_, err := db.Conn.Exec(`
+	CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	`)
+	return err
+}
+
+func (db *DB) appliedVersions() (map[int]string, error) {
+	rows, err := db.Conn.Query(`SELECT version, applied_at FROM schema_version`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]string)
+	for rows.Next() {
+		var version int
+		var at string
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+// Migrate applies every pending migration, each in its own transaction,
+// and returns how many were applied.
+func (db *DB) Migrate() (int, error) {
+	if err := db.ensureVersionTable(); err != nil {
+		return 0, err
+	}
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		return 0, err
+	}
+	applied, err := db.appliedVersions()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, m := range migrations {
+		if _, done := applied[m.Version]; done {
+			continue
+		}
+
+		tx, err := db.Conn.Begin()
+		if err != nil {
+			return count, err
+		}
+		if _, err := tx.Exec(m.SQL); err != nil {
+			tx.Rollback()
+			return count, fmt.Errorf("migration %04d_%s: %v", m.Version, m.Name, err)
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_version (version, name) VALUES (?, ?)`, m.Version, m.Name); err != nil {
+			tx.Rollback()
+			return count, err
+		}
+		if err := tx.Commit(); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// MigrationStatus lists all known migrations and whether they are applied.
+func (db *DB) MigrationStatus() ([]MigrationStatus, error) {
+	if err := db.ensureVersionTable(); err != nil {
+		return nil, err
+	}
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := db.appliedVersions()
+	if err != nil {
+		return nil, err
+	}
+
+	var status []MigrationStatus
+	for _, m := range migrations {
+		at, ok := applied[m.Version]
+		status = append(status, MigrationStatus{Version: m.Version, Name: m.Name, Applied: ok, AppliedAt: at})
+	}
+	return status, nil
+}
@@ -0,0 +1,15 @@
+-- Tables created by InitDB before migrations existed. IF NOT EXISTS keeps
+-- this safe for databases that already have them.
+CREATE TABLE IF NOT EXISTS user_preferences (
+	user_id INTEGER PRIMARY KEY,
+	language_code TEXT DEFAULT 'en'
+);
+
+CREATE TABLE IF NOT EXISTS chat_history (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	chat_id INTEGER,
+	thread_id INTEGER DEFAULT 0,
+	role TEXT,
+	content TEXT,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
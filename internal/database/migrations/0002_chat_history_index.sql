@@ -0,0 +1,4 @@
+-- GetHistory and the prune query in AddHistory filter by conversation and
+-- order by id.
+CREATE INDEX IF NOT EXISTS idx_chat_history_conversation
+	ON chat_history (chat_id, thread_id, id);
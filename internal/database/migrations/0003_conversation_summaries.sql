@@ -0,0 +1,10 @@
+-- Rolling summary of the older part of a conversation. last_message_id is
+-- the newest chat_history row the summary already covers.
+CREATE TABLE IF NOT EXISTS conversation_summaries (
+	chat_id INTEGER NOT NULL,
+	thread_id INTEGER NOT NULL DEFAULT 0,
+	summary TEXT NOT NULL,
+	last_message_id INTEGER NOT NULL,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (chat_id, thread_id)
+);
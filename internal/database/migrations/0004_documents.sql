@@ -0,0 +1,22 @@
+-- Documents shared in a conversation, stored as chunks for retrieval.
+CREATE TABLE IF NOT EXISTS documents (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	chat_id INTEGER NOT NULL,
+	thread_id INTEGER NOT NULL DEFAULT 0,
+	file_name TEXT NOT NULL,
+	chars INTEGER NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_documents_conversation
+	ON documents (chat_id, thread_id);
+
+CREATE TABLE IF NOT EXISTS document_chunks (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	document_id INTEGER NOT NULL REFERENCES documents (id),
+	chunk_index INTEGER NOT NULL,
+	content TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_document_chunks_document
+	ON document_chunks (document_id, chunk_index);
@@ -0,0 +1,20 @@
+-- Embedding vectors of past messages and document chunks, searched by
+-- cosine similarity. model tags which embedder produced the vector, since
+-- vectors of different models can't be compared.
+CREATE TABLE IF NOT EXISTS memory_embeddings (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	chat_id INTEGER NOT NULL,
+	thread_id INTEGER NOT NULL DEFAULT 0,
+	source TEXT NOT NULL,
+	source_id INTEGER NOT NULL,
+	content TEXT NOT NULL,
+	model TEXT NOT NULL,
+	vector BLOB NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_memory_conversation
+	ON memory_embeddings (chat_id, thread_id, model);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_memory_source
+	ON memory_embeddings (source, source_id, model);
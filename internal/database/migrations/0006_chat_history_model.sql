@@ -0,0 +1,2 @@
+-- Which model wrote an AI turn; NULL for user turns and older rows.
+ALTER TABLE chat_history ADD COLUMN model TEXT;
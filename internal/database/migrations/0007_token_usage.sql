@@ -0,0 +1,26 @@
+-- One row per completion request, for /usage and the admin report.
+-- user_id, chat_id and thread_id are 0 when a request has no such owner.
+CREATE TABLE IF NOT EXISTS token_usage (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	user_id INTEGER NOT NULL DEFAULT 0,
+	chat_id INTEGER NOT NULL DEFAULT 0,
+	thread_id INTEGER NOT NULL DEFAULT 0,
+	purpose TEXT NOT NULL,
+	provider TEXT NOT NULL,
+	model TEXT NOT NULL,
+	key_index INTEGER NOT NULL DEFAULT -1,
+	prompt_tokens INTEGER NOT NULL DEFAULT 0,
+	completion_tokens INTEGER NOT NULL DEFAULT 0,
+	reasoning_tokens INTEGER NOT NULL DEFAULT 0,
+	latency_ms INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_token_usage_created
+	ON token_usage (created_at);
+
+CREATE INDEX IF NOT EXISTS idx_token_usage_user
+	ON token_usage (user_id, created_at);
+
+CREATE INDEX IF NOT EXISTS idx_token_usage_chat
+	ON token_usage (chat_id, thread_id, created_at);
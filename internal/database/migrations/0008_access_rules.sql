@@ -0,0 +1,10 @@
+-- Allow/deny rules set by admins at runtime; they take precedence over
+-- the lists in the config. kind is 'user' or 'chat', rule 'allow' or 'deny'.
+CREATE TABLE IF NOT EXISTS access_rules (
+	kind TEXT NOT NULL,
+	id INTEGER NOT NULL,
+	rule TEXT NOT NULL,
+	added_by INTEGER NOT NULL DEFAULT 0,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (kind, id)
+);
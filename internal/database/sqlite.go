@@ -3,6 +3,7 @@ package database
 import (
 	"database/sql"
 	"log"
+	"strings"
 
 	_ "modernc.org/sqlite"
 )
@@ -12,48 +13,54 @@ type DB struct {
 }
 
 type ChatMessage struct {
+	ID      int64
 	Role    string
 	Content string
 }
 
+// InitDB opens the database and applies pending migrations.
 func InitDB(filepath string) *DB {
-	db, err := sql.Open("sqlite", filepath)
+	db, err := OpenDB(filepath)
 	if err != nil {
 		log.Fatalf("Error opening database: %v", err)
 	}
 
-	if err := db.Ping(); err != nil {
-		log.Fatalf("Error connecting to database: %v", err)
+	applied, err := db.Migrate()
+	if err != nil {
+		log.Fatalf("Error migrating database: %v", err)
+	}
+	if applied > 0 {
+		log.Printf("Applied %d database migration(s)", applied)
 	}
 
-	createPreferencesTable := `
-	CREATE TABLE IF NOT EXISTS user_preferences (
-		user_id INTEGER PRIMARY KEY,
-		language_code TEXT DEFAULT 'en'
-	);
-	`
-	_, err = db.Exec(createPreferencesTable)
+	log.Println("Database and tables initialized successfully")
+	return db
+}
+
+// sqlitePragmas are set on every connection. Updates of different
+// conversations and the background writers (summaries, embeddings, usage)
+// write concurrently: WAL lets readers run alongside a writer, and writers
+// wait for the lock (immediate transactions, busy_timeout) instead of
+// failing with "database is locked".
+const sqlitePragmas = "_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_txlock=immediate"
+
+// OpenDB opens the database without touching the schema.
+func OpenDB(filepath string) (*DB, error) {
+	dsn := filepath + "?" + sqlitePragmas
+	if strings.Contains(filepath, "?") {
+		dsn = filepath + "&" + sqlitePragmas
+	}
+	db, err := sql.Open("sqlite", dsn)
 	if err != nil {
-		log.Fatalf("Error creating preferences table: %v", err)
+		return nil, err
 	}
 
-	createHistoryTable := `
-	CREATE TABLE IF NOT EXISTS chat_history (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		chat_id INTEGER,
-		thread_id INTEGER DEFAULT 0,
-		role TEXT,
-		content TEXT,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	);
-	`
-	_, err = db.Exec(createHistoryTable)
-	if err != nil {
-		log.Fatalf("Error creating history table: %v", err)
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
 	}
 
-	log.Println("Database and tables initialized successfully")
-	return &DB{Conn: db}
+	return &DB{Conn: db}, nil
 }
 
 func (db *DB) SetUserLanguage(userID int64, lang string) error {
@@ -73,29 +80,62 @@ func (db *DB) GetUserLanguage(userID int64) string {
 	return lang
 }
 
+// AddHistory stores one turn. Full history is kept; what is sent to the
+// model is trimmed by the caller.
 func (db *DB) AddHistory(chatID int64, threadID int, role, content string) error {
-	insertQuery := `INSERT INTO chat_history (chat_id, thread_id, role, content) VALUES (?, ?, ?, ?)`
-	_, err := db.Conn.Exec(insertQuery, chatID, threadID, role, content)
-	if err != nil {
-		return err
-	}
+	return db.AddHistoryFrom(chatID, threadID, role, content, "")
+}
 
-	pruneQuery := `
-		DELETE FROM chat_history 
-		WHERE id NOT IN (
-			SELECT id FROM chat_history 
-			WHERE chat_id = ? AND thread_id = ? 
-			ORDER BY id DESC 
-			LIMIT 20
-		) AND chat_id = ? AND thread_id = ?
-	`
-	_, err = db.Conn.Exec(pruneQuery, chatID, threadID, chatID, threadID)
+// AddHistoryFrom stores a turn together with the model that wrote it.
+func (db *DB) AddHistoryFrom(chatID int64, threadID int, role, content, model string) error {
+	insertQuery := `INSERT INTO chat_history (chat_id, thread_id, role, content, model) VALUES (?, ?, ?, ?, ?)`
+	_, err := db.Conn.Exec(insertQuery, chatID, threadID, role, content, sql.NullString{String: model, Valid: model != ""})
 	return err
 }
 
 func (db *DB) GetHistory(chatID int64, threadID int) ([]ChatMessage, error) {
-	query := `SELECT role, content FROM chat_history WHERE chat_id = ? AND thread_id = ? ORDER BY id ASC`
-	rows, err := db.Conn.Query(query, chatID, threadID)
+	query := `SELECT id, role, content FROM chat_history WHERE chat_id = ? AND thread_id = ? ORDER BY id ASC`
+	return db.queryHistory(query, chatID, threadID)
+}
+
+// GetRecentHistory returns the newest limit turns, oldest first.
+func (db *DB) GetRecentHistory(chatID int64, threadID int, limit int) ([]ChatMessage, error) {
+	query := `SELECT id, role, content FROM (
+			SELECT id, role, content FROM chat_history
+			WHERE chat_id = ? AND thread_id = ?
+			ORDER BY id DESC
+			LIMIT ?
+		) ORDER BY id ASC`
+	return db.queryHistory(query, chatID, threadID, limit)
+}
+
+// GetHistoryAfter returns up to limit turns newer than afterID, oldest first.
+func (db *DB) GetHistoryAfter(chatID int64, threadID int, afterID int64, limit int) ([]ChatMessage, error) {
+	query := `SELECT id, role, content FROM chat_history
+		WHERE chat_id = ? AND thread_id = ? AND id > ?
+		ORDER BY id ASC
+		LIMIT ?`
+	return db.queryHistory(query, chatID, threadID, afterID, limit)
+}
+
+// SearchHistory returns up to limit turns containing query (case-insensitive
+// for ASCII), newest first.
+func (db *DB) SearchHistory(chatID int64, threadID int, query string, limit int) ([]ChatMessage, error) {
+	pattern := "%" + escapeLike(query) + "%"
+	q := `SELECT id, role, content FROM chat_history
+		WHERE chat_id = ? AND thread_id = ? AND content LIKE ? ESCAPE '\'
+		ORDER BY id DESC
+		LIMIT ?`
+	return db.queryHistory(q, chatID, threadID, pattern, limit)
+}
+
+func escapeLike(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+	return r.Replace(s)
+}
+
+func (db *DB) queryHistory(query string, args ...interface{}) ([]ChatMessage, error) {
+	rows, err := db.Conn.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -104,16 +144,58 @@ func (db *DB) GetHistory(chatID int64, threadID int) ([]ChatMessage, error) {
 	var history []ChatMessage
 	for rows.Next() {
 		var msg ChatMessage
-		if err := rows.Scan(&msg.Role, &msg.Content); err != nil {
+		if err := rows.Scan(&msg.ID, &msg.Role, &msg.Content); err != nil {
 			return nil, err
 		}
 		history = append(history, msg)
 	}
-	return history, nil
+	return history, rows.Err()
 }
 
+// ClearHistory forgets a conversation: history, documents, memory and
+// summary go in one transaction, so background writers that check for
+// their source rows (SetSummary, AddMemory) never see half of it.
 func (db *DB) ClearHistory(chatID int64, threadID int) error {
-	query := `DELETE FROM chat_history WHERE chat_id = ? AND thread_id = ?`
-	_, err := db.Conn.Exec(query, chatID, threadID)
-	return err
-}
\ No newline at end of file
+	tx, err := db.Conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, query := range []string{
+		`DELETE FROM chat_history WHERE chat_id = ? AND thread_id = ?`,
+		`DELETE FROM document_chunks WHERE document_id IN
+			(SELECT id FROM documents WHERE chat_id = ? AND thread_id = ?)`,
+		`DELETE FROM documents WHERE chat_id = ? AND thread_id = ?`,
+		`DELETE FROM memory_embeddings WHERE chat_id = ? AND thread_id = ?`,
+		`DELETE FROM conversation_summaries WHERE chat_id = ? AND thread_id = ?`,
+	} {
+		if _, err := tx.Exec(query, chatID, threadID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// MigrateChat moves stored data of a group to its new supergroup ID. It is
+// done in one transaction so a failure never leaves the chat split
+// between the two IDs.
+func (db *DB) MigrateChat(oldChatID, newChatID int64) error {
+	tx, err := db.Conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"chat_history", "conversation_summaries", "documents", "memory_embeddings", "token_usage"} {
+		query := `UPDATE ` + table + ` SET chat_id = ? WHERE chat_id = ?`
+		if _, err := tx.Exec(query, newChatID, oldChatID); err != nil {
+			return err
+		}
+	}
+	query := `UPDATE OR REPLACE access_rules SET id = ? WHERE kind = 'chat' AND id = ?`
+	if _, err := tx.Exec(query, newChatID, oldChatID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
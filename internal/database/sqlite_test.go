@@ -0,0 +1,95 @@
+package database
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func openTestDB(t *testing.T) *DB {
+	t.Helper()
+	db, err := OpenDB(filepath.Join(t.TempDir(), "bot.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Conn.Close() })
+	if _, err := db.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestOpenDBPragmas(t *testing.T) {
+	db := openTestDB(t)
+
+	var mode string
+	if err := db.Conn.QueryRow("PRAGMA journal_mode").Scan(&mode); err != nil {
+		t.Fatal(err)
+	}
+	if mode != "wal" {
+		t.Errorf("journal_mode %q, want wal", mode)
+	}
+	var timeout int
+	if err := db.Conn.QueryRow("PRAGMA busy_timeout").Scan(&timeout); err != nil {
+		t.Fatal(err)
+	}
+	if timeout != 5000 {
+		t.Errorf("busy_timeout %d, want 5000", timeout)
+	}
+}
+
+func TestConcurrentWriters(t *testing.T) {
+	db := openTestDB(t)
+
+	const writers, turns = 8, 25
+	var wg sync.WaitGroup
+	errs := make(chan error, writers*turns)
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(chatID int64) {
+			defer wg.Done()
+			for i := 0; i < turns; i++ {
+				if err := db.AddHistory(chatID, 0, "user", "hello"); err != nil {
+					errs <- err
+				}
+				if _, err := db.GetRecentHistory(chatID, 0, 10); err != nil {
+					errs <- err
+				}
+			}
+		}(int64(w + 1))
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	var n int
+	db.Conn.QueryRow("SELECT COUNT(*) FROM chat_history").Scan(&n)
+	if n != writers*turns {
+		t.Errorf("%d rows, want %d", n, writers*turns)
+	}
+}
+
+func TestMigrateChat(t *testing.T) {
+	db := openTestDB(t)
+	db.AddHistory(-1, 0, "user", "before the upgrade")
+	db.AddHistory(-2, 0, "user", "another group")
+	db.SetAccessRule(AccessChat, -1, AccessAllow, 9)
+
+	if err := db.MigrateChat(-1, -1002); err != nil {
+		t.Fatal(err)
+	}
+	if h, _ := db.GetHistory(-1002, 0); len(h) != 1 || h[0].Content != "before the upgrade" {
+		t.Errorf("history of the new chat: %+v", h)
+	}
+	if h, _ := db.GetHistory(-1, 0); len(h) != 0 {
+		t.Errorf("history left in the old chat: %+v", h)
+	}
+	if h, _ := db.GetHistory(-2, 0); len(h) != 1 {
+		t.Errorf("other group touched: %+v", h)
+	}
+	if rule, _ := db.GetAccessRule(AccessChat, -1002); rule != AccessAllow {
+		t.Errorf("access rule %q not moved", rule)
+	}
+}
@@ -0,0 +1,44 @@
+package database
+
+import (
+	"database/sql"
+)
+
+// Summary condenses the older part of a conversation. LastMessageID is the
+// newest chat_history row it covers; later rows are sent to the model as-is.
+type Summary struct {
+	Text          string
+	LastMessageID int64
+}
+
+// GetSummary returns the stored summary, or a zero Summary if there is none.
+func (db *DB) GetSummary(chatID int64, threadID int) (Summary, error) {
+	var s Summary
+	query := `SELECT summary, last_message_id FROM conversation_summaries WHERE chat_id = ? AND thread_id = ?`
+	err := db.Conn.QueryRow(query, chatID, threadID).Scan(&s.Text, &s.LastMessageID)
+	if err == sql.ErrNoRows {
+		return Summary{}, nil
+	}
+	return s, err
+}
+
+// SetSummary stores s. Nothing is written if the row s ends at no longer
+// exists, so a summary computed while /newchat cleared the history is
+// dropped instead of resurrecting the old conversation.
+func (db *DB) SetSummary(chatID int64, threadID int, s Summary) error {
+	query := `INSERT INTO conversation_summaries (chat_id, thread_id, summary, last_message_id, updated_at)
+		SELECT ?, ?, ?, ?, CURRENT_TIMESTAMP
+		WHERE EXISTS (SELECT 1 FROM chat_history WHERE id = ? AND chat_id = ? AND thread_id = ?)
+		ON CONFLICT(chat_id, thread_id) DO UPDATE SET
+			summary = excluded.summary,
+			last_message_id = excluded.last_message_id,
+			updated_at = excluded.updated_at`
+	_, err := db.Conn.Exec(query, chatID, threadID, s.Text, s.LastMessageID, s.LastMessageID, chatID, threadID)
+	return err
+}
+
+func (db *DB) ClearSummary(chatID int64, threadID int) error {
+	query := `DELETE FROM conversation_summaries WHERE chat_id = ? AND thread_id = ?`
+	_, err := db.Conn.Exec(query, chatID, threadID)
+	return err
+}
@@ -0,0 +1,133 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// UsageRecord is one completion request in the token_usage ledger.
+type UsageRecord struct {
+	UserID           int64
+	ChatID           int64
+	ThreadID         int
+	Purpose          string // "chat", "title", "inline", "summary", ...
+	Provider         string
+	Model            string
+	KeyIndex         int
+	PromptTokens     int
+	CompletionTokens int
+	ReasoningTokens  int
+	Latency          time.Duration
+}
+
+// Columns UsageTotals can group by
+const (
+	UsageByModel   = ""
+	UsageByUser    = "user_id"
+	UsageByChat    = "chat_id"
+	UsageByPurpose = "purpose"
+)
+
+// UsageFilter selects ledger rows. Zero fields match everything; Until is
+// exclusive.
+type UsageFilter struct {
+	Since  time.Time
+	Until  time.Time
+	UserID int64
+	ChatID int64
+}
+
+// UsageTotal sums the rows of one group and model. Key is the value of the
+// grouping column, empty when grouping by model only.
+type UsageTotal struct {
+	Key              string
+	Model            string
+	Requests         int
+	PromptTokens     int
+	CompletionTokens int
+	ReasoningTokens  int
+	Latency          time.Duration // average
+}
+
+// UsageTokens returns the prompt plus completion tokens of the matching
+// rows.
+func (db *DB) UsageTokens(f UsageFilter) (int, error) {
+	where, args := f.where()
+	var tokens int
+	err := db.Conn.QueryRow(`SELECT COALESCE(SUM(prompt_tokens + completion_tokens), 0) FROM token_usage WHERE `+where, args...).Scan(&tokens)
+	return tokens, err
+}
+
+// where builds the WHERE clause of f.
+func (f UsageFilter) where() (string, []interface{}) {
+	where := "1 = 1"
+	var args []interface{}
+	if !f.Since.IsZero() {
+		where += " AND created_at >= ?"
+		args = append(args, f.Since.UTC().Format(sqliteTime))
+	}
+	if !f.Until.IsZero() {
+		where += " AND created_at < ?"
+		args = append(args, f.Until.UTC().Format(sqliteTime))
+	}
+	if f.UserID != 0 {
+		where += " AND user_id = ?"
+		args = append(args, f.UserID)
+	}
+	if f.ChatID != 0 {
+		where += " AND chat_id = ?"
+		args = append(args, f.ChatID)
+	}
+	return where, args
+}
+
+// sqliteTime is the format of CURRENT_TIMESTAMP (UTC), so created_at can
+// be compared as text
+const sqliteTime = "2006-01-02 15:04:05"
+
+func (db *DB) AddUsage(r UsageRecord) error {
+	query := `INSERT INTO token_usage (user_id, chat_id, thread_id, purpose, provider, model, key_index,
+			prompt_tokens, completion_tokens, reasoning_tokens, latency_ms)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := db.Conn.Exec(query, r.UserID, r.ChatID, r.ThreadID, r.Purpose, r.Provider, r.Model, r.KeyIndex,
+		r.PromptTokens, r.CompletionTokens, r.ReasoningTokens, r.Latency.Milliseconds())
+	return err
+}
+
+// UsageTotals sums the ledger per groupBy column (one of the UsageBy
+// constants) and model, largest token count first.
+func (db *DB) UsageTotals(f UsageFilter, groupBy string) ([]UsageTotal, error) {
+	key := "''"
+	switch groupBy {
+	case UsageByModel:
+	case UsageByUser, UsageByChat, UsageByPurpose:
+		key = "CAST(" + groupBy + " AS TEXT)"
+	default:
+		return nil, fmt.Errorf("cannot group usage by %q", groupBy)
+	}
+
+	where, args := f.where()
+	query := `SELECT ` + key + ` AS k, model, COUNT(*), SUM(prompt_tokens), SUM(completion_tokens),
+			SUM(reasoning_tokens), AVG(latency_ms)
+		FROM token_usage WHERE ` + where + `
+		GROUP BY k, model
+		ORDER BY SUM(prompt_tokens + completion_tokens) DESC`
+	rows, err := db.Conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var totals []UsageTotal
+	for rows.Next() {
+		var t UsageTotal
+		var latencyMs float64
+		if err := rows.Scan(&t.Key, &t.Model, &t.Requests, &t.PromptTokens, &t.CompletionTokens,
+			&t.ReasoningTokens, &latencyMs); err != nil {
+			return nil, err
+		}
+		t.Latency = time.Duration(latencyMs * float64(time.Millisecond))
+		totals = append(totals, t)
+	}
+	return totals, rows.Err()
+}
@@ -0,0 +1,95 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUsageLedger(t *testing.T) {
+	db := openTestDB(t)
+	for _, r := range []UsageRecord{
+		{UserID: 1, ChatID: 100, Purpose: "chat", Model: "a", PromptTokens: 100, CompletionTokens: 50, ReasoningTokens: 10, Latency: 200 * time.Millisecond},
+		{UserID: 1, ChatID: 100, Purpose: "chat", Model: "a", PromptTokens: 300, CompletionTokens: 50, Latency: 400 * time.Millisecond},
+		{UserID: 1, ChatID: 100, Purpose: "title", Model: "b", PromptTokens: 20, CompletionTokens: 5},
+		{UserID: 2, ChatID: 200, Purpose: "chat", Model: "a", PromptTokens: 1000, CompletionTokens: 100},
+	} {
+		if err := db.AddUsage(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	byModel, err := db.UsageTotals(UsageFilter{UserID: 1}, UsageByModel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []UsageTotal{
+		{Model: "a", Requests: 2, PromptTokens: 400, CompletionTokens: 100, ReasoningTokens: 10, Latency: 300 * time.Millisecond},
+		{Model: "b", Requests: 1, PromptTokens: 20, CompletionTokens: 5},
+	}
+	if len(byModel) != len(want) || byModel[0] != want[0] || byModel[1] != want[1] {
+		t.Errorf("by model: got %+v", byModel)
+	}
+
+	// Largest first, keyed by the grouping column
+	byUser, _ := db.UsageTotals(UsageFilter{}, UsageByUser)
+	if len(byUser) != 3 || byUser[0].Key != "2" || byUser[0].PromptTokens != 1000 {
+		t.Errorf("by user: got %+v", byUser)
+	}
+	byChat, _ := db.UsageTotals(UsageFilter{ChatID: 100}, UsageByChat)
+	if len(byChat) != 2 || byChat[0].Key != "100" {
+		t.Errorf("by chat: got %+v", byChat)
+	}
+	if _, err := db.UsageTotals(UsageFilter{}, "model; DROP TABLE token_usage"); err == nil {
+		t.Error("unknown grouping accepted")
+	}
+
+	if tokens, _ := db.UsageTokens(UsageFilter{}); tokens != 1625 {
+		t.Errorf("all tokens %d, want 1625", tokens)
+	}
+}
+
+func TestUsageByDay(t *testing.T) {
+	db := openTestDB(t)
+	now := time.Now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	add := func(at time.Time, tokens int) {
+		t.Helper()
+		if err := db.AddUsage(UsageRecord{UserID: 1, Model: "a", PromptTokens: tokens}); err != nil {
+			t.Fatal(err)
+		}
+		_, err := db.Conn.Exec(`UPDATE token_usage SET created_at = ? WHERE id = (SELECT MAX(id) FROM token_usage)`, at.Format(sqliteTime))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	add(today.Add(-time.Second), 1)   // last second of yesterday
+	add(today, 10)                    // first second of today
+	add(today.Add(12*time.Hour), 100) // noon
+	add(today.AddDate(0, 0, -29).Add(time.Hour), 1000)
+	add(today.AddDate(0, 0, -40), 10000)
+
+	for _, tt := range []struct {
+		name string
+		f    UsageFilter
+		want int
+	}{
+		{"today", UsageFilter{Since: today}, 110},
+		{"yesterday", UsageFilter{Since: today.AddDate(0, 0, -1), Until: today}, 1},
+		{"last 30 days", UsageFilter{Since: today.AddDate(0, 0, -29)}, 1111},
+		{"local time zone", UsageFilter{Since: today.In(time.FixedZone("UTC+7", 7*3600))}, 110},
+		{"other user", UsageFilter{Since: today, UserID: 2}, 0},
+	} {
+		if got, err := db.UsageTokens(tt.f); err != nil || got != tt.want {
+			t.Errorf("%s: got %d, %v, want %d", tt.name, got, err, tt.want)
+		}
+		totals, _ := db.UsageTotals(tt.f, UsageByModel)
+		sum := 0
+		for _, total := range totals {
+			sum += total.PromptTokens
+		}
+		if sum != tt.want {
+			t.Errorf("%s: totals sum to %d, want %d", tt.name, sum, tt.want)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package documents
+
+import (
+	"strings"
+)
+
+// Chunk splits text into pieces of about size characters, preferring
+// paragraph, then line, then word boundaries. Consecutive chunks share
+// overlap characters so a sentence cut at a boundary is still found.
+func Chunk(text string, size, overlap int) []string {
+	if size <= 0 {
+		size = 1500
+	}
+	if overlap < 0 || overlap >= size {
+		overlap = 0
+	}
+
+	runes := []rune(strings.TrimSpace(text))
+	var chunks []string
+	for start := 0; start < len(runes); {
+		end := start + size
+		if end >= len(runes) {
+			chunks = append(chunks, strings.TrimSpace(string(runes[start:])))
+			break
+		}
+		end = cutPoint(runes, start, end)
+		chunks = append(chunks, strings.TrimSpace(string(runes[start:end])))
+
+		next := end - overlap
+		if next <= start {
+			next = end
+		}
+		// Start the overlap at a word boundary
+		for next < end && next > start && runes[next-1] != ' ' && runes[next-1] != '\n' {
+			next++
+		}
+		start = next
+	}
+	return chunks
+}
+
+// cutPoint moves end back to the best boundary in the second half of the
+// chunk: a blank line, a line break, then a space.
+func cutPoint(runes []rune, start, end int) int {
+	min := start + (end-start)/2
+	for _, sep := range []string{"\n\n", "\n", " "} {
+		s := []rune(sep)
+		for i := end; i > min; i-- {
+			if i-len(s) >= start && string(runes[i-len(s):i]) == sep {
+				return i
+			}
+		}
+	}
+	return end
+}
@@ -0,0 +1,101 @@
+// Package documents turns files sent to the bot into text the model can
+// read: local text extraction (plain text, code, PDF), chunking of long
+// documents and keyword ranking of the chunks for a question.
+package documents
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrUnsupported is returned for files that are neither text nor PDF.
+var ErrUnsupported = errors.New("unsupported document type")
+
+// ErrNoText is returned when a file contains no extractable text, e.g. a
+// scanned PDF.
+var ErrNoText = errors.New("no text found in document")
+
+// textExtensions are read as UTF-8 text regardless of the MIME type
+// Telegram reports (often application/octet-stream for code).
+var textExtensions = map[string]bool{
+	".txt": true, ".md": true, ".markdown": true, ".rst": true, ".log": true,
+	".csv": true, ".tsv": true, ".json": true, ".jsonl": true, ".xml": true,
+	".yaml": true, ".yml": true, ".toml": true, ".ini": true, ".cfg": true, ".conf": true,
+	".html": true, ".htm": true, ".css": true, ".scss": true, ".sql": true,
+	".go": true, ".py": true, ".js": true, ".jsx": true, ".ts": true, ".tsx": true,
+	".java": true, ".kt": true, ".kts": true, ".swift": true, ".c": true, ".h": true,
+	".cpp": true, ".cc": true, ".hpp": true, ".cs": true, ".rs": true, ".rb": true,
+	".php": true, ".lua": true, ".dart": true, ".scala": true, ".r": true,
+	".sh": true, ".bash": true, ".zsh": true, ".ps1": true, ".bat": true,
+	".dockerfile": true, ".gradle": true, ".proto": true, ".graphql": true, ".vue": true,
+	".svelte": true, ".tf": true, ".mod": true, ".sum": true,
+}
+
+// textNames are extensionless files that are text
+var textNames = map[string]bool{
+	"dockerfile": true, "makefile": true, "readme": true, "license": true, ".gitignore": true,
+}
+
+// IsSupported reports whether Extract can handle the file.
+func IsSupported(filename, mimeType string) bool {
+	return isPDF(filename, mimeType) || isText(filename, mimeType)
+}
+
+func isPDF(filename, mimeType string) bool {
+	return mimeType == "application/pdf" || strings.EqualFold(filepath.Ext(filename), ".pdf")
+}
+
+func isText(filename, mimeType string) bool {
+	name := strings.ToLower(filepath.Base(filename))
+	if textExtensions[filepath.Ext(name)] || textNames[name] {
+		return true
+	}
+	return strings.HasPrefix(mimeType, "text/") || mimeType == "application/json" ||
+		mimeType == "application/xml" || mimeType == "application/x-yaml"
+}
+
+// Extract returns the text of a file.
+func Extract(filename, mimeType string, data []byte) (string, error) {
+	var text string
+	switch {
+	case isPDF(filename, mimeType):
+		var err error
+		if text, err = ExtractPDF(data); err != nil {
+			return "", err
+		}
+	case isText(filename, mimeType):
+		if !utf8.Valid(data) {
+			return "", errors.New("file is not valid UTF-8 text")
+		}
+		text = strings.ReplaceAll(string(data), "\r\n", "\n")
+		text = strings.ReplaceAll(text, "\x00", "")
+		text = strings.TrimPrefix(text, "\uFEFF")
+	default:
+		return "", ErrUnsupported
+	}
+
+	if strings.TrimSpace(text) == "" {
+		return "", ErrNoText
+	}
+	return text, nil
+}
+
+// CodeLanguage returns a fence language for source files, "" otherwise.
+func CodeLanguage(filename string) string {
+	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(filename)), ".")
+	switch ext {
+	case "", "txt", "md", "markdown", "rst", "log", "pdf":
+		return ""
+	case "yml":
+		return "yaml"
+	case "htm":
+		return "html"
+	case "h":
+		return "c"
+	case "hpp", "cc":
+		return "cpp"
+	}
+	return ext
+}
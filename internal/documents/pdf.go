@@ -0,0 +1,862 @@
+package documents
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// This is a small PDF text extractor, enough for documents produced by
+// word processors, LaTeX and browsers "print to PDF". It reads classic and
+// compressed (object stream) objects, FlateDecode streams, the text
+// operators of page content streams and ToUnicode CMaps. It does not do
+// OCR, so scanned PDFs yield no text.
+
+var (
+	reObjHeader   = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+	reRef         = regexp.MustCompile(`^\s*(\d+)\s+\d+\s+R`)
+	reLength      = regexp.MustCompile(`/Length\s+(\d+)(\s+\d+\s+R)?`)
+	reTypePage    = regexp.MustCompile(`/Type\s*/Page\b`)
+	reNamedRef    = regexp.MustCompile(`/([^\s/<>\[\]()]+)\s+(\d+)\s+\d+\s+R`)
+	reHexPair     = regexp.MustCompile(`<([0-9A-Fa-f]+)>\s*<([0-9A-Fa-f]+)>`)
+	reHexTriple   = regexp.MustCompile(`<([0-9A-Fa-f]+)>\s*<([0-9A-Fa-f]+)>\s*<([0-9A-Fa-f]+)>`)
+	reHexArrRange = regexp.MustCompile(`<([0-9A-Fa-f]+)>\s*<([0-9A-Fa-f]+)>\s*\[([^\]]*)\]`)
+	reHexString   = regexp.MustCompile(`<([0-9A-Fa-f]*)>`)
+	reRefAll      = regexp.MustCompile(`(\d+)\s+\d+\s+R`)
+)
+
+// maxPDFDecoded caps the decompressed stream data of one file, so a small
+// PDF full of deflate bombs can't exhaust memory.
+const maxPDFDecoded = 64 << 20
+
+var errEncryptedPDF = errors.New("the PDF is encrypted")
+
+// ErrPDFTooLarge is returned when the streams of a PDF decompress to more
+// than maxPDFDecoded bytes.
+var ErrPDFTooLarge = errors.New("the PDF decompresses to too much data")
+
+type pdfObject struct {
+	dict     string // the object without its stream, as text
+	isStream bool
+	raw      []byte // stream data as stored in the file
+	decoded  bool   // data is set, see pdfFile.stream
+	data     []byte // decoded stream data, nil if not decodable
+}
+
+type pdfFile struct {
+	objects map[int]*pdfObject
+	cmaps   map[int]*cmap // by ToUnicode stream object number
+	// budget is what is left of maxPDFDecoded; err is set once it runs out
+	budget int
+	err    error
+}
+
+// ExtractPDF returns the text of a PDF, pages separated by blank lines.
+func ExtractPDF(data []byte) (string, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(data, "\x00\t\r\n "), []byte("%PDF")) {
+		return "", errors.New("not a PDF file")
+	}
+	if bytes.Contains(data, []byte("/Encrypt")) {
+		return "", errEncryptedPDF
+	}
+
+	f := &pdfFile{objects: make(map[int]*pdfObject), cmaps: make(map[int]*cmap), budget: maxPDFDecoded}
+	f.readObjects(data)
+	f.readObjectStreams()
+	if f.err != nil {
+		return "", f.err
+	}
+
+	var pages []string
+	for _, num := range f.pageOrder() {
+		text := strings.TrimSpace(f.pageText(num))
+		if f.err != nil {
+			return "", f.err
+		}
+		if text != "" {
+			pages = append(pages, text)
+		}
+	}
+	return strings.Join(pages, "\n\n"), nil
+}
+
+// readObjects parses every "N G obj ... endobj" in the file body. Streams
+// are kept as they are and decoded when needed.
+func (f *pdfFile) readObjects(data []byte) {
+	locs := reObjHeader.FindAllSubmatchIndex(data, -1)
+	for i, loc := range locs {
+		num, _ := strconv.Atoi(string(data[loc[2]:loc[3]]))
+		bodyStart := loc[1]
+		bodyEnd := len(data)
+		if i+1 < len(locs) {
+			bodyEnd = locs[i+1][0]
+		}
+		body := data[bodyStart:bodyEnd]
+
+		obj := &pdfObject{}
+		streamAt := indexKeyword(body, "stream")
+		endObjAt := bytes.Index(body, []byte("endobj"))
+		if streamAt < 0 || (endObjAt >= 0 && endObjAt < streamAt) {
+			if endObjAt >= 0 {
+				body = body[:endObjAt]
+			}
+			obj.dict = string(body)
+			f.objects[num] = obj
+			continue
+		}
+
+		obj.dict = string(body[:streamAt])
+		obj.isStream = true
+		raw := body[streamAt+len("stream"):]
+		raw = bytes.TrimPrefix(raw, []byte("\r"))
+		raw = bytes.TrimPrefix(raw, []byte("\n"))
+
+		if m := reLength.FindStringSubmatch(obj.dict); m != nil && m[2] == "" {
+			if n, err := strconv.Atoi(m[1]); err == nil && n <= len(raw) {
+				raw = raw[:n]
+			}
+		} else if end := bytes.Index(raw, []byte("endstream")); end >= 0 {
+			raw = bytes.TrimRight(raw[:end], "\r\n")
+		}
+		obj.raw = raw
+		f.objects[num] = obj
+	}
+}
+
+// indexKeyword finds "stream" as a keyword, not inside "endstream".
+func indexKeyword(b []byte, kw string) int {
+	off := 0
+	for {
+		i := bytes.Index(b[off:], []byte(kw))
+		if i < 0 {
+			return -1
+		}
+		i += off
+		if i < 3 || string(b[i-3:i]) != "end" {
+			return i
+		}
+		off = i + len(kw)
+	}
+}
+
+// stream returns the decoded data of a stream object, decoding it on
+// first use. Nil for non-stream objects.
+func (f *pdfFile) stream(obj *pdfObject) []byte {
+	if obj == nil || !obj.isStream {
+		return nil
+	}
+	if !obj.decoded {
+		obj.data = f.decodeStream(obj.dict, obj.raw)
+		obj.decoded = true
+	}
+	return obj.data
+}
+
+// decodeStream undoes FlateDecode within the budget of the file. Streams
+// with other filters (images, fonts) are not needed for text and come
+// back nil.
+func (f *pdfFile) decodeStream(dict string, raw []byte) []byte {
+	if !strings.Contains(dict, "/Filter") {
+		return raw
+	}
+	if !strings.Contains(dict, "/FlateDecode") || strings.Contains(dict, "/DCTDecode") || f.err != nil {
+		return nil
+	}
+	r, err := zlib.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return nil
+	}
+	defer r.Close()
+	// A truncated stream still gives useful text up to the error
+	out, _ := io.ReadAll(io.LimitReader(r, int64(f.budget)+1))
+	if len(out) > f.budget {
+		f.budget, f.err = 0, ErrPDFTooLarge
+		return nil
+	}
+	f.budget -= len(out)
+	return out
+}
+
+// readObjectStreams unpacks objects stored inside /Type /ObjStm streams
+// (PDF 1.5+), which is where modern writers put page and font dicts.
+func (f *pdfFile) readObjectStreams() {
+	var streams []*pdfObject
+	for _, obj := range f.objects {
+		if obj.isStream && strings.Contains(obj.dict, "/ObjStm") {
+			streams = append(streams, obj)
+		}
+	}
+	for _, obj := range streams {
+		data := f.stream(obj)
+		first := dictInt(obj.dict, "First")
+		count := dictInt(obj.dict, "N")
+		if first <= 0 || first > len(data) {
+			continue
+		}
+
+		header := strings.Fields(string(data[:first]))
+		type entry struct{ num, off int }
+		var entries []entry
+		for i := 0; i+1 < len(header) && len(entries) < count; i += 2 {
+			num, err1 := strconv.Atoi(header[i])
+			off, err2 := strconv.Atoi(header[i+1])
+			if err1 == nil && err2 == nil {
+				entries = append(entries, entry{num, off})
+			}
+		}
+		for i, e := range entries {
+			start := first + e.off
+			end := len(data)
+			if i+1 < len(entries) {
+				end = first + entries[i+1].off
+			}
+			if start < 0 || start > end || end > len(data) {
+				continue
+			}
+			if _, exists := f.objects[e.num]; !exists {
+				f.objects[e.num] = &pdfObject{dict: string(data[start:end])}
+			}
+		}
+	}
+}
+
+// keyEnd returns the index just after the name /key in dict, -1 if the
+// dict has no such key (/Font does not match /FontFile).
+func keyEnd(dict, key string) int {
+	name := "/" + key
+	for off := 0; ; {
+		i := strings.Index(dict[off:], name)
+		if i < 0 {
+			return -1
+		}
+		end := off + i + len(name)
+		if end == len(dict) || isPDFSpace(dict[end]) || isPDFDelim(dict[end]) {
+			return end
+		}
+		off = end
+	}
+}
+
+func dictInt(dict, key string) int {
+	end := keyEnd(dict, key)
+	if end < 0 {
+		return 0
+	}
+	rest := strings.TrimLeft(dict[end:], " \t\r\n")
+	i := 0
+	for i < len(rest) && rest[i] >= '0' && rest[i] <= '9' {
+		i++
+	}
+	n, _ := strconv.Atoi(rest[:i])
+	return n
+}
+
+// dictValue returns the text after /key: an inline << >> dict, [ ] array
+// or the first token.
+func dictValue(dict, key string) string {
+	end := keyEnd(dict, key)
+	if end < 0 {
+		return ""
+	}
+	rest := strings.TrimLeft(dict[end:], " \t\r\n")
+	switch {
+	case strings.HasPrefix(rest, "<<"):
+		return balanced(rest, "<<", ">>")
+	case strings.HasPrefix(rest, "["):
+		return balanced(rest, "[", "]")
+	}
+	if m := reRef.FindString(rest); m != "" {
+		return m
+	}
+	if i := strings.IndexAny(rest, " \t\r\n/>"); i > 0 {
+		return rest[:i]
+	}
+	return rest
+}
+
+func balanced(s, open, close string) string {
+	depth := 0
+	for i := 0; i < len(s); {
+		switch {
+		case strings.HasPrefix(s[i:], open):
+			depth++
+			i += len(open)
+		case strings.HasPrefix(s[i:], close):
+			depth--
+			i += len(close)
+			if depth == 0 {
+				return s[:i]
+			}
+		default:
+			i++
+		}
+	}
+	return s
+}
+
+// resolve follows an indirect reference "N 0 R" to the object's dict.
+func (f *pdfFile) resolve(value string) string {
+	if m := reRef.FindStringSubmatch(value); m != nil {
+		num, _ := strconv.Atoi(m[1])
+		if obj := f.objects[num]; obj != nil {
+			return obj.dict
+		}
+		return ""
+	}
+	return value
+}
+
+func refNumbers(value string) []int {
+	var nums []int
+	for _, m := range reRefAll.FindAllStringSubmatch(value, -1) {
+		n, _ := strconv.Atoi(m[1])
+		nums = append(nums, n)
+	}
+	return nums
+}
+
+// pageOrder walks the page tree from the catalog; if that fails it falls
+// back to every page object in object number order.
+func (f *pdfFile) pageOrder() []int {
+	var pages []int
+	seen := make(map[int]bool)
+	var walk func(num int)
+	walk = func(num int) {
+		obj := f.objects[num]
+		if obj == nil || seen[num] {
+			return
+		}
+		seen[num] = true
+		if reTypePage.MatchString(obj.dict) {
+			pages = append(pages, num)
+			return
+		}
+		for _, kid := range refNumbers(dictValue(obj.dict, "Kids")) {
+			walk(kid)
+		}
+	}
+
+	for _, obj := range f.objects {
+		if strings.Contains(obj.dict, "/Catalog") {
+			for _, root := range refNumbers(dictValue(obj.dict, "Pages")) {
+				walk(root)
+			}
+			break
+		}
+	}
+	if len(pages) > 0 {
+		return pages
+	}
+
+	for num, obj := range f.objects {
+		if reTypePage.MatchString(obj.dict) {
+			pages = append(pages, num)
+		}
+	}
+	sort.Ints(pages)
+	return pages
+}
+
+// pageFonts maps font resource names of a page to their ToUnicode CMaps.
+// Resources may be inherited from a parent /Pages node.
+func (f *pdfFile) pageFonts(pageDict string) map[string]*cmap {
+	fonts := make(map[string]*cmap)
+	dict := pageDict
+	for depth := 0; depth < 16 && dict != ""; depth++ {
+		if res := f.resolve(dictValue(dict, "Resources")); res != "" {
+			fontDict := f.resolve(dictValue(res, "Font"))
+			for _, m := range reNamedRef.FindAllStringSubmatch(fontDict, -1) {
+				if _, ok := fonts[m[1]]; ok {
+					continue
+				}
+				num, _ := strconv.Atoi(m[2])
+				if font := f.objects[num]; font != nil {
+					fonts[m[1]] = f.toUnicode(font.dict)
+				}
+			}
+			break
+		}
+		dict = f.resolve(dictValue(dict, "Parent"))
+	}
+	return fonts
+}
+
+func (f *pdfFile) toUnicode(fontDict string) *cmap {
+	nums := refNumbers(dictValue(fontDict, "ToUnicode"))
+	if len(nums) == 0 {
+		// Type0 fonts keep the CMap on the font, descendants don't have one
+		return nil
+	}
+	if cm, ok := f.cmaps[nums[0]]; ok {
+		return cm
+	}
+	var cm *cmap
+	if data := f.stream(f.objects[nums[0]]); data != nil {
+		cm = parseCMap(data)
+	}
+	f.cmaps[nums[0]] = cm
+	return cm
+}
+
+func (f *pdfFile) pageText(num int) string {
+	page := f.objects[num].dict
+	fonts := f.pageFonts(page)
+
+	var content []byte
+	for _, c := range refNumbers(dictValue(page, "Contents")) {
+		obj := f.objects[c]
+		if obj == nil {
+			continue
+		}
+		if !obj.isStream {
+			// /Contents may point to an array object of streams
+			for _, inner := range refNumbers(obj.dict) {
+				content = append(content, f.stream(f.objects[inner])...)
+				content = append(content, '\n')
+			}
+			continue
+		}
+		content = append(content, f.stream(obj)...)
+		content = append(content, '\n')
+	}
+	return contentText(content, fonts)
+}
+
+// cmap is a parsed ToUnicode CMap
+type cmap struct {
+	codeLen int // bytes per character code, 1 or 2
+	chars   map[uint32]string
+}
+
+func parseCMap(data []byte) *cmap {
+	s := string(data)
+	cm := &cmap{codeLen: 1, chars: make(map[uint32]string)}
+
+	if sec := section(s, "begincodespacerange", "endcodespacerange"); sec != "" {
+		if m := reHexPair.FindStringSubmatch(sec); m != nil && len(m[1]) >= 4 {
+			cm.codeLen = 2
+		}
+	}
+
+	for _, sec := range sections(s, "beginbfchar", "endbfchar") {
+		for _, m := range reHexPair.FindAllStringSubmatch(sec, -1) {
+			cm.chars[hexUint(m[1])] = utf16Hex(m[2])
+			if len(m[1]) >= 4 {
+				cm.codeLen = 2
+			}
+		}
+	}
+
+	for _, sec := range sections(s, "beginbfrange", "endbfrange") {
+		for _, m := range reHexArrRange.FindAllStringSubmatch(sec, -1) {
+			lo, hi := hexUint(m[1]), hexUint(m[2])
+			dsts := reHexString.FindAllStringSubmatch(m[3], -1)
+			for i := 0; lo+uint32(i) <= hi && i < len(dsts); i++ {
+				cm.chars[lo+uint32(i)] = utf16Hex(dsts[i][1])
+			}
+		}
+		sec = reHexArrRange.ReplaceAllString(sec, "")
+		for _, m := range reHexTriple.FindAllStringSubmatch(sec, -1) {
+			lo, hi := hexUint(m[1]), hexUint(m[2])
+			base := []rune(utf16Hex(m[3]))
+			if len(base) == 0 || hi < lo || hi-lo > 0xFFFF {
+				continue
+			}
+			for c := lo; c <= hi; c++ {
+				r := append([]rune{}, base...)
+				r[len(r)-1] += rune(c - lo)
+				cm.chars[c] = string(r)
+			}
+			if len(m[1]) >= 4 {
+				cm.codeLen = 2
+			}
+		}
+	}
+	return cm
+}
+
+func section(s, begin, end string) string {
+	all := sections(s, begin, end)
+	if len(all) == 0 {
+		return ""
+	}
+	return all[0]
+}
+
+func sections(s, begin, end string) []string {
+	var out []string
+	for {
+		i := strings.Index(s, begin)
+		if i < 0 {
+			return out
+		}
+		s = s[i+len(begin):]
+		j := strings.Index(s, end)
+		if j < 0 {
+			return append(out, s)
+		}
+		out = append(out, s[:j])
+		s = s[j+len(end):]
+	}
+}
+
+func hexUint(h string) uint32 {
+	n, _ := strconv.ParseUint(h, 16, 32)
+	return uint32(n)
+}
+
+func hexBytes(h string) []byte {
+	if len(h)%2 == 1 {
+		h += "0"
+	}
+	out := make([]byte, len(h)/2)
+	for i := range out {
+		n, _ := strconv.ParseUint(h[2*i:2*i+2], 16, 8)
+		out[i] = byte(n)
+	}
+	return out
+}
+
+func utf16Hex(h string) string {
+	return decodeUTF16(hexBytes(h))
+}
+
+func decodeUTF16(b []byte) string {
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		units = append(units, uint16(b[i])<<8|uint16(b[i+1]))
+	}
+	return string(utf16.Decode(units))
+}
+
+// winAnsiHigh maps the 0x80-0x9F range of WinAnsiEncoding, which differs
+// from Latin-1, for the characters that actually show up in text.
+var winAnsiHigh = map[byte]rune{
+	0x80: '€', 0x85: '…', 0x91: '‘', 0x92: '’', 0x93: '“', 0x94: '”',
+	0x95: '•', 0x96: '–', 0x97: '—', 0x99: '™',
+}
+
+// decodeText converts a string operand using the font's CMap, or as
+// WinAnsi/Latin-1 when the font has none.
+func decodeText(b []byte, cm *cmap) string {
+	if len(b) >= 2 && b[0] == 0xFE && b[1] == 0xFF {
+		return decodeUTF16(b[2:])
+	}
+	var sb strings.Builder
+	if cm != nil && len(cm.chars) > 0 {
+		for i := 0; i+cm.codeLen <= len(b); i += cm.codeLen {
+			code := uint32(b[i])
+			if cm.codeLen == 2 {
+				code = code<<8 | uint32(b[i+1])
+			}
+			if s, ok := cm.chars[code]; ok {
+				sb.WriteString(s)
+			}
+		}
+		return sb.String()
+	}
+	for _, c := range b {
+		if r, ok := winAnsiHigh[c]; ok {
+			sb.WriteRune(r)
+		} else if c >= 0x20 || c == '\t' {
+			sb.WriteRune(rune(c))
+		}
+	}
+	return sb.String()
+}
+
+// operand is one value on the content stream operand stack
+type operand struct {
+	str    []byte    // string operand
+	isStr  bool      // str is set
+	num    float64   // number operand
+	isNum  bool      // num is set
+	name   string    // name operand, without "/"
+	array  []operand // array operand
+	isArry bool
+}
+
+// contentText runs the text operators of a content stream.
+func contentText(data []byte, fonts map[string]*cmap) string {
+	lx := &lexer{data: data}
+	var out strings.Builder
+	var stack []operand
+	var font *cmap
+	lastY, haveY := 0.0, false
+
+	newline := func() {
+		s := out.String()
+		if s != "" && !strings.HasSuffix(s, "\n") {
+			out.WriteString("\n")
+		}
+	}
+	space := func() {
+		s := out.String()
+		if s != "" && !strings.HasSuffix(s, " ") && !strings.HasSuffix(s, "\n") {
+			out.WriteString(" ")
+		}
+	}
+	show := func(op operand) {
+		if op.isStr {
+			out.WriteString(decodeText(op.str, font))
+		}
+	}
+
+	for {
+		tok, ok := lx.next()
+		if !ok {
+			break
+		}
+		if tok.op == "" {
+			stack = append(stack, tok.operand)
+			continue
+		}
+
+		switch tok.op {
+		case "Tf":
+			if len(stack) >= 2 {
+				font = fonts[stack[len(stack)-2].name]
+			}
+		case "Tj":
+			if len(stack) >= 1 {
+				show(stack[len(stack)-1])
+			}
+		case "'", "\"":
+			newline()
+			if len(stack) >= 1 {
+				show(stack[len(stack)-1])
+			}
+		case "TJ":
+			if len(stack) >= 1 {
+				for _, el := range stack[len(stack)-1].array {
+					if el.isNum && el.num < -200 {
+						space()
+					}
+					show(el)
+				}
+			}
+		case "Td", "TD":
+			if len(stack) >= 2 && stack[len(stack)-1].num != 0 {
+				newline()
+			} else {
+				space()
+			}
+		case "T*":
+			newline()
+		case "Tm":
+			if len(stack) >= 6 {
+				y := stack[len(stack)-1].num
+				if haveY && y != lastY {
+					newline()
+				} else {
+					space()
+				}
+				lastY, haveY = y, true
+			}
+		case "ET":
+			space()
+		case "BI":
+			lx.skipInlineImage()
+		}
+		stack = stack[:0]
+	}
+
+	return cleanExtracted(out.String())
+}
+
+type token struct {
+	operand
+	op string // operator name, "" for operands
+}
+
+type lexer struct {
+	data []byte
+	pos  int
+}
+
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isPDFDelim(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+func (l *lexer) next() (token, bool) {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		switch {
+		case isPDFSpace(c):
+			l.pos++
+		case c == '%':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		case c == '(':
+			return token{operand: operand{str: l.literal(), isStr: true}}, true
+		case c == '<' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '<':
+			// dictionaries only appear as operands of marked content,
+			// which we ignore
+			l.skipDict()
+		case c == '<':
+			end := bytes.IndexByte(l.data[l.pos:], '>')
+			if end < 0 {
+				l.pos = len(l.data)
+				return token{}, false
+			}
+			h := strings.Join(strings.Fields(string(l.data[l.pos+1:l.pos+end])), "")
+			l.pos += end + 1
+			return token{operand: operand{str: hexBytes(h), isStr: true}}, true
+		case c == '[':
+			l.pos++
+			var arr []operand
+			for {
+				tok, ok := l.next()
+				if !ok || tok.op == "]" {
+					break
+				}
+				if tok.op == "" {
+					arr = append(arr, tok.operand)
+				}
+			}
+			return token{operand: operand{array: arr, isArry: true}}, true
+		case c == ']':
+			l.pos++
+			return token{op: "]"}, true
+		case c == '/':
+			start := l.pos + 1
+			l.pos++
+			for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelim(l.data[l.pos]) {
+				l.pos++
+			}
+			return token{operand: operand{name: string(l.data[start:l.pos])}}, true
+		case c == '{' || c == '}' || c == ')' || c == '>':
+			l.pos++
+		default:
+			start := l.pos
+			for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelim(l.data[l.pos]) {
+				l.pos++
+			}
+			word := string(l.data[start:l.pos])
+			if n, err := strconv.ParseFloat(word, 64); err == nil {
+				return token{operand: operand{num: n, isNum: true}}, true
+			}
+			return token{op: word}, true
+		}
+	}
+	return token{}, false
+}
+
+// literal reads a (string) with nested parentheses and escapes.
+func (l *lexer) literal() []byte {
+	l.pos++ // (
+	var out []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return out
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return out
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				out = append(out, '\n')
+			case 'r':
+				out = append(out, '\r')
+			case 't':
+				out = append(out, '\t')
+			case 'b', 'f':
+			case '\r', '\n':
+				// line continuation
+				if e == '\r' && l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+			default:
+				if e >= '0' && e <= '7' {
+					n := int(e - '0')
+					for k := 0; k < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; k++ {
+						n = n*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					out = append(out, byte(n))
+				} else {
+					out = append(out, e)
+				}
+			}
+			continue
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+func (l *lexer) skipDict() {
+	depth := 0
+	for l.pos+1 < len(l.data) {
+		if l.data[l.pos] == '<' && l.data[l.pos+1] == '<' {
+			depth++
+			l.pos += 2
+			continue
+		}
+		if l.data[l.pos] == '>' && l.data[l.pos+1] == '>' {
+			depth--
+			l.pos += 2
+			if depth == 0 {
+				return
+			}
+			continue
+		}
+		l.pos++
+	}
+	l.pos = len(l.data)
+}
+
+// skipInlineImage jumps over "ID <binary> EI" after a BI operator.
+func (l *lexer) skipInlineImage() {
+	id := bytes.Index(l.data[l.pos:], []byte("ID"))
+	if id < 0 {
+		l.pos = len(l.data)
+		return
+	}
+	l.pos += id + 2
+	for l.pos < len(l.data) {
+		ei := bytes.Index(l.data[l.pos:], []byte("EI"))
+		if ei < 0 {
+			l.pos = len(l.data)
+			return
+		}
+		at := l.pos + ei
+		l.pos = at + 2
+		if at > 0 && isPDFSpace(l.data[at-1]) && (l.pos >= len(l.data) || isPDFSpace(l.data[l.pos])) {
+			return
+		}
+	}
+}
+
+var reManyBlank = regexp.MustCompile(`\n{3,}`)
+
+// cleanExtracted trims every line and collapses runs of blank lines.
+func cleanExtracted(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.Join(strings.Fields(line), " ")
+	}
+	return strings.TrimSpace(reManyBlank.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
@@ -0,0 +1,175 @@
+package documents
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// buildPDF numbers objs from 1 and wraps them in a minimal PDF file; an
+// empty string leaves its number out. The parser does not need the xref
+// table.
+func buildPDF(objs ...string) []byte {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.7\n")
+	for i, o := range objs {
+		if o == "" {
+			continue
+		}
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, o)
+	}
+	b.WriteString("trailer\n<< /Root 1 0 R >>\n%%EOF\n")
+	return b.Bytes()
+}
+
+func deflate(data []byte) []byte {
+	var b bytes.Buffer
+	w := zlib.NewWriter(&b)
+	w.Write(data)
+	w.Close()
+	return b.Bytes()
+}
+
+// flateStream is a FlateDecode stream object; extra goes into its dict.
+func flateStream(data []byte, extra string) string {
+	z := deflate(data)
+	return fmt.Sprintf("<< %s /Filter /FlateDecode /Length %d >>\nstream\n%s\nendstream", extra, len(z), z)
+}
+
+func plainStream(data string) string {
+	return fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(data), data)
+}
+
+func TestExtractPDFFlatePage(t *testing.T) {
+	pdf := buildPDF(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /Resources << /Font << /F1 5 0 R >> >> /Contents 4 0 R >>",
+		flateStream([]byte("BT /F1 12 Tf 72 700 Td (Hello, world) Tj 0 -14 Td [(Second) -300 (line)] TJ ET"), ""),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+	)
+	text, err := ExtractPDF(pdf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Hello, world\nSecond line"; text != want {
+		t.Errorf("got %q, want %q", text, want)
+	}
+}
+
+func TestExtractPDFObjectStream(t *testing.T) {
+	// Objects 2 (Pages), 3 and 4 (Page) live in the object stream 7;
+	// the page tree lists page 4 first
+	bodies := []string{
+		"<< /Type /Pages /Kids [4 0 R 3 0 R] /Count 2 >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 6 0 R >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 5 0 R >>",
+	}
+	var header, body strings.Builder
+	for i, num := range []int{2, 3, 4} {
+		fmt.Fprintf(&header, "%d %d ", num, body.Len())
+		body.WriteString(bodies[i] + "\n")
+	}
+	objStm := header.String() + body.String()
+
+	pdf := buildPDF(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"", "", "",
+		flateStream([]byte("BT (First page) Tj ET"), ""),
+		flateStream([]byte("BT (Second page) Tj ET"), ""),
+		flateStream([]byte(objStm), fmt.Sprintf("/Type /ObjStm /N 3 /First %d", header.Len())),
+	)
+
+	text, err := ExtractPDF(pdf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "First page\n\nSecond page"; text != want {
+		t.Errorf("got %q, want %q", text, want)
+	}
+}
+
+func TestExtractPDFToUnicode(t *testing.T) {
+	cmap := `/CIDInit /ProcSet findresource begin
+begincmap
+1 begincodespacerange
+<0000> <FFFF>
+endcodespacerange
+2 beginbfchar
+<0001> <0048>
+<0002> <0069>
+endbfchar
+1 beginbfrange
+<0003> <0004> <00E9>
+endbfrange
+2 beginbfrange
+<0005> <0006> [<0021> <003F>]
+endbfrange
+endcmap`
+	pdf := buildPDF(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /Resources << /Font << /F1 5 0 R >> >> /Contents 4 0 R >>",
+		plainStream("BT /F1 12 Tf <0001000200030004> Tj <00050006> Tj ET"),
+		"<< /Type /Font /Subtype /Type0 /BaseFont /ABC /ToUnicode 6 0 R /FontDescriptor 7 0 R >>",
+		flateStream([]byte(cmap), ""),
+		"<< /Type /FontDescriptor >>",
+	)
+	text, err := ExtractPDF(pdf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Hiéê!?"; text != want {
+		t.Errorf("got %q, want %q", text, want)
+	}
+}
+
+func TestExtractPDFDecodedBudget(t *testing.T) {
+	// Each page alone fits, together they exceed the budget of the file
+	half := bytes.Repeat([]byte(" "), maxPDFDecoded/2+1)
+	pdf := buildPDF(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 5 0 R >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 6 0 R >>",
+		flateStream(half, ""),
+		flateStream(half, ""),
+	)
+	if _, err := ExtractPDF(pdf); !errors.Is(err, ErrPDFTooLarge) {
+		t.Errorf("got error %v, want ErrPDFTooLarge", err)
+	}
+}
+
+func TestExtractPDFUnusedStreamsNotDecoded(t *testing.T) {
+	// A stream no page refers to is never inflated, however large
+	bomb := bytes.Repeat([]byte{0}, maxPDFDecoded+1)
+	pdf := buildPDF(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 4 0 R >>",
+		plainStream("BT (Still readable) Tj ET"),
+		flateStream(bomb, ""),
+	)
+	text, err := ExtractPDF(pdf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "Still readable" {
+		t.Errorf("got %q", text)
+	}
+}
+
+func TestExtractPDFOversizedStream(t *testing.T) {
+	pdf := buildPDF(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 4 0 R >>",
+		flateStream(bytes.Repeat([]byte{0}, maxPDFDecoded+1), ""),
+	)
+	if _, err := ExtractPDF(pdf); !errors.Is(err, ErrPDFTooLarge) {
+		t.Errorf("got error %v, want ErrPDFTooLarge", err)
+	}
+}
@@ -0,0 +1,69 @@
+package documents
+
+import (
+	"math"
+	"sort"
+	"telechatbot/internal/terms"
+)
+
+// Rank scores chunks against query with BM25 and returns the indexes of
+// the best k chunks that match at all, best first.
+func Rank(query string, chunks []string, k int) []int {
+	qTerms := terms.Split(query)
+	if len(qTerms) == 0 || len(chunks) == 0 {
+		return nil
+	}
+
+	const k1, b = 1.2, 0.75
+	docs := make([]map[string]int, len(chunks))
+	lengths := make([]int, len(chunks))
+	df := make(map[string]int)
+	total := 0
+	for i, c := range chunks {
+		tf := make(map[string]int)
+		words := terms.Split(c)
+		for _, t := range words {
+			tf[t]++
+		}
+		for t := range tf {
+			df[t]++
+		}
+		docs[i] = tf
+		lengths[i] = len(words)
+		total += len(words)
+	}
+	avg := float64(total) / float64(len(chunks))
+	if avg == 0 {
+		return nil
+	}
+
+	type scored struct {
+		idx   int
+		score float64
+	}
+	var results []scored
+	for i, tf := range docs {
+		score := 0.0
+		for _, t := range qTerms {
+			f := float64(tf[t])
+			if f == 0 {
+				continue
+			}
+			idf := math.Log(1 + (float64(len(chunks))-float64(df[t])+0.5)/(float64(df[t])+0.5))
+			score += idf * f * (k1 + 1) / (f + k1*(1-b+b*float64(lengths[i])/avg))
+		}
+		if score > 0 {
+			results = append(results, scored{i, score})
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool { return results[i].score > results[j].score })
+	if len(results) > k {
+		results = results[:k]
+	}
+	idx := make([]int, len(results))
+	for i, r := range results {
+		idx[i] = r.idx
+	}
+	return idx
+}
@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"telechatbot/internal/access"
+	"telechatbot/internal/database"
+	"telechatbot/internal/models"
+	"telechatbot/internal/render"
+)
+
+// checkAccess applies the access policy to a message addressed to the bot
+// and reports whether it may be answered. The bot leaves groups that are
+// not approved.
+func (d *Dispatcher) checkAccess(ctx context.Context, msg *models.Message, userLang string) bool {
+	decision := d.Access.Check(ctx, msg.Chat, msg.From.ID)
+	threadID := messageThreadID(msg)
+
+	switch decision {
+	case access.Allowed:
+		return true
+	case access.ChatDenied:
+		log.Printf("[INFO] Leaving chat %d (%s): not approved", msg.Chat.ID, msg.Chat.Title)
+		d.Bot.SendMessage(ctx, msg.Chat.ID, threadID, 0, d.Localizer.Get(userLang, "group_not_approved"), nil)
+		d.leaveChat(ctx, msg.Chat.ID)
+	case access.UserDenied:
+		log.Printf("[INFO] User %d has no access (chat %d)", msg.From.ID, msg.Chat.ID)
+		if d.shouldNotice(msg.From.ID) {
+			d.Bot.SendMessage(ctx, msg.Chat.ID, threadID, msg.MessageID, d.Localizer.Get(userLang, "access_denied"), nil)
+		}
+	case access.NotGroupAdmin:
+		if d.shouldNotice(msg.From.ID) {
+			d.Bot.SendMessage(ctx, msg.Chat.ID, threadID, msg.MessageID, d.Localizer.Get(userLang, "group_admins_only"), nil)
+		}
+	}
+	return false
+}
+
+// handleMyChatMember reacts to the bot being added to or removed from a
+// chat. A group added by a bot admin is approved on the spot; any other
+// unapproved group is told so and left.
+func (d *Dispatcher) handleMyChatMember(ctx context.Context, upd *models.ChatMemberUpdated) {
+	chat := upd.Chat
+	if chat == nil || chat.Type == "private" {
+		return
+	}
+
+	joined := upd.NewChatMember.IsPresent() && !upd.OldChatMember.IsPresent()
+	if !upd.NewChatMember.IsPresent() {
+		log.Printf("[INFO] Removed from chat %d (%s)", chat.ID, chat.Title)
+		return
+	}
+	if !joined || d.Access.ChatApproved(chat.ID) {
+		return
+	}
+
+	var adderID int64
+	if upd.From != nil {
+		adderID = upd.From.ID
+	}
+	if d.Access.IsAdmin(adderID) {
+		if err := d.Access.Set(database.AccessChat, chat.ID, database.AccessAllow, adderID); err != nil {
+			log.Printf("[ERROR] Failed to approve chat %d: %v", chat.ID, err)
+		} else {
+			log.Printf("[INFO] Chat %d (%s) approved, added by admin %d", chat.ID, chat.Title, adderID)
+		}
+		return
+	}
+
+	log.Printf("[INFO] Added to unapproved chat %d (%s) by user %d, leaving", chat.ID, chat.Title, adderID)
+	userLang := d.DB.GetUserLanguage(adderID)
+	if chat.Type != "channel" {
+		d.Bot.SendMessage(ctx, chat.ID, 0, 0, d.Localizer.Get(userLang, "group_not_approved"), nil)
+	}
+	d.leaveChat(ctx, chat.ID)
+}
+
+func (d *Dispatcher) leaveChat(ctx context.Context, chatID int64) {
+	if err := d.Bot.LeaveChat(ctx, chatID); err != nil {
+		log.Printf("[WARN] Failed to leave chat %d: %v", chatID, err)
+	}
+}
+
+// handleAccessCommand runs the admin commands /grant, /revoke and /access.
+//
+//	/grant [user|chat] <id>   allow a user or approve a group
+//	/revoke [user|chat] <id>  block a user or group (the bot leaves it)
+//	/access reset [user|chat] <id>  drop the stored rule, the config decides
+//	/access                   show the mode and stored rules
+//
+// Without an ID the target is the author of the replied message, or the
+// current group. Bare negative IDs are chats.
+func (d *Dispatcher) handleAccessCommand(ctx context.Context, call CommandCall) {
+	msg := call.Msg
+	reply := func(s string) {
+		d.Bot.SendMessage(ctx, msg.Chat.ID, messageThreadID(msg), msg.MessageID, s, nil)
+	}
+	command, args := "/"+call.Name, strings.Fields(call.Args)
+
+	if command == "/access" {
+		if len(args) == 0 {
+			reply(d.formatAccessRules())
+			return
+		}
+		if args[0] != "reset" {
+			reply("Usage: `/access` or `/access reset [user|chat] <id>`")
+			return
+		}
+		kind, id, ok := accessTarget(msg, args[1:])
+		if !ok {
+			reply("Usage: `/access reset [user|chat] <id>`")
+			return
+		}
+		if err := d.Access.Reset(kind, id); err != nil {
+			log.Printf("[ERROR] Failed to reset access of %s %d: %v", kind, id, err)
+			reply("Failed to update access rules.")
+			return
+		}
+		reply(fmt.Sprintf("Rule for %s `%d` removed, the config decides again.", kind, id))
+		return
+	}
+
+	kind, id, ok := accessTarget(msg, args)
+	if !ok {
+		reply(fmt.Sprintf("Usage: `%s [user|chat] <id>`, or reply to a message of the user", command))
+		return
+	}
+	rule := database.AccessAllow
+	if command == "/revoke" {
+		rule = database.AccessDeny
+	}
+	if kind == database.AccessUser && rule == database.AccessDeny && d.isAdmin(id) {
+		reply("Bot admins can't be blocked, remove them from ADMIN_USER_IDS first.")
+		return
+	}
+	if err := d.Access.Set(kind, id, rule, msg.From.ID); err != nil {
+		log.Printf("[ERROR] Failed to set access of %s %d: %v", kind, id, err)
+		reply("Failed to update access rules.")
+		return
+	}
+	log.Printf("[INFO] Admin %d set %s %d to %s", msg.From.ID, kind, id, rule)
+
+	if rule == database.AccessAllow {
+		reply(fmt.Sprintf("✅ Access granted to %s `%d`.", kind, id))
+		return
+	}
+	reply(fmt.Sprintf("⛔ Access revoked for %s `%d`.", kind, id))
+	if kind == database.AccessChat {
+		d.leaveChat(ctx, id)
+	}
+}
+
+// accessTarget finds the user or chat an access command is about.
+func accessTarget(msg *models.Message, args []string) (string, int64, bool) {
+	kind := ""
+	if len(args) > 0 && (args[0] == database.AccessUser || args[0] == database.AccessChat) {
+		kind, args = args[0], args[1:]
+	}
+
+	if len(args) == 0 {
+		switch {
+		case kind != database.AccessChat && msg.ReplyToMessage != nil && msg.ReplyToMessage.From != nil:
+			return database.AccessUser, msg.ReplyToMessage.From.ID, true
+		case kind != database.AccessUser && msg.Chat.Type != "private":
+			return database.AccessChat, msg.Chat.ID, true
+		}
+		return "", 0, false
+	}
+
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil || id == 0 {
+		return "", 0, false
+	}
+	if kind == "" {
+		kind = database.AccessUser
+		if id < 0 {
+			kind = database.AccessChat
+		}
+	}
+	return kind, id, true
+}
+
+func (d *Dispatcher) formatAccessRules() string {
+	var b strings.Builder
+	mode := access.ModeOpen
+	if d.Access != nil {
+		mode = d.Access.Mode
+	}
+	fmt.Fprintf(&b, "🔒 **Access** · mode `%s`", mode)
+	if d.Access != nil && d.Access.GroupAdminsOnly {
+		b.WriteString(" · group admins only")
+	}
+
+	rules, err := d.DB.ListAccessRules()
+	if err != nil {
+		log.Printf("[ERROR] Failed to list access rules: %v", err)
+		return b.String() + "\n\nFailed to load access rules."
+	}
+	if len(rules) == 0 {
+		return b.String() + "\n\nNo rules set at runtime, only the config lists apply."
+	}
+	for _, r := range rules {
+		icon := "✅"
+		if r.Rule == database.AccessDeny {
+			icon = "⛔"
+		}
+		fmt.Fprintf(&b, "\n%s %s `%d` · by `%d` · %s", icon, r.Kind, r.ID, r.AddedBy, render.EscapeMarkdown(r.CreatedAt.Format("2006-01-02 15:04")))
+	}
+	return b.String()
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"telechatbot/internal/api"
+	"telechatbot/internal/render"
+	"time"
+)
+
+func (d *Dispatcher) isAdmin(userID int64) bool {
+	return d.Admins[userID]
+}
+
+// keyReporters lists every configured backend that reports key status.
+func (d *Dispatcher) keyReporters() []api.KeyReporter {
+	var out []api.KeyReporter
+	for _, p := range []interface{}{d.AI, d.TitleAI, d.InlineAI, d.Vision, d.Transcriber, d.Embedder} {
+		if r, ok := p.(api.KeyReporter); ok {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// handleKeys answers /keys with the health of every API key.
+func (d *Dispatcher) handleKeys(ctx context.Context, call CommandCall) {
+	msg := call.Msg
+	d.Bot.SendMessage(ctx, msg.Chat.ID, messageThreadID(msg), msg.MessageID, formatKeyStatus(d.keyReporters(), time.Now()), nil)
+}
+
+// formatKeyStatus lists every key pool once, however many clients share it.
+func formatKeyStatus(reporters []api.KeyReporter, now time.Time) string {
+	var b strings.Builder
+	b.WriteString("🔑 **API keys**")
+	seen := make(map[*api.KeyPool]bool)
+	for _, r := range reporters {
+		for _, pool := range r.KeyPools() {
+			if seen[pool] {
+				continue
+			}
+			seen[pool] = true
+			name := pool.Name
+			if name == "" {
+				name = "keys"
+			}
+			fmt.Fprintf(&b, "\n\n**%s**", render.EscapeMarkdown(name))
+			keys := pool.Status()
+			if len(keys) == 0 {
+				b.WriteString("\nno key (keyless server)")
+				continue
+			}
+			for _, k := range keys {
+				state := "✅ ok"
+				switch {
+				case k.Disabled:
+					state = "⛔ disabled"
+				case now.Before(k.CooldownUntil):
+					state = "⏳ cooling " + k.CooldownUntil.Sub(now).Round(time.Second).String()
+				}
+				fmt.Fprintf(&b, "\n`%s` %s · %d req · %d err · %d active", k.Key, state, k.Requests, k.Errors, k.InFlight)
+				if k.LastError != "" {
+					fmt.Fprintf(&b, " · last %s", render.EscapeMarkdown(k.LastError))
+				}
+			}
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"telechatbot/internal/models"
+	"telechatbot/internal/render"
+	"unicode/utf16"
+)
+
+// CommandScope is where a command can be used. A message is in exactly
+// one scope: a private chat, a group, or a forum topic (of either).
+type CommandScope int
+
+const (
+	ScopePrivate CommandScope = 1 << iota
+	ScopeGroup
+	ScopeTopic
+
+	ScopeAll = ScopePrivate | ScopeGroup | ScopeTopic
+)
+
+// scopeOf returns the scope of msg.
+func scopeOf(msg *models.Message) CommandScope {
+	switch {
+	case messageThreadID(msg) != 0:
+		return ScopeTopic
+	case msg.Chat.Type == "private":
+		return ScopePrivate
+	}
+	return ScopeGroup
+}
+
+// CommandCall is one use of a command.
+type CommandCall struct {
+	Msg *models.Message
+	// Name is the command as registered, even when called by an alias
+	Name     string
+	Args     string
+	UserLang string
+}
+
+// Command is a slash command of the bot.
+type Command struct {
+	Name    string // without the slash, lower case
+	Aliases []string
+	// Description is the locale key of the text shown by /help
+	Description string
+	Scopes      CommandScope
+	AdminOnly   bool
+	// Prompt commands (/ask) are not handled here: their arguments are
+	// the prompt for the model. Handler is unused for them.
+	Prompt  bool
+	Handler func(ctx context.Context, call CommandCall)
+}
+
+// CommandRegistry holds the commands by name and alias, in the order they
+// were registered (the order of /help). Commands are registered while the
+// bot starts; the Telegram menus are built from them once, see
+// SyncCommandMenus.
+type CommandRegistry struct {
+	commands []*Command
+	byName   map[string]*Command
+}
+
+func NewCommandRegistry(commands ...*Command) *CommandRegistry {
+	r := &CommandRegistry{byName: make(map[string]*Command)}
+	for _, c := range commands {
+		r.Register(c)
+	}
+	return r
+}
+
+// Register adds c under its name and aliases, replacing earlier commands
+// with the same names.
+func (r *CommandRegistry) Register(c *Command) {
+	if c.Scopes == 0 {
+		c.Scopes = ScopeAll
+	}
+	for _, name := range append([]string{c.Name}, c.Aliases...) {
+		name = strings.ToLower(name)
+		if old, ok := r.byName[name]; ok {
+			log.Printf("[WARN] Command /%s registered twice, replacing /%s", name, old.Name)
+		}
+		r.byName[name] = c
+	}
+	r.commands = append(r.commands, c)
+}
+
+// Lookup finds a command by name or alias.
+func (r *CommandRegistry) Lookup(name string) (*Command, bool) {
+	if r == nil {
+		return nil, false
+	}
+	c, ok := r.byName[strings.ToLower(name)]
+	return c, ok
+}
+
+// Commands returns the registered commands in order.
+func (r *CommandRegistry) Commands() []*Command {
+	var out []*Command
+	for _, c := range r.commands {
+		// Skip commands replaced by a later registration
+		if r.byName[strings.ToLower(c.Name)] == c {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// parsedCommand is a "/name@target args" at the start of a message.
+type parsedCommand struct {
+	Name string
+	Args string
+	// Target is the bot named after "@", empty when none was given
+	Target string
+}
+
+// parseCommand reads the command a message starts with, using the
+// bot_command entity Telegram sends and falling back to the text for
+// clients that don't. Without an entity only names in commands count, so
+// a message like "/etc/hosts is missing" is ordinary text.
+func parseCommand(msg *models.Message, commands *CommandRegistry) (parsedCommand, bool) {
+	text, entities := msg.Text, msg.Entities
+	if text == "" {
+		text, entities = msg.Caption, msg.CaptionEntities
+	}
+
+	token, entity := "", false
+	for _, e := range entities {
+		if e.Type == "bot_command" && e.Offset == 0 {
+			token, entity = utf16Prefix(text, e.Length), true
+			break
+		}
+	}
+	if token == "" {
+		if !strings.HasPrefix(text, "/") {
+			return parsedCommand{}, false
+		}
+		token = strings.Fields(text)[0]
+	}
+
+	name, target, _ := strings.Cut(strings.TrimPrefix(token, "/"), "@")
+	if !validCommandName(name) {
+		return parsedCommand{}, false
+	}
+	if _, known := commands.Lookup(name); !entity && !known {
+		return parsedCommand{}, false
+	}
+	return parsedCommand{
+		Name:   strings.ToLower(name),
+		Args:   strings.TrimSpace(text[len(token):]),
+		Target: target,
+	}, true
+}
+
+// validCommandName is Telegram's rule: 1-32 letters, digits or underscores.
+func validCommandName(name string) bool {
+	if name == "" || len(name) > 32 {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// utf16Prefix returns the start of s that is n UTF-16 code units long.
+func utf16Prefix(s string, n int) string {
+	units := 0
+	for i, r := range s {
+		if units >= n {
+			return s[:i]
+		}
+		units += len(utf16.Encode([]rune{r}))
+	}
+	return s
+}
+
+// forUs reports whether a command is meant for this bot: addressed to it,
+// or to no bot in particular.
+func (p parsedCommand) forUs(botUsername string) bool {
+	return p.Target == "" || strings.EqualFold(p.Target, botUsername)
+}
+
+// runCommand handles a command message that passed the access check.
+// Prompt commands return their arguments as the prompt with ok true; all
+// other commands are handled here.
+func (d *Dispatcher) runCommand(ctx context.Context, msg *models.Message, cmd *Command, pc parsedCommand, userLang string) (prompt string, ok bool) {
+	if cmd.Prompt {
+		return pc.Args, true
+	}
+
+	threadID := messageThreadID(msg)
+	if cmd.AdminOnly && !d.isAdmin(msg.From.ID) {
+		d.Bot.SendMessage(ctx, msg.Chat.ID, threadID, msg.MessageID, d.Localizer.Get(userLang, "admin_only"), nil)
+		return "", false
+	}
+	cmd.Handler(ctx, CommandCall{Msg: msg, Name: cmd.Name, Args: pc.Args, UserLang: userLang})
+	return "", false
+}
+
+// defaultCommands are the commands every bot has.
+func (d *Dispatcher) defaultCommands() *CommandRegistry {
+	return NewCommandRegistry(
+		&Command{Name: "start", Description: "cmd_start", Handler: d.cmdStart},
+		&Command{Name: "help", Description: "cmd_help", Handler: d.cmdHelp},
+		&Command{Name: "ask", Aliases: []string{"ai"}, Description: "cmd_ask", Prompt: true},
+		&Command{Name: "newchat", Description: "cmd_newchat", Handler: d.cmdNewChat},
+		&Command{Name: "lang", Aliases: []string{"language"}, Description: "cmd_lang", Handler: d.cmdLang},
+		&Command{Name: "usage", Description: "cmd_usage", Handler: d.handleUsage},
+		&Command{Name: "keys", Description: "cmd_keys", AdminOnly: true, Handler: d.handleKeys},
+		&Command{Name: "access", Description: "cmd_access", AdminOnly: true, Handler: d.handleAccessCommand},
+		&Command{Name: "grant", Description: "cmd_grant", AdminOnly: true, Handler: d.handleAccessCommand},
+		&Command{Name: "revoke", Description: "cmd_revoke", AdminOnly: true, Handler: d.handleAccessCommand},
+	)
+}
+
+func (d *Dispatcher) cmdStart(ctx context.Context, call CommandCall) {
+	d.Bot.SendMessage(ctx, call.Msg.Chat.ID, messageThreadID(call.Msg), 0, d.Localizer.Get(call.UserLang, "welcome"), nil)
+}
+
+func (d *Dispatcher) cmdLang(ctx context.Context, call CommandCall) {
+	d.sendLanguageSelector(ctx, call.Msg.Chat.ID, messageThreadID(call.Msg), 0, call.UserLang)
+}
+
+func (d *Dispatcher) cmdNewChat(ctx context.Context, call CommandCall) {
+	chatID, threadID, msgID := call.Msg.Chat.ID, messageThreadID(call.Msg), call.Msg.MessageID
+	err := d.DB.ClearHistory(chatID, threadID)
+	if err != nil {
+		log.Printf("Failed to clear history: %v", err)
+		d.Bot.SendMessage(ctx, chatID, threadID, msgID, "Failed to reset chat context.", nil)
+		return
+	}
+	resetText := "🧹 Chat context has been reset. I have forgotten our previous conversation in this topic."
+	if call.UserLang == "id" {
+		resetText = "🧹 Konteks obrolan telah direset. Aku sudah melupakan percakapan kita sebelumnya di topik ini."
+	}
+	d.Bot.SendMessage(ctx, chatID, threadID, msgID, resetText, nil)
+}
+
+// cmdHelp lists the commands usable where it was sent; admin commands
+// only for admins.
+func (d *Dispatcher) cmdHelp(ctx context.Context, call CommandCall) {
+	scope := scopeOf(call.Msg)
+	admin := d.isAdmin(call.Msg.From.ID)
+
+	var user, admins strings.Builder
+	for _, c := range d.Commands.Commands() {
+		if c.Scopes&scope == 0 || (c.AdminOnly && !admin) {
+			continue
+		}
+		b := &user
+		if c.AdminOnly {
+			b = &admins
+		}
+		fmt.Fprintf(b, "\n/%s", c.Name)
+		for _, a := range c.Aliases {
+			fmt.Fprintf(b, ", /%s", a)
+		}
+		fmt.Fprintf(b, " — %s", render.EscapeMarkdown(d.Localizer.Get(call.UserLang, c.Description)))
+	}
+
+	text := "**" + render.EscapeMarkdown(d.Localizer.Get(call.UserLang, "help_title")) + "**" + user.String()
+	if admins.Len() > 0 {
+		text += "\n\n**" + render.EscapeMarkdown(d.Localizer.Get(call.UserLang, "help_admin")) + "**" + admins.String()
+	}
+	d.Bot.SendMessage(ctx, call.Msg.Chat.ID, messageThreadID(call.Msg), call.Msg.MessageID, text, nil)
+}
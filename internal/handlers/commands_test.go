@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"telechatbot/internal/database"
+	"telechatbot/internal/i18n"
+	"telechatbot/internal/models"
+	"testing"
+)
+
+func commandMessage(text string, entityLength int) *models.Message {
+	msg := &models.Message{MessageID: 10, Text: text, From: &models.User{ID: 1}, Chat: &models.Chat{ID: 1, Type: "private"}}
+	if entityLength > 0 {
+		msg.Entities = []models.MessageEntity{{Type: "bot_command", Offset: 0, Length: entityLength}}
+	}
+	return msg
+}
+
+func TestParseCommand(t *testing.T) {
+	d := &Dispatcher{}
+	commands := d.defaultCommands()
+
+	tests := []struct {
+		name         string
+		text         string
+		entityLength int
+		want         parsedCommand
+		ok           bool
+	}{
+		{"entity", "/ask what is 2+2", 4, parsedCommand{Name: "ask", Args: "what is 2+2"}, true},
+		{"entity with target", "/Ask@TestBot hi", 12, parsedCommand{Name: "ask", Args: "hi", Target: "TestBot"}, true},
+		{"entity before non-BMP text", "/ask 😀 and 😀", 4, parsedCommand{Name: "ask", Args: "😀 and 😀"}, true},
+		{"entity for an unknown command", "/nosuch x", 7, parsedCommand{Name: "nosuch", Args: "x"}, true},
+		{"registered without entity", "/newchat", 0, parsedCommand{Name: "newchat"}, true},
+		{"alias without entity", "/language", 0, parsedCommand{Name: "language"}, true},
+		{"longer name than a command", "/languages", 0, parsedCommand{}, false},
+		{"path", "/etc/hosts is missing", 0, parsedCommand{}, false},
+		{"unknown word", "/etc hosts", 0, parsedCommand{}, false},
+		{"not at the start", "see /help", 0, parsedCommand{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseCommand(commandMessage(tt.text, tt.entityLength), commands)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("%s: got %+v, %v, want %+v, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	// Captions carry their own entities
+	msg := &models.Message{Caption: "/ask describe", CaptionEntities: []models.MessageEntity{{Type: "bot_command", Length: 4}}}
+	if got, ok := parseCommand(msg, commands); !ok || got.Name != "ask" || got.Args != "describe" {
+		t.Errorf("caption: got %+v, %v", got, ok)
+	}
+}
+
+func TestUTF16Prefix(t *testing.T) {
+	for _, tt := range []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"/ask hi", 4, "/ask"},
+		{"😀ab", 2, "😀"},
+		{"😀ab", 3, "😀a"},
+		{"é/x", 2, "é/"},
+		{"abc", 10, "abc"},
+	} {
+		if got := utf16Prefix(tt.s, tt.n); got != tt.want {
+			t.Errorf("utf16Prefix(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestCommandForUs(t *testing.T) {
+	for target, want := range map[string]bool{"": true, "testbot": true, "TestBot": true, "OtherBot": false} {
+		if got := (parsedCommand{Name: "help", Target: target}).forUs("TestBot"); got != want {
+			t.Errorf("target %q: got %v", target, got)
+		}
+	}
+}
+
+func TestLookupAliases(t *testing.T) {
+	commands := (&Dispatcher{}).defaultCommands()
+	for name, want := range map[string]string{"lang": "lang", "language": "lang", "LANGUAGE": "lang", "ai": "ask"} {
+		if c, ok := commands.Lookup(name); !ok || c.Name != want {
+			t.Errorf("Lookup(%q) = %+v, %v, want /%s", name, c, ok, want)
+		}
+	}
+	for _, name := range []string{"langu", "languages", "l"} {
+		if _, ok := commands.Lookup(name); ok {
+			t.Errorf("Lookup(%q) matched", name)
+		}
+	}
+
+	// A later registration takes over the alias, not the command
+	commands.Register(&Command{Name: "language", Description: "x"})
+	if c, _ := commands.Lookup("language"); c.Name != "language" {
+		t.Errorf("got /%s after replacing the alias", c.Name)
+	}
+	if c, _ := commands.Lookup("lang"); c.Name != "lang" {
+		t.Errorf("got /%s for /lang", c.Name)
+	}
+}
+
+func newCommandDispatcher(t *testing.T) (*Dispatcher, *fakeTelegram) {
+	t.Helper()
+	t.Chdir("../..") // locales/
+	db, err := database.OpenDB(filepath.Join(t.TempDir(), "bot.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Conn.Close() })
+	if _, err := db.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	b, tg := newFakeTelegram(t)
+	return NewDispatcher(b, nil, db, i18n.NewLocalizer(), "", "TestBot"), tg
+}
+
+func TestCommandsForOtherBots(t *testing.T) {
+	d, tg := newCommandDispatcher(t)
+
+	msg := commandMessage("/help@OtherBot", 14)
+	d.handleMessage(context.Background(), msg)
+	msg = commandMessage("/help@OtherBot", 14)
+	msg.Chat = &models.Chat{ID: -100, Type: "supergroup"}
+	d.handleMessage(context.Background(), msg)
+	if calls := tg.Calls(""); len(calls) != 0 {
+		t.Errorf("answered a command for another bot: %+v", calls)
+	}
+
+	d.handleMessage(context.Background(), commandMessage("/nosuch", 7))
+	calls := tg.Calls("sendMessage")
+	if len(calls) != 1 || !strings.Contains(calls[0].Body["text"].(string), "Unknown command") {
+		t.Errorf("unknown command: got %+v", calls)
+	}
+}
+
+func TestHelpScopes(t *testing.T) {
+	d, tg := newCommandDispatcher(t)
+	d.Admins = map[int64]bool{1: true}
+	d.Commands = NewCommandRegistry(
+		&Command{Name: "help", Description: "cmd_help"},
+		&Command{Name: "dmonly", Description: "cmd_start", Scopes: ScopePrivate},
+		&Command{Name: "grouponly", Description: "cmd_start", Scopes: ScopeGroup | ScopeTopic},
+		&Command{Name: "topiconly", Description: "cmd_start", Scopes: ScopeTopic},
+		&Command{Name: "keys", Description: "cmd_keys", AdminOnly: true},
+	)
+
+	help := func(chat *models.Chat, threadID int, userID int64) string {
+		t.Helper()
+		msg := &models.Message{From: &models.User{ID: userID}, Chat: chat, MessageThreadID: threadID, IsTopicMessage: threadID != 0}
+		before := len(tg.Calls("sendMessage"))
+		d.cmdHelp(context.Background(), CommandCall{Msg: msg, Name: "help", UserLang: "en"})
+		calls := tg.Calls("sendMessage")
+		if len(calls) != before+1 {
+			t.Fatalf("got %d messages", len(calls)-before)
+		}
+		return calls[len(calls)-1].Body["text"].(string)
+	}
+	private := &models.Chat{ID: 1, Type: "private"}
+	group := &models.Chat{ID: -100, Type: "supergroup"}
+
+	for _, tt := range []struct {
+		name     string
+		text     string
+		has, not []string
+	}{
+		{"private", help(private, 0, 1), []string{"/help", "/dmonly", "/keys"}, []string{"/grouponly", "/topiconly"}},
+		{"group", help(group, 0, 1), []string{"/help", "/grouponly"}, []string{"/dmonly", "/topiconly"}},
+		{"topic", help(group, 7, 1), []string{"/grouponly", "/topiconly"}, []string{"/dmonly"}},
+		{"not an admin", help(private, 0, 2), []string{"/dmonly"}, []string{"/keys", "Admin commands"}},
+	} {
+		for _, s := range tt.has {
+			if !strings.Contains(tt.text, s) {
+				t.Errorf("%s: %q missing from %q", tt.name, s, tt.text)
+			}
+		}
+		for _, s := range tt.not {
+			if strings.Contains(tt.text, s) {
+				t.Errorf("%s: %q listed in %q", tt.name, s, tt.text)
+			}
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"log"
+	"strings"
+	"telechatbot/internal/database"
+	"telechatbot/internal/models"
+)
+
+// maxHistoryRows caps how many stored turns are loaded per message. The
+// token budget normally cuts much earlier; this only bounds the query.
+const maxHistoryRows = 200
+
+// buildMessages assembles the prompt: the head messages (system prompt,
+// summary, document excerpts), as many of the most recent history turns as
+// fit in d.ContextTokens, then the new user message. Older turns stay in
+// the database, they are just not sent.
+func (d *Dispatcher) buildMessages(head []models.GroqMessage, history []database.ChatMessage, user models.GroqMessage) []models.GroqMessage {
+	budget := d.ContextTokens - d.Tokens.Messages(head) - d.Tokens.Message(user)
+	if budget < 0 {
+		log.Printf("[WARN] System prompt, context and message alone exceed the context budget (%d tokens)", d.ContextTokens)
+	}
+
+	// Walk backwards from the newest turn and stop at the first one that
+	// does not fit, so the model never sees a conversation with holes
+	var kept []models.GroqMessage
+	for i := len(history) - 1; i >= 0; i-- {
+		h := history[i]
+		// [Pembaruan 1] Filter pesan kosong.
+		// Jika ada history kosong/spasi doang di database, JANGAN kirim ke AI.
+		// Ini mencegah AI bingung dan mengulang pesan lama.
+		if strings.TrimSpace(h.Content) == "" {
+			continue
+		}
+
+		role := "user"
+		if h.Role == "AI" {
+			role = "assistant"
+		}
+		m := models.GroqMessage{Role: role, Content: h.Content}
+
+		cost := d.Tokens.Message(m)
+		if cost > budget {
+			log.Printf("[DEBUG] Context budget reached, sending %d of %d history turns", len(kept), len(history))
+			break
+		}
+		budget -= cost
+		kept = append(kept, m)
+	}
+
+	messages := make([]models.GroqMessage, 0, len(head)+len(kept)+1)
+	messages = append(messages, head...)
+	for i := len(kept) - 1; i >= 0; i-- {
+		messages = append(messages, kept[i])
+	}
+	return append(messages, user)
+}
@@ -1,54 +1,249 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"regexp"
 	"strings"
+	"sync"
+	"telechatbot/internal/access"
 	"telechatbot/internal/api"
 	"telechatbot/internal/bot"
 	"telechatbot/internal/database"
 	"telechatbot/internal/i18n"
+	"telechatbot/internal/limits"
 	"telechatbot/internal/models"
+	"telechatbot/internal/render"
+	"telechatbot/internal/tools"
+	"telechatbot/internal/usage"
+	"telechatbot/internal/webfetch"
 	"time"
+	"unicode/utf16"
 )
 
 type Dispatcher struct {
 	Bot          *bot.Client
-	AI           *api.GroqClient
+	AI           api.ChatProvider
 	DB           *database.DB
 	Localizer    *i18n.Localizer
 	SystemPrompt string
 	BotUsername  string
+
+	// TitleAI and InlineAI serve topic titles and inline answers; nil
+	// means AI is used
+	TitleAI  api.ChatProvider
+	InlineAI api.ChatProvider
+
+	// Queue serializes updates per conversation, see WorkQueue
+	Queue *WorkQueue
+
+	// Commands are the slash commands the bot answers, see defaultCommands
+	Commands *CommandRegistry
+
+	// Admins may use maintenance commands such as /keys
+	Admins map[int64]bool
+
+	// ContextTokens is the prompt budget (system prompt, history and the
+	// new message); history that does not fit is left out of the request
+	ContextTokens int
+	Tokens        api.TokenEstimator
+
+	// SummaryKeepTurns is how many recent turns are never summarized;
+	// 0 disables the rolling summary
+	SummaryKeepTurns int
+	summarizing      sync.Map // ConversationKey -> summary run in progress
+
+	// Transcriber handles voice notes; nil means they are answered with a
+	// "not supported" message. EchoTranscript replies with the transcript
+	// before answering.
+	Transcriber    api.Transcriber
+	EchoTranscript bool
+
+	// Vision answers messages with images; if nil, AI is used when it
+	// reports Capabilities().Vision, otherwise images are declined
+	Vision api.ChatProvider
+
+	// MaxDocumentBytes caps the size of documents the bot downloads
+	MaxDocumentBytes int64
+
+	// Embedder enables long-term memory: past turns and document chunks
+	// are embedded after each reply and the MemoryTopK most similar (with
+	// a score of at least MemoryMinScore) are added to the prompt
+	Embedder       api.Embedder
+	MemoryTopK     int
+	MemoryMinScore float64
+	remembering    sync.Map // ConversationKey -> embedding run in progress
+
+	// Tools the model may call while answering; nil or empty disables
+	// tool calling
+	Tools *tools.Registry
+
+	// Fetcher reads links; with one of LinkTriggers in the message the
+	// page is fetched before answering. nil disables both.
+	Fetcher      *webfetch.Fetcher
+	LinkTriggers []string
+
+	// Prices turn the recorded token usage into cost for /usage
+	Prices usage.Prices
+
+	// Access decides who may use the bot; nil allows everyone
+	Access *access.Policy
+
+	// Limiter enforces request rates and daily token budgets; nil means
+	// no limits
+	Limiter *limits.Limiter
+	notices sync.Map // user ID -> time of the last "limit reached" or "no access" reply
+
+	// wg tracks every handler goroutine so shutdown can wait for them
+	wg sync.WaitGroup
 }
 
-func NewDispatcher(b *bot.Client, ai *api.GroqClient, db *database.DB, loc *i18n.Localizer, sysPrompt, botUsername string) *Dispatcher {
-	return &Dispatcher{
+func NewDispatcher(b *bot.Client, ai api.ChatProvider, db *database.DB, loc *i18n.Localizer, sysPrompt, botUsername string) *Dispatcher {
+	d := &Dispatcher{
 		Bot:          b,
 		AI:           ai,
 		DB:           db,
 		Localizer:    loc,
 		SystemPrompt: sysPrompt,
 		BotUsername:  botUsername,
+		Queue:        NewWorkQueue(8, 5),
+
+		ContextTokens: 6000,
+		Tokens:        api.EstimatorFor(""),
+
+		SummaryKeepTurns: 6,
+		MaxDocumentBytes: 10 << 20,
+
+		MemoryTopK:     4,
+		MemoryMinScore: 0.3,
+
+		LinkTriggers: DefaultLinkTriggers,
+	}
+
+	d.Commands = d.defaultCommands()
+
+	b.OnMigrate = d.migrateChat
+	return d
+}
+
+// migrateChat keeps history when a group is upgraded to a supergroup.
+func (d *Dispatcher) migrateChat(oldChatID, newChatID int64) {
+	if err := d.DB.MigrateChat(oldChatID, newChatID); err != nil {
+		log.Printf("[ERROR] Failed to migrate chat %d to %d: %v", oldChatID, newChatID, err)
+	}
+}
+
+// Dispatch queues the update behind earlier updates of the same
+// conversation. ctx should outlive the polling/webhook loop so in-flight
+// replies can finish during shutdown.
+func (d *Dispatcher) Dispatch(ctx context.Context, update models.Update) {
+	key := conversationKey(update)
+
+	d.wg.Add(1)
+	queued := d.Queue.Submit(key, func() {
+		defer d.wg.Done()
+		d.HandleUpdate(ctx, update)
+	})
+	if queued {
+		return
 	}
+	d.wg.Done()
+
+	log.Printf("[WARN] Queue full for chat %d thread %d, dropping update %d", key.ChatID, key.ThreadID, update.UpdateID)
+	if update.Message != nil {
+		d.goTracked(func() { d.replyBusy(ctx, update.Message) })
+	}
+}
+
+// replyBusy tells the user to wait, but only for messages the bot would
+// actually answer so normal group chatter is not spammed.
+func (d *Dispatcher) replyBusy(ctx context.Context, msg *models.Message) {
+	if msg.From == nil {
+		return
+	}
+	if pc, isCommand := parseCommand(msg, d.Commands); isCommand {
+		if !pc.forUs(d.BotUsername) {
+			return
+		}
+	} else if ok, _ := ShouldProcessMessage(msg, d.BotUsername); !ok {
+		return
+	}
+	userLang := d.DB.GetUserLanguage(msg.From.ID)
+	d.Bot.SendMessage(ctx, msg.Chat.ID, messageThreadID(msg), msg.MessageID, d.Localizer.Get(userLang, "busy"), nil)
+}
+
+// conversationKey decides which updates must be processed in order.
+// Inline queries have no chat, so they are serialized per user instead
+// (thread -1 keeps them apart from the user's private chat).
+func conversationKey(update models.Update) ConversationKey {
+	switch {
+	case update.Message != nil:
+		return ConversationKey{ChatID: update.Message.Chat.ID, ThreadID: messageThreadID(update.Message)}
+	case update.CallbackQuery != nil && update.CallbackQuery.Message != nil:
+		return ConversationKey{ChatID: update.CallbackQuery.Message.Chat.ID, ThreadID: messageThreadID(update.CallbackQuery.Message)}
+	case update.CallbackQuery != nil:
+		return ConversationKey{ChatID: update.CallbackQuery.From.ID, ThreadID: -1}
+	case update.InlineQuery != nil:
+		return ConversationKey{ChatID: update.InlineQuery.From.ID, ThreadID: -1}
+	case update.ChosenInlineResult != nil:
+		return ConversationKey{ChatID: update.ChosenInlineResult.From.ID, ThreadID: -1}
+	case update.MyChatMember != nil:
+		return ConversationKey{ChatID: update.MyChatMember.Chat.ID}
+	}
+	return ConversationKey{}
+}
+
+func messageThreadID(msg *models.Message) int {
+	if msg.IsTopicMessage || msg.MessageThreadID != 0 {
+		return msg.MessageThreadID
+	}
+	return 0
+}
+
+// Wait blocks until all handlers have finished or timeout passes.
+// It reports whether everything finished in time.
+func (d *Dispatcher) Wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func (d *Dispatcher) goTracked(fn func()) {
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		fn()
+	}()
 }
 
-func (d *Dispatcher) HandleUpdate(update models.Update) {
+func (d *Dispatcher) HandleUpdate(ctx context.Context, update models.Update) {
 	if update.Message != nil {
-		d.handleMessage(update.Message)
+		d.handleMessage(ctx, update.Message)
 	} else if update.CallbackQuery != nil {
-		d.handleCallback(update.CallbackQuery)
+		d.handleCallback(ctx, update.CallbackQuery)
 	} else if update.InlineQuery != nil {
 		// [BARU] User sedang mengetik @bot ...
-		d.handleInlineQuery(update.InlineQuery)
+		d.handleInlineQuery(ctx, update.InlineQuery)
 	} else if update.ChosenInlineResult != nil {
 		// [BARU] User SUDAH mengirim pesan inline
-		go d.handleChosenInlineResult(update.ChosenInlineResult)
+		d.handleChosenInlineResult(ctx, update.ChosenInlineResult)
+	} else if update.MyChatMember != nil {
+		d.handleMyChatMember(ctx, update.MyChatMember)
 	}
 }
 
-func (d *Dispatcher) handleInlineQuery(iq *models.InlineQuery) {
-	if iq.Query == "" {
+func (d *Dispatcher) handleInlineQuery(ctx context.Context, iq *models.InlineQuery) {
+	if iq.Query == "" || (iq.From != nil && !d.Access.UserAllowed(iq.From.ID)) {
 		return
 	}
 
@@ -62,26 +257,46 @@ func (d *Dispatcher) handleInlineQuery(iq *models.InlineQuery) {
 		},
 	}
 
+	messageText, parseMode := d.Bot.Render(fmt.Sprintf("⏳ **Sedang berpikir...**\n\nQuery: _%s_", render.EscapeMarkdown(iq.Query)))
+
 	article := models.InlineQueryResult{
-		Type:  "article",
-		ID:    iq.Query,
-		Title: "Tanya AI: " + iq.Query,
+		Type:        "article",
+		ID:          iq.Query,
+		Title:       "Tanya AI: " + iq.Query,
 		Description: "Klik untuk mengirim dan memproses jawaban",
 		InputMessageContent: models.InputMessageContent{
-			MessageText: fmt.Sprintf("⏳ *Sedang berpikir...*\n\nQuery: _%s_", iq.Query),
-			ParseMode:   "Markdown",
+			MessageText: messageText,
+			ParseMode:   parseMode,
 		},
 		ReplyMarkup: loadingKeyboard, // <--- Masukkan keyboard di sini
 	}
 
-	d.Bot.AnswerInlineQuery(iq.ID, []models.InlineQueryResult{article})
+	d.Bot.AnswerInlineQuery(ctx, iq.ID, []models.InlineQueryResult{article})
 }
 
 // 2. Saat user KLIK hasil tersebut -> Pesan terkirim -> Bot dapat notif ini
 // Di sinilah kita panggil AI Groq dan EDIT pesan tadi.
-func (d *Dispatcher) handleChosenInlineResult(cir *models.ChosenInlineResult) {
+func (d *Dispatcher) handleChosenInlineResult(ctx context.Context, cir *models.ChosenInlineResult) {
 	log.Printf("Processing inline query: %s", cir.Query)
 
+	userLang := "en"
+	if cir.From != nil {
+		userLang = d.DB.GetUserLanguage(cir.From.ID)
+		ctx = usage.WithScope(ctx, usage.Scope{UserID: cir.From.ID, Purpose: usage.PurposeInline})
+		refusal := ""
+		if !d.Access.UserAllowed(cir.From.ID) {
+			refusal = d.Localizer.Get(userLang, "access_denied")
+		} else if denial, ok := d.Limiter.Allow(cir.From.ID, 0); !ok {
+			refusal = d.limitText(denial, userLang)
+		}
+		if refusal != "" {
+			if err := d.Bot.EditMessageText(ctx, 0, 0, cir.InlineMessageID, refusal, nil); err != nil && !bot.IsMessageNotModified(err) {
+				log.Printf("Failed to edit inline message: %v", err)
+			}
+			return
+		}
+	}
+
 	prompt := cir.Query
 	if prompt == "" {
 		prompt = cir.ResultID
@@ -93,8 +308,8 @@ func (d *Dispatcher) handleChosenInlineResult(cir *models.ChosenInlineResult) {
 	}
 
 	// 1. Panggil AI
-	aiContent, _, err := d.AI.SendChat(messages) // Parameter ke-2 (reasoning) kita abaikan dengan "_"
-	
+	aiContent, _, err := orDefault(d.InlineAI, d.AI).SendChat(ctx, messages) // Parameter ke-2 (reasoning) kita abaikan dengan "_"
+
 	finalResponse := aiContent
 	if err != nil {
 		finalResponse = "⚠️ Gagal menghubungi AI."
@@ -103,22 +318,35 @@ func (d *Dispatcher) handleChosenInlineResult(cir *models.ChosenInlineResult) {
 	// 2. BERSIHKAN THINKING
 	// Kita gunakan helper yang sudah ada di dispatcher.go untuk membuang tag <think>...</think>
 	// dan kita abaikan return value pertama (isi think-nya).
-	_, cleanResponse := d.extractThinkContent(finalResponse)
+	_, cleanResponse := extractThinkContent(finalResponse)
 
 	// 3. Format pesan akhir (Hanya Pertanyaan + Jawaban Bersih)
-	formattedText := fmt.Sprintf(cleanResponse)
+	formattedText := d.fitInline(cleanResponse, userLang)
 
 	// 4. Edit pesan
-	err = d.Bot.EditMessageText(0, 0, cir.InlineMessageID, formattedText)
-	if err != nil {
+	err = d.Bot.EditMessageText(ctx, 0, 0, cir.InlineMessageID, formattedText, nil)
+	if err != nil && !bot.IsMessageNotModified(err) {
 		log.Printf("Failed to edit inline message: %v", err)
 	}
 }
 
-func (d *Dispatcher) extractThinkContent(raw string) (string, string) {
-	reThink := regexp.MustCompile(`(?s)<think>(.*?)</think>`)
+// fitInline keeps an inline answer within one message. An inline message
+// can't be followed by more parts, so a long answer keeps its first part
+// and a notice.
+func (d *Dispatcher) fitInline(text, userLang string) string {
+	if len(bot.SplitMarkdown(text, d.Bot.MaxMessageLength)) == 1 {
+		return text
+	}
+	notice := d.Localizer.Get(userLang, "inline_truncated")
+	room := d.Bot.MaxMessageLength - len(utf16.Encode([]rune(notice))) - 2
+	return bot.SplitMarkdown(text, room)[0] + "\n\n" + notice
+}
+
+var reThink = regexp.MustCompile(`(?s)<think>(.*?)</think>`)
+
+func extractThinkContent(raw string) (string, string) {
 	match := reThink.FindStringSubmatch(raw)
-	
+
 	thinkContent := ""
 	if len(match) > 1 {
 		thinkContent = strings.TrimSpace(match[1])
@@ -128,136 +356,179 @@ func (d *Dispatcher) extractThinkContent(raw string) (string, string) {
 	return thinkContent, strings.TrimSpace(cleanResponse)
 }
 
-func (d *Dispatcher) continuouslySendTyping(chatID int64, threadID int, stopChan chan bool) {
+func (d *Dispatcher) continuouslySendTyping(ctx context.Context, chatID int64, threadID int, stopChan chan bool) {
 	ticker := time.NewTicker(4 * time.Second)
 	defer ticker.Stop()
 
-	d.Bot.SendChatAction(chatID, threadID, "typing")
+	if err := d.Bot.SendChatAction(ctx, chatID, threadID, "typing"); bot.IsBotBlocked(err) {
+		return
+	}
 
 	for {
 		select {
 		case <-stopChan:
 			return
+		case <-ctx.Done():
+			return
 		case <-ticker.C:
-			d.Bot.SendChatAction(chatID, threadID, "typing")
+			d.Bot.SendChatAction(ctx, chatID, threadID, "typing")
 		}
 	}
 }
 
-func (d *Dispatcher) handleMessage(msg *models.Message) {
-	shouldRespond, cleanText := ShouldProcessMessage(msg, d.BotUsername)
-	if !shouldRespond {
+func (d *Dispatcher) handleMessage(ctx context.Context, msg *models.Message) {
+	if msg.MigrateToChatID != 0 {
+		d.migrateChat(msg.Chat.ID, msg.MigrateToChatID)
 		return
 	}
 
-	text := cleanText
-	if text == "" {
-		return
+	// Commands go through the registry; anything else must be addressed
+	// to the bot (private chat, mention, reply)
+	pc, isCommand := parseCommand(msg, d.Commands)
+	cleanText := ""
+	if isCommand {
+		if !pc.forUs(d.BotUsername) {
+			return
+		}
+		// In groups only our own commands are answered, unless the
+		// command names the bot explicitly
+		cmd, known := d.Commands.Lookup(pc.Name)
+		if msg.Chat.Type != "private" && pc.Target == "" && (!known || cmd.Scopes&scopeOf(msg) == 0) {
+			return
+		}
+	} else {
+		shouldRespond, text := ShouldProcessMessage(msg, d.BotUsername)
+		if !shouldRespond {
+			return
+		}
+		cleanText = text
 	}
 
 	userID := msg.From.ID
 	chatID := msg.Chat.ID
 	msgID := msg.MessageID
-	threadID := 0
-
-	if msg.IsTopicMessage || msg.MessageThreadID != 0 {
-		threadID = msg.MessageThreadID
-	}
+	threadID := messageThreadID(msg)
+	ctx = usage.WithScope(ctx, usage.Scope{UserID: userID, ChatID: chatID, ThreadID: threadID, Purpose: usage.PurposeChat})
 
 	userLang := d.DB.GetUserLanguage(userID)
 
-	if strings.HasPrefix(text, "/newchat") {
-		err := d.DB.ClearHistory(chatID, threadID)
-		if err != nil {
-			log.Printf("Failed to clear history: %v", err)
-			d.Bot.SendMessage(chatID, threadID, msgID, "Failed to reset chat context.", nil)
+	if !d.checkAccess(ctx, msg, userLang) {
+		return
+	}
+	if isCommand {
+		cmd, known := d.Commands.Lookup(pc.Name)
+		switch {
+		case !known:
+			d.Bot.SendMessage(ctx, chatID, threadID, msgID, d.Localizer.Get(userLang, "unknown_command"), nil)
+			return
+		case cmd.Scopes&scopeOf(msg) == 0:
+			d.Bot.SendMessage(ctx, chatID, threadID, msgID, d.Localizer.Get(userLang, "command_not_here"), nil)
 			return
 		}
-		resetText := "🧹 Chat context has been reset. I have forgotten our previous conversation in this topic."
-		if userLang == "id" {
-			resetText = "🧹 Konteks obrolan telah direset. Aku sudah melupakan percakapan kita sebelumnya di topik ini."
+		prompt, isPrompt := d.runCommand(ctx, msg, cmd, pc, userLang)
+		if !isPrompt {
+			return
 		}
-		d.Bot.SendMessage(chatID, threadID, msgID, resetText, nil)
-		return
+		cleanText = prompt
 	}
-
-	if strings.HasPrefix(text, "/start") {
-		welcomeText := d.Localizer.Get(userLang, "welcome")
-		d.Bot.SendMessage(chatID, threadID, 0, welcomeText, nil)
-		return
-	}
-	if strings.HasPrefix(text, "/lang") {
-		d.sendLanguageSelector(chatID, threadID, 0, userLang)
+	// Checked before voice notes and images are processed, those cost API
+	// calls too
+	if !d.allowMessage(ctx, msg, userLang) {
 		return
 	}
 
-	history, _ := d.DB.GetHistory(chatID, threadID)
-	isNewTopic := len(history) == 0
-
-	typingStop := make(chan bool)
-	go d.continuouslySendTyping(chatID, threadID, typingStop)
-
-	searchInstruction := " \n\nIMPORTANT: If you search the web, ALWAYS provide citations/sources as Markdown hyperlinks like this: [Title](URL). Do not use bare URLs or [1] format."
-	finalSystemPrompt := d.SystemPrompt + searchInstruction
+	text := cleanText
+	// Voice notes: the transcript becomes the prompt
+	if _, _, _, isAudio := audioAttachment(msg); isAudio {
+		text = d.voicePrompt(ctx, msg, cleanText, userLang)
+		if text == "" {
+			return
+		}
+	}
 
-	var messages []models.GroqMessage
-	messages = append(messages, models.GroqMessage{Role: "system", Content: finalSystemPrompt})
+	// Photos go to the vision model, with the caption as the prompt
+	ai := d.AI
+	userMessage := models.GroqMessage{Role: "user", Content: text}
+	historyText := text
+	if _, _, isImage := imageAttachment(msg); isImage {
+		m, ok := d.imageMessage(ctx, msg, text, userLang)
+		if !ok {
+			return
+		}
+		ai, userMessage, text = d.visionProvider(), m, m.Content
+		historyText = "[Image] " + text
+		ctx = usage.WithPurpose(ctx, usage.PurposeVision)
+	}
 
-	for _, h := range history {
-		role := "user"
-		if h.Role == "AI" {
-			role = "assistant"
+	// Documents: small ones are inlined, larger ones stored for retrieval
+	freshDocument := false
+	if _, isDoc := documentAttachment(msg); isDoc {
+		prompt, hist, stored, ok := d.documentPrompt(ctx, msg, text, userLang)
+		if !ok {
+			return
 		}
-		// [Pembaruan 1] Filter pesan kosong.
-		// Jika ada history kosong/spasi doang di database, JANGAN kirim ke AI.
-		// Ini mencegah AI bingung dan mengulang pesan lama.
-		if strings.TrimSpace(h.Content) != "" {
-			messages = append(messages, models.GroqMessage{Role: role, Content: h.Content})
+		text, historyText, freshDocument = prompt, hist, stored
+		userMessage = models.GroqMessage{Role: "user", Content: prompt}
+	} else if link, ok := d.wantsLinkFetch(text); ok && len(userMessage.Parts) == 0 {
+		// "summarize <link>": the page is read before answering (not for
+		// images, those keep their caption as is)
+		prompt, hist, stored, ok := d.linkPrompt(ctx, msg, link, text, userLang)
+		if !ok {
+			return
 		}
+		text, historyText, freshDocument = prompt, hist, stored
+		userMessage = models.GroqMessage{Role: "user", Content: prompt}
 	}
-
-	messages = append(messages, models.GroqMessage{Role: "user", Content: text})
-
-	aiContent, aiReasoning, err := d.AI.SendChat(messages)
-
-	typingStop <- true
-	close(typingStop)
-
-	if err != nil {
-		log.Printf("Error fetching AI response: %v", err)
-		d.Bot.SendMessage(chatID, threadID, msgID, "Error connecting to AI service (Groq).", nil)
+	if text == "" {
 		return
 	}
 
-	extractedThink, cleanBody := d.extractThinkContent(aiContent)
-
-	finalThink := aiReasoning
-	if finalThink == "" {
-		finalThink = extractedThink
+	history, _ := d.DB.GetRecentHistory(chatID, threadID, maxHistoryRows)
+	summary, err := d.DB.GetSummary(chatID, threadID)
+	if err != nil {
+		log.Printf("[ERROR] Failed to load conversation summary: %v", err)
 	}
+	isNewTopic := len(history) == 0
 
-	finalResponse := cleanBody
-	safeResponse := strings.ReplaceAll(finalResponse, "**", "*")
+	// Turns already folded into the summary are not sent again
+	var recent []database.ChatMessage
+	for _, h := range history {
+		if h.ID > summary.LastMessageID {
+			recent = append(recent, h)
+		}
+	}
 
-	if finalThink != "" && msg.Chat.Type != "private" {
-		draftID := fmt.Sprintf("%d", time.Now().UnixNano())
-		thoughtDisplay := fmt.Sprintf("🧠 %s...", finalThink)
+	typingStop := make(chan bool)
+	go d.continuouslySendTyping(ctx, chatID, threadID, typingStop)
 
-		d.Bot.SendMessageDraft(chatID, threadID, msgID, draftID, thoughtDisplay)
+	finalSystemPrompt := d.SystemPrompt
+	if d.canSearch(ai) {
+		finalSystemPrompt += searchInstruction
+	}
 
-		delay := time.Duration(len(finalThink)/50) * time.Second
-		if delay < 1*time.Second {
-			delay = 1 * time.Second
-		}
-		if delay > 3*time.Second {
-			delay = 3 * time.Second
+	head := []models.GroqMessage{{Role: "system", Content: finalSystemPrompt}}
+	if summary.Text != "" {
+		head = append(head, summaryMessage(summary.Text))
+	}
+	// Turns not yet summarized are in the prompt already, memory should
+	// bring back what isn't
+	seen := make(map[memoryKey]bool)
+	for _, h := range recent {
+		seen[memoryKey{database.MemoryMessage, h.ID}] = true
+	}
+	if excerpts, ok := d.documentContext(chatID, threadID, text, freshDocument, seen); ok {
+		head = append(head, excerpts)
+	}
+	if d.Embedder != nil && d.MemoryTopK > 0 {
+		if memories, ok := d.recall(ctx, chatID, threadID, text, seen); ok {
+			head = append(head, memories)
 		}
-		time.Sleep(delay)
 	}
+	messages := d.buildMessages(head, recent, userMessage)
 
-	var replyMarkup interface{}
+	var replyMarkup *models.InlineKeyboardMarkup
 	if msg.Chat.Type != "private" {
-		replyMarkup = models.InlineKeyboardMarkup{
+		replyMarkup = &models.InlineKeyboardMarkup{
 			InlineKeyboard: [][]models.InlineKeyboardButton{
 				{
 					{Text: "Close ❌", CallbackData: "close_msg"},
@@ -266,34 +537,100 @@ func (d *Dispatcher) handleMessage(msg *models.Message) {
 		}
 	}
 
-	err = d.Bot.SendMessage(chatID, threadID, msgID, safeResponse, replyMarkup)
-	if err != nil {
-		log.Printf("Markdown send failed, trying raw: %v", err)
-		d.Bot.SendMessage(chatID, threadID, msgID, finalResponse, replyMarkup)
+	inv := tools.Invocation{ChatID: chatID, ThreadID: threadID, UserID: userID, Sources: &tools.Sources{}}
+
+	var finalResponse, usedModel string
+	if ai.Capabilities().Streaming {
+		// Jawaban dikirim sedikit demi sedikit (draft di topik chat pribadi, edit di tempat lain)
+		stream := d.newStreamReply(ctx, msg.Chat, threadID, msgID)
+		res, err := d.complete(ctx, ai, messages, inv, stream)
+
+		close(typingStop)
+
+		if err != nil {
+			log.Printf("Error streaming AI response: %v", err)
+			stream.fail("Error connecting to AI service.")
+			return
+		}
+
+		_, finalResponse = extractThinkContent(res.Content)
+		finalResponse = d.withSources(finalResponse, inv.Sources.List(), userLang)
+		usedModel = res.Model
+		stream.finish(finalResponse, replyMarkup)
+	} else {
+		res, err := d.complete(ctx, ai, messages, inv, nil)
+
+		close(typingStop)
+
+		if err != nil {
+			log.Printf("Error fetching AI response: %v", err)
+			d.Bot.SendMessage(ctx, chatID, threadID, msgID, "Error connecting to AI service.", nil)
+			return
+		}
+		usedModel = res.Model
+
+		// Reasoning is only shown while streaming; here the answer is sent
+		// as a whole
+		_, cleanBody := extractThinkContent(res.Content)
+		finalResponse = d.withSources(cleanBody, inv.Sources.List(), userLang)
+
+		d.sendFinal(ctx, chatID, threadID, msgID, finalResponse, replyMarkup)
 	}
 
-	if strings.TrimSpace(text) != "" {
-		errUser := d.DB.AddHistory(chatID, threadID, "User", text)
+	// History disimpan sekali saja setelah jawaban lengkap
+	if strings.TrimSpace(historyText) != "" {
+		errUser := d.DB.AddHistory(chatID, threadID, "User", historyText)
 		if errUser != nil {
 			log.Printf("[ERROR] Failed to save User message to DB: %v", errUser)
 		}
 	}
 
 	if strings.TrimSpace(finalResponse) != "" {
-		errAI := d.DB.AddHistory(chatID, threadID, "AI", finalResponse)
+		errAI := d.DB.AddHistoryFrom(chatID, threadID, "AI", finalResponse, usedModel)
 		if errAI != nil {
 			log.Printf("[ERROR] Failed to save AI response to DB: %v", errAI)
 		} else {
-			log.Printf("[DEBUG] Saved AI response to DB.")
+			log.Printf("[DEBUG] Saved AI response from %s to DB.", usedModel)
 		}
 	}
 
 	if isNewTopic && threadID != 0 && msg.Chat.Type == "private" {
-		go d.generateAndSetTopicTitle(chatID, threadID, finalResponse)
+		titleCtx := usage.WithPurpose(ctx, usage.PurposeTitle)
+		d.goTracked(func() { d.generateAndSetTopicTitle(titleCtx, chatID, threadID, finalResponse) })
+	}
+
+	if d.SummaryKeepTurns > 0 {
+		summaryCtx := usage.WithPurpose(ctx, usage.PurposeSummary)
+		d.goTracked(func() { d.maybeSummarize(summaryCtx, chatID, threadID) })
+	}
+	if d.Embedder != nil {
+		d.goTracked(func() { d.remember(ctx, chatID, threadID) })
 	}
 }
 
-func (d *Dispatcher) generateAndSetTopicTitle(chatID int64, threadID int, contextText string) {
+// orDefault returns p, or fallback when p is nil.
+func orDefault(p, fallback api.ChatProvider) api.ChatProvider {
+	if p != nil {
+		return p
+	}
+	return fallback
+}
+
+// sendFinal sends a complete answer. The bot client renders the Markdown
+// and falls back to plain text if Telegram cannot parse it.
+func (d *Dispatcher) sendFinal(ctx context.Context, chatID int64, threadID, replyToID int, text string, replyMarkup *models.InlineKeyboardMarkup) {
+	var markup interface{}
+	if replyMarkup != nil {
+		markup = replyMarkup
+	}
+
+	_, err := d.Bot.SendMessage(ctx, chatID, threadID, replyToID, text, markup)
+	if bot.IsBotBlocked(err) {
+		log.Printf("[INFO] Bot cannot write to chat %d anymore: %v", chatID, err)
+	}
+}
+
+func (d *Dispatcher) generateAndSetTopicTitle(ctx context.Context, chatID int64, threadID int, contextText string) {
 	if len(contextText) > 500 {
 		contextText = contextText[:500]
 	}
@@ -305,13 +642,13 @@ func (d *Dispatcher) generateAndSetTopicTitle(chatID int64, threadID int, contex
 		{Role: "user", Content: prompt},
 	}
 
-	title, _, err := d.AI.SendChat(msgs)
+	title, _, err := orDefault(d.TitleAI, d.AI).SendChat(ctx, msgs)
 	if err != nil {
 		log.Printf("Failed to generate title: %v", err)
 		return
 	}
 
-	_, cleanTitle := d.extractThinkContent(title)
+	_, cleanTitle := extractThinkContent(title)
 	cleanTitle = strings.ReplaceAll(cleanTitle, "*", "")
 	cleanTitle = strings.ReplaceAll(cleanTitle, "\"", "")
 	cleanTitle = strings.ReplaceAll(cleanTitle, ".", "")
@@ -322,30 +659,36 @@ func (d *Dispatcher) generateAndSetTopicTitle(chatID int64, threadID int, contex
 	}
 
 	log.Printf("Renaming topic %d to: %s", threadID, cleanTitle)
-	d.Bot.EditForumTopic(chatID, threadID, cleanTitle)
+	d.Bot.EditForumTopic(ctx, chatID, threadID, cleanTitle)
 }
 
-func (d *Dispatcher) handleCallback(cb *models.CallbackQuery) {
+func (d *Dispatcher) handleCallback(ctx context.Context, cb *models.CallbackQuery) {
+	// Buttons of inline messages and of messages too old to be sent along
+	// come without Message; there is nothing to act on
+	if cb.Message == nil {
+		d.Bot.AnswerCallbackQuery(ctx, cb.ID)
+		return
+	}
 	userID := cb.From.ID
 	chatID := cb.Message.Chat.ID
-	threadID := cb.Message.MessageThreadID 
+	threadID := cb.Message.MessageThreadID
 
 	msgID := cb.Message.MessageID
 
-	d.Bot.AnswerCallbackQuery(cb.ID)
+	d.Bot.AnswerCallbackQuery(ctx, cb.ID)
 
 	if cb.Data == "close_msg" {
 		username := cb.From.Username
 		if username == "" {
 			username = cb.From.FirstName
 		}
-		
-		closedText := fmt.Sprintf("_Response closed by @%s_", username)
-		
+
+		closedText := fmt.Sprintf("_Response closed by @%s_", render.EscapeMarkdown(username))
+
 		// PERBAIKAN: Tambahkan string kosong "" sebagai parameter ke-3 (inlineMessageID)
-		err := d.Bot.EditMessageText(chatID, msgID, "", closedText) 
-		
-		if err != nil {
+		err := d.Bot.EditMessageText(ctx, chatID, msgID, "", closedText, nil)
+
+		if err != nil && !bot.IsMessageNotModified(err) {
 			log.Printf("Error closing message: %v", err)
 		}
 		return
@@ -357,15 +700,15 @@ func (d *Dispatcher) handleCallback(cb *models.CallbackQuery) {
 			log.Printf("Error setting language: %v", err)
 			return
 		}
-		
+
 		confirmText := d.Localizer.Get(newLang, "lang_set")
-		d.Bot.SendMessage(chatID, threadID, 0, confirmText, nil)
+		d.Bot.SendMessage(ctx, chatID, threadID, 0, confirmText, nil)
 	}
 }
 
-func (d *Dispatcher) sendLanguageSelector(chatID int64, threadID int, replyToID int, currentLang string) {
+func (d *Dispatcher) sendLanguageSelector(ctx context.Context, chatID int64, threadID int, replyToID int, currentLang string) {
 	text := d.Localizer.Get(currentLang, "choose_lang")
-	
+
 	keyboard := models.InlineKeyboardMarkup{
 		InlineKeyboard: [][]models.InlineKeyboardButton{
 			{
@@ -375,5 +718,5 @@ func (d *Dispatcher) sendLanguageSelector(chatID int64, threadID int, replyToID
 		},
 	}
 
-	d.Bot.SendMessage(chatID, threadID, replyToID, text, keyboard)
-}
\ No newline at end of file
+	d.Bot.SendMessage(ctx, chatID, threadID, replyToID, text, keyboard)
+}
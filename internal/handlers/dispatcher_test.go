@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"telechatbot/internal/bot"
+	"telechatbot/internal/models"
+	"testing"
+)
+
+// botCall is one Bot API request seen by fakeTelegram.
+type botCall struct {
+	Method string
+	Body   map[string]interface{}
+}
+
+// fakeTelegram is a Bot API server that answers every method with result,
+// or with the response set in Results for that method.
+type fakeTelegram struct {
+	mu      sync.Mutex
+	calls   []botCall
+	Results map[string]string
+}
+
+func newFakeTelegram(t *testing.T) (*bot.Client, *fakeTelegram) {
+	t.Helper()
+	f := &fakeTelegram{Results: make(map[string]string)}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method := strings.TrimPrefix(r.URL.Path, "/botTOKEN/")
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+
+		f.mu.Lock()
+		f.calls = append(f.calls, botCall{method, body})
+		result, ok := f.Results[method]
+		f.mu.Unlock()
+		if !ok {
+			result = "true"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":true,"result":` + result + `}`))
+	}))
+	t.Cleanup(srv.Close)
+	return bot.NewClientWithAPIURL("TOKEN", srv.URL), f
+}
+
+// Calls returns the requests made so far for method, or all of them for "".
+func (f *fakeTelegram) Calls(method string) []botCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []botCall
+	for _, c := range f.calls {
+		if method == "" || c.Method == method {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func TestCallbackWithoutMessage(t *testing.T) {
+	b, tg := newFakeTelegram(t)
+	d := &Dispatcher{Bot: b}
+
+	d.handleCallback(context.Background(), &models.CallbackQuery{
+		ID:   "cb1",
+		From: &models.User{ID: 1},
+		Data: "close_msg",
+	})
+
+	calls := tg.Calls("")
+	if len(calls) != 1 || calls[0].Method != "answerCallbackQuery" || calls[0].Body["callback_query_id"] != "cb1" {
+		t.Errorf("got calls %+v", calls)
+	}
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"telechatbot/internal/database"
+	"telechatbot/internal/documents"
+	"telechatbot/internal/models"
+)
+
+const (
+	documentChunkChars   = 1500
+	documentChunkOverlap = 200
+	// maxDocumentChunks bounds how many stored chunks are ranked per message
+	maxDocumentChunks = 2000
+	// documentExcerpts is the most chunks injected into one prompt
+	documentExcerpts = 6
+	// documentIntroChunks of a just sent document are always included
+	documentIntroChunks = 2
+)
+
+// defaultDocumentPrompt is used for documents sent without a caption.
+const defaultDocumentPrompt = "Briefly summarize this document and tell me what it is about."
+
+// documentAttachment returns a non-image document of msg (images are
+// handled by the vision path).
+func documentAttachment(msg *models.Message) (*models.Document, bool) {
+	if msg.Document == nil {
+		return nil, false
+	}
+	if _, _, isImage := imageAttachment(msg); isImage {
+		return nil, false
+	}
+	return msg.Document, true
+}
+
+// documentPrompt reads the document of msg. Small documents are inlined
+// into the returned prompt (and so into history); larger ones are chunked
+// and stored for retrieval and stored is true. It replies to the user
+// itself when the document can't be used and then returns ok == false.
+func (d *Dispatcher) documentPrompt(ctx context.Context, msg *models.Message, question, userLang string) (prompt, historyText string, stored, ok bool) {
+	doc := msg.Document
+	threadID := messageThreadID(msg)
+	reply := func(key string) {
+		d.Bot.SendMessage(ctx, msg.Chat.ID, threadID, msg.MessageID, d.Localizer.Get(userLang, key), nil)
+	}
+
+	if !documents.IsSupported(doc.FileName, doc.MimeType) {
+		reply("document_unsupported")
+		return "", "", false, false
+	}
+	if doc.FileSize > d.MaxDocumentBytes {
+		reply("document_too_large")
+		return "", "", false, false
+	}
+
+	d.Bot.SendChatAction(ctx, msg.Chat.ID, threadID, "typing")
+	content, err := d.readDocument(ctx, doc)
+	if err != nil {
+		log.Printf("[ERROR] Failed to read document %q: %v", doc.FileName, err)
+		switch {
+		case errors.Is(err, documents.ErrNoText):
+			reply("document_no_text")
+		case errors.Is(err, errDocumentTooLarge), errors.Is(err, documents.ErrPDFTooLarge):
+			reply("document_too_large")
+		default:
+			reply("document_failed")
+		}
+		return "", "", false, false
+	}
+
+	if question == "" {
+		question = defaultDocumentPrompt
+	}
+
+	// Small enough to send whole: no retrieval needed
+	if d.Tokens.Count(content) <= d.ContextTokens/3 {
+		prompt = question + "\n\n" + inlineDocument(doc.FileName, content)
+		return prompt, prompt, false, true
+	}
+
+	chunks := documents.Chunk(content, documentChunkChars, documentChunkOverlap)
+	if _, err := d.DB.AddDocument(msg.Chat.ID, threadID, doc.FileName, chunks); err != nil {
+		log.Printf("[ERROR] Failed to store document %q: %v", doc.FileName, err)
+		reply("document_failed")
+		return "", "", false, false
+	}
+	log.Printf("[INFO] Stored document %q as %d chunks for chat %d thread %d", doc.FileName, len(chunks), msg.Chat.ID, threadID)
+
+	prompt = fmt.Sprintf("(I sent the document %q.) %s", doc.FileName, question)
+	return prompt, "[Document: " + doc.FileName + "] " + question, true, true
+}
+
+var errDocumentTooLarge = errors.New("document too large")
+
+func (d *Dispatcher) readDocument(ctx context.Context, doc *models.Document) (string, error) {
+	file, err := d.Bot.GetFile(ctx, doc.FileID)
+	if err != nil {
+		return "", fmt.Errorf("getFile: %w", err)
+	}
+	if file.FileSize > d.MaxDocumentBytes {
+		return "", errDocumentTooLarge
+	}
+	data, err := d.Bot.DownloadFile(ctx, file, d.MaxDocumentBytes)
+	if err != nil {
+		return "", fmt.Errorf("download: %w", err)
+	}
+	return documents.Extract(doc.FileName, doc.MimeType, data)
+}
+
+// inlineDocument wraps a document so the model can tell it apart from the
+// question; source code goes in a fenced block.
+func inlineDocument(name, content string) string {
+	if lang := documents.CodeLanguage(name); lang != "" {
+		return "File " + name + ":\n```" + lang + "\n" + content + "\n```"
+	}
+	return "--- " + name + " ---\n" + content + "\n--- end of " + name + " ---"
+}
+
+// documentContext returns the stored document chunks most relevant to
+// query as a system message, or false if the conversation has no
+// documents or nothing matches. With fresh (the document was just sent)
+// the beginning of the newest document is always included. Chunks put in
+// the prompt are marked in seen.
+func (d *Dispatcher) documentContext(chatID int64, threadID int, query string, fresh bool, seen map[memoryKey]bool) (models.GroqMessage, bool) {
+	chunks, err := d.DB.GetDocumentChunks(chatID, threadID, maxDocumentChunks)
+	if err != nil {
+		log.Printf("[ERROR] Failed to load document chunks: %v", err)
+		return models.GroqMessage{}, false
+	}
+	if len(chunks) == 0 {
+		return models.GroqMessage{}, false
+	}
+
+	texts := make([]string, len(chunks))
+	for i, c := range chunks {
+		texts[i] = c.Content
+	}
+	ranked := documents.Rank(query, texts, documentExcerpts)
+
+	var picked []int
+	if fresh {
+		// Chunks are ordered newest document first; its beginning usually
+		// says what the document is, which a first question needs
+		for i := 0; i < len(chunks) && i < documentIntroChunks && chunks[i].DocumentID == chunks[0].DocumentID; i++ {
+			picked = append(picked, i)
+		}
+	}
+	intro := len(picked)
+	for _, i := range ranked {
+		if len(picked) >= documentExcerpts {
+			break
+		}
+		if i >= intro {
+			picked = append(picked, i)
+		}
+	}
+	if len(picked) == 0 {
+		return models.GroqMessage{}, false
+	}
+
+	return models.GroqMessage{Role: "system", Content: d.formatExcerpts(chunks, picked, seen)}, true
+}
+
+// formatExcerpts lists the picked chunks within a third of the context
+// budget, labelled with file name and position.
+func (d *Dispatcher) formatExcerpts(chunks []database.DocumentChunk, picked []int, seen map[memoryKey]bool) string {
+	var b strings.Builder
+	b.WriteString("Excerpts from documents the user shared in this conversation. Use them to answer and mention the file name when you do:\n")
+
+	budget := d.ContextTokens / 3
+	for _, i := range picked {
+		c := chunks[i]
+		part := fmt.Sprintf("\n[%s, part %d]\n%s\n", c.FileName, c.Index+1, c.Content)
+		cost := d.Tokens.Count(part)
+		if cost > budget {
+			break
+		}
+		budget -= cost
+		b.WriteString(part)
+		seen[memoryKey{database.MemoryDocument, c.ID}] = true
+	}
+	return b.String()
+}
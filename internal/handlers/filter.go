@@ -5,9 +5,18 @@ import (
 	"telechatbot/internal/models"
 )
 
+// ShouldProcessMessage decides whether a message that is not a command is
+// meant for the bot and returns its text without the mention. Commands
+// are handled by the CommandRegistry.
 func ShouldProcessMessage(msg *models.Message, botUsername string) (bool, string) {
 	text := strings.TrimSpace(msg.Text)
 	if text == "" {
+		text = strings.TrimSpace(msg.Caption)
+	}
+	// A voice note, photo or document may have no text at all but is
+	// still a prompt. The text returned for it is the (cleaned) caption,
+	// possibly empty.
+	if text == "" && !hasAttachment(msg) {
 		return false, ""
 	}
 
@@ -15,24 +24,6 @@ func ShouldProcessMessage(msg *models.Message, botUsername string) (bool, string
 		return true, text
 	}
 
-	// [Pembaruan 1] Command dengan argumen (contoh: /ask pertanyaan)
-	// Ini tetap dibersihkan agar AI hanya menerima pertanyaannya
-	if strings.HasPrefix(text, "/ask") {
-		return true, cleanTrigger(text, "/ask")
-	}
-	if strings.HasPrefix(text, "/ai") {
-		return true, cleanTrigger(text, "/ai")
-	}
-
-	// [Pembaruan 2] Command TANPA argumen (Action Commands)
-	// Kita harus mengembalikan string command-nya agar tidak dianggap pesan kosong oleh dispatcher
-	if strings.HasPrefix(text, "/newchat") {
-		return true, "/newchat"
-	}
-	if strings.HasPrefix(text, "/lang") {
-		return true, "/lang"
-	}
-
 	// B. Check for Mention Trigger (@BotName)
 	if botUsername != "" && strings.Contains(text, "@"+botUsername) {
 		cleaned := strings.ReplaceAll(text, "@"+botUsername, "")
@@ -49,8 +40,10 @@ func ShouldProcessMessage(msg *models.Message, botUsername string) (bool, string
 	return false, ""
 }
 
-// cleanTrigger removes the command prefix and extra spaces
-func cleanTrigger(text, prefix string) string {
-	cleaned := strings.TrimPrefix(text, prefix)
-	return strings.TrimSpace(cleaned)
-}
\ No newline at end of file
+// hasAttachment reports media the dispatcher turns into a prompt
+func hasAttachment(msg *models.Message) bool {
+	_, _, _, isAudio := audioAttachment(msg)
+	_, _, isImage := imageAttachment(msg)
+	_, isDoc := documentAttachment(msg)
+	return isAudio || isImage || isDoc
+}
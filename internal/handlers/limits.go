@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"telechatbot/internal/limits"
+	"telechatbot/internal/models"
+	"time"
+)
+
+// noticeInterval is how often a limited or refused user is told so;
+// further messages in between are dropped silently instead of spamming
+// the chat
+const noticeInterval = 30 * time.Second
+
+// allowMessage checks the limits for a message that goes to the model and
+// replies with when to try again if it may not.
+func (d *Dispatcher) allowMessage(ctx context.Context, msg *models.Message, userLang string) bool {
+	denial, ok := d.Limiter.Allow(msg.From.ID, msg.Chat.ID)
+	if ok {
+		return true
+	}
+	log.Printf("[INFO] User %d in chat %d hit the %s limit", msg.From.ID, msg.Chat.ID, denialName(denial))
+	if d.shouldNotice(msg.From.ID) {
+		d.Bot.SendMessage(ctx, msg.Chat.ID, messageThreadID(msg), msg.MessageID, d.limitText(denial, userLang), nil)
+	}
+	return false
+}
+
+// shouldNotice reports whether userID hasn't been told about a limit or
+// missing access within noticeInterval, and remembers that they are told
+// now.
+func (d *Dispatcher) shouldNotice(userID int64) bool {
+	now := time.Now()
+	if last, ok := d.notices.Load(userID); ok && now.Sub(last.(time.Time)) < noticeInterval {
+		return false
+	}
+	d.notices.Store(userID, now)
+	return true
+}
+
+// limitText is the localized "limit reached, resets in X" reply.
+func (d *Dispatcher) limitText(denial limits.Denial, userLang string) string {
+	return fmt.Sprintf(d.Localizer.Get(userLang, "limit_"+denialName(denial)), formatWait(denial.ResetIn))
+}
+
+// denialName is e.g. "user_rate" or "chat_tokens".
+func denialName(denial limits.Denial) string {
+	if denial.Tokens {
+		return denial.Scope + "_tokens"
+	}
+	return denial.Scope + "_rate"
+}
+
+// formatWait shows a wait as "45s", "12m" or "3h 20m", rounded up.
+func formatWait(d time.Duration) string {
+	secs := int((d + time.Second - 1) / time.Second)
+	switch {
+	case secs < 60:
+		return fmt.Sprintf("%ds", secs)
+	case secs < 3600:
+		return fmt.Sprintf("%dm", (secs+59)/60)
+	}
+	mins := (secs + 59) / 60
+	return fmt.Sprintf("%dh %dm", mins/60, mins%60)
+}
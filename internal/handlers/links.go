@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"telechatbot/internal/documents"
+	"telechatbot/internal/models"
+	"telechatbot/internal/webfetch"
+)
+
+// DefaultLinkTriggers make a message with a link fetch the page before
+// answering. Matched case-insensitively anywhere in the text.
+var DefaultLinkTriggers = []string{
+	"summarize", "summarise", "summary", "tl;dr", "tldr", "what does this say",
+	"read this", "explain this", "ringkas", "rangkum", "intisari", "jelaskan", "baca",
+}
+
+var reLink = regexp.MustCompile(`https?://[^\s<>"'\x60]+`)
+
+// findLink returns the first http(s) link in text.
+func findLink(text string) (string, bool) {
+	link := reLink.FindString(text)
+	if link == "" {
+		return "", false
+	}
+	// Punctuation right after a link belongs to the sentence
+	link = strings.TrimRight(link, ".,;:!?")
+	if strings.HasSuffix(link, ")") && !strings.Contains(link, "(") {
+		link = strings.TrimSuffix(link, ")")
+	}
+	return link, true
+}
+
+// wantsLinkFetch reports whether text has a link and one of d.LinkTriggers.
+func (d *Dispatcher) wantsLinkFetch(text string) (string, bool) {
+	link, ok := findLink(text)
+	if !ok || d.Fetcher == nil {
+		return "", false
+	}
+	rest := strings.ToLower(strings.Replace(text, link, " ", 1))
+	for _, t := range d.LinkTriggers {
+		if t != "" && strings.Contains(rest, strings.ToLower(t)) {
+			return link, true
+		}
+	}
+	return "", false
+}
+
+// linkPrompt fetches link and, like documentPrompt, inlines a short page
+// or stores a long one for retrieval (stored is true). It replies to the
+// user itself when the page can't be read and returns ok == false.
+func (d *Dispatcher) linkPrompt(ctx context.Context, msg *models.Message, link, question, userLang string) (prompt, historyText string, stored, ok bool) {
+	threadID := messageThreadID(msg)
+	d.Bot.SendChatAction(ctx, msg.Chat.ID, threadID, "typing")
+
+	page, err := d.Fetcher.Fetch(ctx, link)
+	if err != nil {
+		log.Printf("[WARN] Failed to fetch %s: %v", link, err)
+		key := "link_failed"
+		switch {
+		case errors.Is(err, webfetch.ErrUnsupportedType):
+			key = "link_unsupported"
+		case errors.Is(err, webfetch.ErrTooLarge):
+			key = "link_too_large"
+		case errors.Is(err, webfetch.ErrNoText):
+			key = "link_no_text"
+		}
+		d.Bot.SendMessage(ctx, msg.Chat.ID, threadID, msg.MessageID, d.Localizer.Get(userLang, key), nil)
+		return "", "", false, false
+	}
+
+	name := page.Title
+	if name == "" {
+		name = page.URL
+	}
+
+	if d.Tokens.Count(page.Text) <= d.ContextTokens/3 {
+		prompt = question + "\n\n" + "--- " + name + " (" + page.URL + ") ---\n" + page.Text + "\n--- end of page ---"
+		return prompt, prompt, false, true
+	}
+
+	chunks := documents.Chunk(page.Text, documentChunkChars, documentChunkOverlap)
+	if _, err := d.DB.AddDocument(msg.Chat.ID, threadID, name, chunks); err != nil {
+		log.Printf("[ERROR] Failed to store page %s: %v", page.URL, err)
+		d.Bot.SendMessage(ctx, msg.Chat.ID, threadID, msg.MessageID, d.Localizer.Get(userLang, "link_failed"), nil)
+		return "", "", false, false
+	}
+	log.Printf("[INFO] Stored page %s as %d chunks for chat %d thread %d", page.URL, len(chunks), msg.Chat.ID, threadID)
+
+	prompt = fmt.Sprintf("(The page %q at %s was fetched, see the excerpts.) %s", name, page.URL, question)
+	return prompt, "[Page: " + name + "] " + question, true, true
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"telechatbot/internal/database"
+	"telechatbot/internal/models"
+)
+
+const (
+	// memoryBackfill is the most items embedded per run; older history is
+	// backfilled over several replies
+	memoryBackfill = 200
+	memoryBatch    = 64
+	// memoryMaxChars is cut from texts before embedding and display
+	memoryMaxChars = 2000
+)
+
+// memoryKey identifies a memory source, see database.MemoryMessage
+type memoryKey struct {
+	source string
+	id     int64
+}
+
+// remember embeds turns and document chunks of the conversation that have
+// no vector yet. It runs in the background after each reply; only one run
+// per conversation at a time.
+func (d *Dispatcher) remember(ctx context.Context, chatID int64, threadID int) {
+	key := ConversationKey{ChatID: chatID, ThreadID: threadID}
+	if _, running := d.remembering.LoadOrStore(key, true); running {
+		return
+	}
+	defer d.remembering.Delete(key)
+
+	model := d.Embedder.Model()
+	var items []database.MemoryItem
+
+	turns, err := d.DB.UnembeddedHistory(chatID, threadID, model, memoryBackfill)
+	if err != nil {
+		log.Printf("[ERROR] Failed to load history for memory: %v", err)
+		return
+	}
+	for _, t := range turns {
+		if strings.TrimSpace(t.Content) == "" {
+			continue
+		}
+		items = append(items, database.MemoryItem{
+			Source:   database.MemoryMessage,
+			SourceID: t.ID,
+			Content:  t.Role + ": " + truncateRunes(t.Content, memoryMaxChars),
+		})
+	}
+
+	if len(items) < memoryBackfill {
+		chunks, err := d.DB.UnembeddedChunks(chatID, threadID, model, memoryBackfill-len(items))
+		if err != nil {
+			log.Printf("[ERROR] Failed to load document chunks for memory: %v", err)
+			return
+		}
+		for _, c := range chunks {
+			items = append(items, database.MemoryItem{
+				Source:   database.MemoryDocument,
+				SourceID: c.ID,
+				Content:  fmt.Sprintf("[%s, part %d] %s", c.FileName, c.Index+1, truncateRunes(c.Content, memoryMaxChars)),
+			})
+		}
+	}
+
+	for start := 0; start < len(items); start += memoryBatch {
+		batch := items[start:min(start+memoryBatch, len(items))]
+		texts := make([]string, len(batch))
+		for i, it := range batch {
+			texts[i] = it.Content
+		}
+
+		vectors, err := d.Embedder.Embed(ctx, texts)
+		if err != nil {
+			log.Printf("[ERROR] Failed to embed memory: %v", err)
+			return
+		}
+		for i := range batch {
+			batch[i].Vector = vectors[i]
+		}
+		if err := d.DB.AddMemory(chatID, threadID, model, batch); err != nil {
+			log.Printf("[ERROR] Failed to save memory: %v", err)
+			return
+		}
+	}
+}
+
+// recall returns earlier messages and document parts relevant to query as
+// a system message, skipping what is already in the prompt (seen).
+func (d *Dispatcher) recall(ctx context.Context, chatID int64, threadID int, query string, seen map[memoryKey]bool) (models.GroqMessage, bool) {
+	if strings.TrimSpace(query) == "" {
+		return models.GroqMessage{}, false
+	}
+
+	vectors, err := d.Embedder.Embed(ctx, []string{truncateRunes(query, memoryMaxChars)})
+	if err != nil {
+		log.Printf("[ERROR] Failed to embed query: %v", err)
+		return models.GroqMessage{}, false
+	}
+	// Ask for extra matches, some are usually already in the prompt
+	matches, err := d.DB.SearchMemory(chatID, threadID, d.Embedder.Model(), vectors[0], d.MemoryTopK*3, d.MemoryMinScore)
+	if err != nil {
+		log.Printf("[ERROR] Failed to search memory: %v", err)
+		return models.GroqMessage{}, false
+	}
+
+	var b strings.Builder
+	b.WriteString("Possibly relevant earlier messages and document parts from this conversation (older context, may be outdated):\n")
+	budget := d.ContextTokens / 4
+	found := 0
+	for _, m := range matches {
+		if found >= d.MemoryTopK {
+			break
+		}
+		if seen[memoryKey{m.Source, m.SourceID}] {
+			continue
+		}
+		part := "\n- " + m.Content + "\n"
+		cost := d.Tokens.Count(part)
+		if cost > budget {
+			continue
+		}
+		budget -= cost
+		b.WriteString(part)
+		found++
+	}
+	if found == 0 {
+		return models.GroqMessage{}, false
+	}
+	return models.GroqMessage{Role: "system", Content: b.String()}, true
+}
+
+func truncateRunes(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n]) + " …"
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"telechatbot/internal/api"
+	"telechatbot/internal/bot"
+	"telechatbot/internal/database"
+	"testing"
+)
+
+func newMemoryDispatcher(t *testing.T) *Dispatcher {
+	t.Helper()
+	db, err := database.OpenDB(filepath.Join(t.TempDir(), "bot.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Conn.Close() })
+	if _, err := db.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDispatcher(bot.NewClientWithAPIURL("TOKEN", "http://127.0.0.1:0"), nil, db, nil, "", "testbot")
+	d.Embedder = api.NewHashEmbedder(0)
+	d.MemoryMinScore = 0.1
+	return d
+}
+
+func TestRecallSkipsSeenMessages(t *testing.T) {
+	d := newMemoryDispatcher(t)
+	ctx := context.Background()
+
+	for _, turn := range []struct{ role, content string }{
+		{"user", "The wifi password for the office router is hunter2"},
+		{"assistant", "Noted, the office router wifi password is hunter2"},
+		{"user", "Remind me to water the plants on Friday"},
+	} {
+		if err := d.DB.AddHistory(1, 0, turn.role, turn.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d.remember(ctx, 1, 0)
+
+	history, err := d.DB.GetHistory(1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := "what is the office wifi password?"
+
+	msg, ok := d.recall(ctx, 1, 0, query, map[memoryKey]bool{})
+	if !ok || msg.Role != "system" {
+		t.Fatalf("nothing recalled: %+v", msg)
+	}
+	if !strings.Contains(msg.Content, "user: The wifi password") || !strings.Contains(msg.Content, "assistant: Noted") {
+		t.Errorf("recall missed the relevant turns:\n%s", msg.Content)
+	}
+	if strings.Contains(msg.Content, "plants") {
+		t.Errorf("recall included an unrelated turn:\n%s", msg.Content)
+	}
+
+	// The turn already in the prompt is left out
+	seen := map[memoryKey]bool{{database.MemoryMessage, history[0].ID}: true}
+	msg, ok = d.recall(ctx, 1, 0, query, seen)
+	if !ok {
+		t.Fatal("nothing recalled")
+	}
+	if strings.Contains(msg.Content, "user: The wifi password") || !strings.Contains(msg.Content, "assistant: Noted") {
+		t.Errorf("got:\n%s", msg.Content)
+	}
+
+	// Nothing left once every match is seen
+	seen[memoryKey{database.MemoryMessage, history[1].ID}] = true
+	if msg, ok := d.recall(ctx, 1, 0, query, seen); ok {
+		t.Errorf("recalled seen turns:\n%s", msg.Content)
+	}
+}
+
+func TestRecallTopK(t *testing.T) {
+	d := newMemoryDispatcher(t)
+	d.MemoryTopK = 2
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		d.DB.AddHistory(1, 0, "user", "deployment notes for the staging cluster, item "+string(rune('a'+i)))
+	}
+	d.remember(ctx, 1, 0)
+
+	msg, ok := d.recall(ctx, 1, 0, "staging cluster deployment notes", nil)
+	if !ok {
+		t.Fatal("nothing recalled")
+	}
+	if n := strings.Count(msg.Content, "\n- "); n != 2 {
+		t.Errorf("recalled %d items, want 2:\n%s", n, msg.Content)
+	}
+}
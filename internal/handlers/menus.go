@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"telechatbot/internal/models"
+)
+
+// menuLanguage is the language of the menus for users whose language has
+// no menu of its own (language_code "")
+const menuLanguage = "en"
+
+// commandMenu is the command list Telegram shows in one scope.
+type commandMenu struct {
+	scope models.BotCommandScope
+	// where are the chats the commands must be usable in
+	where CommandScope
+	admin bool
+	// off publishes no commands, e.g. for group members when only group
+	// admins may talk to the bot
+	off bool
+}
+
+// commandMenus lists the menus of the registry: private chats, groups,
+// group admins, and the private chat of every bot admin (with the admin
+// commands).
+func (d *Dispatcher) commandMenus() []commandMenu {
+	groupsOff := d.Access != nil && d.Access.GroupAdminsOnly
+	menus := []commandMenu{
+		{scope: models.BotCommandScope{Type: "all_private_chats"}, where: ScopePrivate},
+		{scope: models.BotCommandScope{Type: "all_group_chats"}, where: ScopeGroup | ScopeTopic, off: groupsOff},
+		{scope: models.BotCommandScope{Type: "all_chat_administrators"}, where: ScopeGroup | ScopeTopic},
+	}
+
+	admins := make([]int64, 0, len(d.Admins))
+	for id := range d.Admins {
+		admins = append(admins, id)
+	}
+	sort.Slice(admins, func(i, j int) bool { return admins[i] < admins[j] })
+	for _, id := range admins {
+		menus = append(menus, commandMenu{scope: models.BotCommandScope{Type: "chat", ChatID: id}, where: ScopePrivate, admin: true})
+	}
+	return menus
+}
+
+// menuCommands builds the commands of a menu with the descriptions in
+// lang. Aliases are left out to keep the menu short.
+func (d *Dispatcher) menuCommands(m commandMenu, lang string) []models.BotCommand {
+	if m.off {
+		return nil
+	}
+	if lang == "" {
+		lang = menuLanguage
+	}
+	var out []models.BotCommand
+	for _, c := range d.Commands.Commands() {
+		if c.Scopes&m.where == 0 || (c.AdminOnly && !m.admin) {
+			continue
+		}
+		desc := d.Localizer.Get(lang, c.Description)
+		if r := []rune(desc); len(r) > 256 {
+			desc = string(r[:256])
+		}
+		out = append(out, models.BotCommand{Command: c.Name, Description: desc})
+	}
+	return out
+}
+
+// SyncCommandMenus publishes the command menus for every scope and
+// language, skipping those Telegram already has. It only runs at startup:
+// the registry, the admins and GROUP_ADMINS_ONLY are all fixed by then,
+// so added, removed or renamed commands reach the menus on the next
+// restart. Commands registered later work but are not in the menus until
+// then. Admins removed from the config keep their menu until it is
+// deleted.
+func (d *Dispatcher) SyncCommandMenus(ctx context.Context) {
+	langs := []string{""}
+	for _, l := range d.Localizer.Languages() {
+		if l != menuLanguage {
+			langs = append(langs, l)
+		}
+	}
+
+	updated, unchanged := 0, 0
+	for _, m := range d.commandMenus() {
+		for _, lang := range langs {
+			want := d.menuCommands(m, lang)
+			have, err := d.Bot.GetMyCommands(ctx, m.scope, lang)
+			if err != nil {
+				log.Printf("[WARN] Failed to get commands of %s %q: %v", menuName(m.scope), lang, err)
+				continue
+			}
+			if sameCommands(have, want) {
+				unchanged++
+				continue
+			}
+
+			if len(want) == 0 {
+				err = d.Bot.DeleteMyCommands(ctx, m.scope, lang)
+			} else {
+				err = d.Bot.SetMyCommands(ctx, want, m.scope, lang)
+			}
+			if err != nil {
+				log.Printf("[WARN] Failed to set commands of %s %q: %v", menuName(m.scope), lang, err)
+				continue
+			}
+			updated++
+		}
+	}
+	log.Printf("[INFO] Command menus synced: %d updated, %d unchanged", updated, unchanged)
+}
+
+func menuName(scope models.BotCommandScope) string {
+	if scope.Type == "chat" {
+		return fmt.Sprintf("admin chat %d", scope.ChatID)
+	}
+	return scope.Type
+}
+
+func sameCommands(a, b []models.BotCommand) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
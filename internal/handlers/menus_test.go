@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"telechatbot/internal/access"
+	"telechatbot/internal/i18n"
+	"telechatbot/internal/models"
+	"testing"
+)
+
+// menuKey names a setMyCommands call by scope and language.
+type menuKey struct {
+	scope string
+	lang  string
+}
+
+// sentMenus decodes the setMyCommands calls into command name lists.
+func sentMenus(t *testing.T, tg *fakeTelegram) map[menuKey][]models.BotCommand {
+	t.Helper()
+	out := make(map[menuKey][]models.BotCommand)
+	for _, c := range tg.Calls("setMyCommands") {
+		var req struct {
+			Commands     []models.BotCommand    `json:"commands"`
+			Scope        models.BotCommandScope `json:"scope"`
+			LanguageCode string                 `json:"language_code"`
+		}
+		raw, _ := json.Marshal(c.Body)
+		if err := json.Unmarshal(raw, &req); err != nil {
+			t.Fatal(err)
+		}
+		out[menuKey{menuName(req.Scope), req.LanguageCode}] = req.Commands
+	}
+	return out
+}
+
+func commandNames(commands []models.BotCommand) []string {
+	var names []string
+	for _, c := range commands {
+		names = append(names, c.Command)
+	}
+	return names
+}
+
+func TestSyncCommandMenus(t *testing.T) {
+	t.Chdir("../..") // locales/
+	b, tg := newFakeTelegram(t)
+	tg.Results["getMyCommands"] = "[]"
+	d := NewDispatcher(b, nil, nil, i18n.NewLocalizer(), "", "testbot")
+	d.Admins = map[int64]bool{42: true}
+	d.Commands = NewCommandRegistry(
+		&Command{Name: "start", Description: "cmd_start"},
+		&Command{Name: "lang", Aliases: []string{"language"}, Description: "cmd_lang", Scopes: ScopePrivate},
+		&Command{Name: "newchat", Description: "cmd_newchat", Scopes: ScopeGroup | ScopeTopic},
+		&Command{Name: "keys", Description: "cmd_keys", AdminOnly: true},
+	)
+
+	d.SyncCommandMenus(context.Background())
+
+	menus := sentMenus(t, tg)
+	want := map[string][]string{
+		"all_private_chats":       {"start", "lang"},
+		"all_group_chats":         {"start", "newchat"},
+		"all_chat_administrators": {"start", "newchat"},
+		"admin chat 42":           {"start", "lang", "keys"},
+	}
+	if len(menus) != 2*len(want) {
+		t.Errorf("%d menus sent, want %d: %v", len(menus), 2*len(want), menus)
+	}
+	for scope, names := range want {
+		for _, lang := range []string{"", "id"} {
+			got := commandNames(menus[menuKey{scope, lang}])
+			if len(got) != len(names) {
+				t.Errorf("%s %q: got %v, want %v", scope, lang, got, names)
+				continue
+			}
+			for i := range names {
+				if got[i] != names[i] {
+					t.Errorf("%s %q: got %v, want %v", scope, lang, got, names)
+					break
+				}
+			}
+		}
+	}
+
+	// Descriptions are in the menu's language, English by default
+	if got := menus[menuKey{"all_private_chats", ""}][0].Description; got != d.Localizer.Get("en", "cmd_start") {
+		t.Errorf("default description %q", got)
+	}
+	if got := menus[menuKey{"all_private_chats", "id"}][0].Description; got != d.Localizer.Get("id", "cmd_start") || got == d.Localizer.Get("en", "cmd_start") {
+		t.Errorf("Indonesian description %q", got)
+	}
+}
+
+func TestSyncCommandMenusSkipsAndDeletes(t *testing.T) {
+	t.Chdir("../..") // locales/
+	b, tg := newFakeTelegram(t)
+	d := NewDispatcher(b, nil, nil, i18n.NewLocalizer(), "", "testbot")
+	d.Commands = NewCommandRegistry(&Command{Name: "start", Description: "cmd_start"})
+	d.Access = access.NewPolicy(nil)
+	d.Access.GroupAdminsOnly = true
+
+	// Telegram already has the English start command everywhere
+	start, _ := json.Marshal([]models.BotCommand{{Command: "start", Description: d.Localizer.Get("en", "cmd_start")}})
+	tg.Results["getMyCommands"] = string(start)
+
+	d.SyncCommandMenus(context.Background())
+
+	menus := sentMenus(t, tg)
+	if len(menus) != 2 || menus[menuKey{"all_private_chats", "id"}] == nil || menus[menuKey{"all_chat_administrators", "id"}] == nil {
+		t.Errorf("got menus %v, want only the Indonesian ones to change", menus)
+	}
+	// Only group admins may talk to the bot, so members get no menu
+	deleted := tg.Calls("deleteMyCommands")
+	if len(deleted) != 2 {
+		t.Fatalf("got %d deletes, want 2", len(deleted))
+	}
+	for _, c := range deleted {
+		if scope := c.Body["scope"].(map[string]interface{}); scope["type"] != "all_group_chats" {
+			t.Errorf("deleted the menu of %v", scope)
+		}
+	}
+}
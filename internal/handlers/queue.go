@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"log"
+	"runtime/debug"
+	"sync"
+)
+
+// ConversationKey identifies one conversation: a chat, or a topic inside it.
+type ConversationKey struct {
+	ChatID   int64
+	ThreadID int
+}
+
+// WorkQueue runs jobs one at a time per conversation, so replies arrive in
+// order and history reads/writes don't race, while different conversations
+// run in parallel up to a global concurrency cap.
+type WorkQueue struct {
+	MaxDepth int // pending jobs allowed per conversation
+
+	mu     sync.Mutex
+	queues map[ConversationKey][]func()
+	sem    chan struct{}
+}
+
+func NewWorkQueue(maxConcurrency, maxDepth int) *WorkQueue {
+	if maxConcurrency < 1 {
+		maxConcurrency = 1
+	}
+	return &WorkQueue{
+		MaxDepth: maxDepth,
+		queues:   make(map[ConversationKey][]func()),
+		sem:      make(chan struct{}, maxConcurrency),
+	}
+}
+
+// Submit queues job behind earlier jobs of the same conversation. It returns
+// false without queueing when the conversation already has MaxDepth jobs
+// waiting.
+func (q *WorkQueue) Submit(key ConversationKey, job func()) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	pending, active := q.queues[key]
+	if active && q.MaxDepth > 0 && len(pending) >= q.MaxDepth {
+		return false
+	}
+
+	if active {
+		q.queues[key] = append(pending, job)
+		return true
+	}
+
+	// No worker for this conversation yet: start one with an empty queue
+	q.queues[key] = nil
+	go q.work(key, job)
+	return true
+}
+
+// work runs job and then drains the conversation's queue. The map entry is
+// removed when the queue is empty so idle conversations cost nothing.
+func (q *WorkQueue) work(key ConversationKey, job func()) {
+	for {
+		q.run(key, job)
+
+		q.mu.Lock()
+		pending := q.queues[key]
+		if len(pending) == 0 {
+			delete(q.queues, key)
+			q.mu.Unlock()
+			return
+		}
+		job = pending[0]
+		q.queues[key] = pending[1:]
+		q.mu.Unlock()
+	}
+}
+
+// run holds a concurrency slot while job runs. A panicking job is logged
+// and does not take the worker down, so the conversation keeps going.
+func (q *WorkQueue) run(key ConversationKey, job func()) {
+	q.sem <- struct{}{}
+	defer func() { <-q.sem }()
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[ERROR] Job for chat %d thread %d panicked: %v\n%s", key.ChatID, key.ThreadID, r, debug.Stack())
+		}
+	}()
+	job()
+}
+
+// Depth returns the number of jobs waiting (not running) for key.
+func (q *WorkQueue) Depth(key ConversationKey) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.queues[key])
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWorkQueueRunsInOrderPerKey(t *testing.T) {
+	q := NewWorkQueue(4, 0)
+	key := ConversationKey{ChatID: 1}
+
+	var mu sync.Mutex
+	var got []int
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		i := i
+		wg.Add(1)
+		if !q.Submit(key, func() {
+			defer wg.Done()
+			mu.Lock()
+			got = append(got, i)
+			mu.Unlock()
+		}) {
+			t.Fatalf("job %d rejected", i)
+		}
+	}
+	wg.Wait()
+
+	for i, v := range got {
+		if v != i {
+			t.Fatalf("jobs ran out of order: %v", got)
+		}
+	}
+}
+
+func TestWorkQueueParallelUpToCap(t *testing.T) {
+	const limit = 3
+	q := NewWorkQueue(limit, 0)
+
+	var running, peak int32
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 2*limit; i++ {
+		wg.Add(1)
+		q.Submit(ConversationKey{ChatID: int64(i)}, func() {
+			defer wg.Done()
+			n := atomic.AddInt32(&running, 1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			<-release
+			atomic.AddInt32(&running, -1)
+		})
+	}
+
+	// Wait until the cap is reached, then give the others a chance to
+	// exceed it
+	deadline := time.Now().Add(2 * time.Second)
+	for atomic.LoadInt32(&running) < limit && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if peak != limit {
+		t.Errorf("peak concurrency %d, want %d", peak, limit)
+	}
+}
+
+func TestWorkQueueRejectsWhenFull(t *testing.T) {
+	q := NewWorkQueue(1, 2)
+	key := ConversationKey{ChatID: 1}
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	q.Submit(key, func() { close(started); <-release })
+	<-started
+	for i := 0; i < 2; i++ {
+		if !q.Submit(key, func() {}) {
+			t.Fatalf("job %d rejected below MaxDepth", i)
+		}
+	}
+	if q.Submit(key, func() {}) {
+		t.Error("job accepted with a full queue")
+	}
+	if q.Depth(key) != 2 {
+		t.Errorf("depth %d, want 2", q.Depth(key))
+	}
+	// Other conversations are not affected
+	done := make(chan struct{})
+	if !q.Submit(ConversationKey{ChatID: 2}, func() { close(done) }) {
+		t.Error("other conversation rejected")
+	}
+	close(release)
+	<-done
+}
+
+func TestWorkQueueSurvivesPanic(t *testing.T) {
+	q := NewWorkQueue(1, 0)
+	key := ConversationKey{ChatID: 1}
+
+	done := make(chan struct{})
+	q.Submit(key, func() { panic("boom") })
+	q.Submit(key, func() { close(done) })
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("job after a panic never ran")
+	}
+	// The slot was released: another conversation still runs
+	done = make(chan struct{})
+	q.Submit(ConversationKey{ChatID: 2}, func() { close(done) })
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("concurrency slot leaked by the panic")
+	}
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"telechatbot/internal/api"
+	"telechatbot/internal/render"
+	"telechatbot/internal/tools"
+)
+
+// searchInstruction is added to the system prompt when the model can
+// search, so answers cite the results instead of invented URLs.
+const searchInstruction = "\n\nYou can search the web with the web_search tool and read pages with fetch_url. Use them for current events and facts you are unsure about. When you use results, cite them inline as Markdown links like [Title](URL), using only URLs returned by the tools. Do not use bare URLs or [1] style references."
+
+// maxSourcesListed bounds the footer added to answers without citations
+const maxSourcesListed = 5
+
+func (d *Dispatcher) canSearch(ai api.ChatProvider) bool {
+	_, ok := d.Tools.Get("web_search")
+	return ok && ai.Capabilities().Tools
+}
+
+// withSources makes sure an answer based on search results links them. If
+// the model already linked at least one of the sources the answer is left
+// alone; otherwise the sources are appended as a list.
+func (d *Dispatcher) withSources(answer string, sources []tools.Source, userLang string) string {
+	if len(sources) == 0 || strings.TrimSpace(answer) == "" {
+		return answer
+	}
+	for _, s := range sources {
+		if strings.Contains(answer, s.URL) {
+			return answer
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(answer)
+	b.WriteString("\n\n**" + render.EscapeMarkdown(d.Localizer.Get(userLang, "sources")) + "**")
+	for i, s := range sources {
+		if i == maxSourcesListed {
+			break
+		}
+		title := s.Title
+		if title == "" {
+			title = s.URL
+		}
+		fmt.Fprintf(&b, "\n%d. [%s](%s)", i+1, render.EscapeMarkdown(title), s.URL)
+	}
+	return b.String()
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"telechatbot/internal/i18n"
+	"telechatbot/internal/tools"
+	"testing"
+)
+
+func TestWithSources(t *testing.T) {
+	t.Chdir("../..") // locales/
+	d := &Dispatcher{Localizer: i18n.NewLocalizer()}
+	sources := []tools.Source{
+		{Title: "Go [blog]", URL: "https://go.dev/blog"},
+		{Title: "", URL: "https://example.com/a"},
+	}
+
+	got := d.withSources("The answer.", sources, "en")
+	want := "The answer.\n\n**Sources:**\n1. [Go \\[blog\\]](https://go.dev/blog)\n2. [https://example\\.com/a](https://example.com/a)"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := d.withSources("Jawaban.", sources[:1], "id"); !strings.Contains(got, "**Sumber:**") {
+		t.Errorf("got %q", got)
+	}
+
+	// Answers that already cite a source, empty answers and answers
+	// without sources are left alone
+	cited := "See [the blog](https://go.dev/blog)."
+	for _, tc := range []struct {
+		answer  string
+		sources []tools.Source
+	}{
+		{cited, sources},
+		{"  ", sources},
+		{"The answer.", nil},
+	} {
+		if got := d.withSources(tc.answer, tc.sources, "en"); got != tc.answer {
+			t.Errorf("withSources(%q) = %q", tc.answer, got)
+		}
+	}
+
+	var many []tools.Source
+	for i := 0; i < maxSourcesListed+3; i++ {
+		many = append(many, tools.Source{Title: fmt.Sprint("s", i), URL: fmt.Sprint("https://example.com/", i)})
+	}
+	if n := strings.Count(d.withSources("The answer.", many, "en"), "\n"); n != maxSourcesListed+2 {
+		t.Errorf("footer lists %d sources, want %d", n-2, maxSourcesListed)
+	}
+}
@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"telechatbot/internal/api"
+	"telechatbot/internal/bot"
+	"telechatbot/internal/models"
+	"time"
+)
+
+const (
+	// Drafts are cheap, edits count against Telegram's per-chat rate limit
+	draftInterval = 500 * time.Millisecond
+	editInterval  = 1500 * time.Millisecond
+
+	// Keep previews below the 4096 char message limit
+	maxPreviewLen = 3900
+	// Only the tail of the reasoning is shown while the model is thinking
+	maxThinkPreviewLen = 600
+)
+
+// streamReply progressively shows a streamed AI answer. In topics of
+// private chats it uses sendMessageDraft, elsewhere (and once a draft is
+// rejected) it sends a placeholder and edits it.
+type streamReply struct {
+	d         *Dispatcher
+	ctx       context.Context
+	chatID    int64
+	threadID  int
+	replyToID int
+
+	useDraft  bool
+	draftID   string
+	messageID int // placeholder message (edit mode only)
+	interval  time.Duration
+
+	blocked bool // bot cannot write to the chat, stop updating
+
+	mu        sync.Mutex
+	content   strings.Builder
+	reasoning strings.Builder
+	status    string // shown while there is no output, e.g. a running tool
+	lastFlush time.Time
+	lastText  string
+}
+
+func (d *Dispatcher) newStreamReply(ctx context.Context, chat *models.Chat, threadID, replyToID int) *streamReply {
+	s := &streamReply{
+		d:         d,
+		ctx:       ctx,
+		chatID:    chat.ID,
+		threadID:  threadID,
+		replyToID: replyToID,
+		// Drafts only exist in private chats, not in forum groups
+		useDraft: threadID != 0 && chat.Type == "private",
+		interval: editInterval,
+	}
+	if s.useDraft {
+		s.draftID = fmt.Sprintf("%d", time.Now().UnixNano())
+		s.interval = draftInterval
+	}
+	return s
+}
+
+// onDelta is passed to ChatProvider.SendChatStream.
+func (s *streamReply) onDelta(delta api.StreamDelta) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.content.WriteString(delta.Content)
+	s.reasoning.WriteString(delta.Reasoning)
+
+	if time.Since(s.lastFlush) < s.interval {
+		return
+	}
+	s.flush()
+}
+
+// setStatus drops what was streamed so far (the model answered with tool
+// calls, not the final text) and shows status until the next round writes.
+func (s *streamReply) setStatus(status string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.content.Reset()
+	s.reasoning.Reset()
+	s.status = status
+	s.flush()
+}
+
+// hasOutput reports whether any delta has arrived.
+func (s *streamReply) hasOutput() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.content.Len() > 0 || s.reasoning.Len() > 0
+}
+
+// flush pushes the current preview to Telegram. The renderer keeps
+// unfinished Markdown as literal text, so previews are always valid.
+func (s *streamReply) flush() {
+	text := s.preview()
+	if s.blocked || text == "" || text == s.lastText {
+		return
+	}
+	s.lastFlush = time.Now()
+	s.lastText = text
+
+	if s.useDraft {
+		err := s.d.Bot.SendMessageDraft(s.ctx, s.chatID, s.threadID, s.replyToID, s.draftID, text)
+		if err == nil || bot.IsBotBlocked(err) {
+			s.handleError("update draft", err)
+			return
+		}
+		// Drafts rejected here: fall back to a message that is edited
+		log.Printf("[WARN] Draft rejected in chat %d, streaming by edits instead: %v", s.chatID, err)
+		s.useDraft = false
+		s.interval = editInterval
+	}
+
+	if s.messageID == 0 {
+		id, err := s.d.Bot.SendMessage(s.ctx, s.chatID, s.threadID, s.replyToID, text, nil)
+		if err != nil {
+			s.handleError("send stream preview", err)
+			return
+		}
+		s.messageID = id
+		return
+	}
+
+	err := s.d.Bot.EditMessageText(s.ctx, s.chatID, s.messageID, "", text, nil)
+	s.handleError("update streamed message", err)
+}
+
+func (s *streamReply) handleError(action string, err error) {
+	if err == nil || bot.IsMessageNotModified(err) {
+		return
+	}
+	if bot.IsBotBlocked(err) {
+		s.blocked = true
+	}
+	log.Printf("Failed to %s: %v", action, err)
+}
+
+// preview shows the reasoning while the model is thinking and the answer
+// once it starts writing it.
+func (s *streamReply) preview() string {
+	think, body := splitStreamingThink(s.content.String())
+	reasoning := strings.TrimSpace(s.reasoning.String() + think)
+
+	if body != "" {
+		return tail(body, maxPreviewLen) + " ▌"
+	}
+	if reasoning != "" {
+		// Reasoning is shown as a quote so it is visibly not the answer
+		return "> 🧠 " + strings.ReplaceAll(tail(reasoning, maxThinkPreviewLen), "\n", "\n> ")
+	}
+	return s.status
+}
+
+// finish replaces the preview with the final formatted answer.
+func (s *streamReply) finish(finalText string, replyMarkup *models.InlineKeyboardMarkup) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.messageID != 0 {
+		var markup interface{}
+		if replyMarkup != nil {
+			markup = replyMarkup
+		}
+
+		parts := bot.SplitMarkdown(finalText, s.d.Bot.MaxMessageLength)
+		switch {
+		case s.d.Bot.SendsAsDocument(finalText):
+			// The preview becomes a pointer to the file sent as a reply
+			err := s.d.Bot.EditMessageText(s.ctx, s.chatID, s.messageID, "", "📄", nil)
+			s.handleError("finish streamed message", err)
+			s.d.Bot.SendMessage(s.ctx, s.chatID, s.threadID, s.messageID, finalText, markup)
+		case len(parts) > 1:
+			// The preview keeps the first part, the rest follows as replies
+			err := s.d.Bot.EditMessageText(s.ctx, s.chatID, s.messageID, "", parts[0], nil)
+			s.handleError("finish streamed message", err)
+			s.d.Bot.SendMessage(s.ctx, s.chatID, s.threadID, s.messageID, strings.Join(parts[1:], "\n\n"), markup)
+		default:
+			err := s.d.Bot.EditMessageText(s.ctx, s.chatID, s.messageID, "", finalText, replyMarkup)
+			s.handleError("finish streamed message", err)
+		}
+		return
+	}
+
+	s.d.sendFinal(s.ctx, s.chatID, s.threadID, s.replyToID, finalText, replyMarkup)
+}
+
+// fail replaces the preview with an error notice.
+func (s *streamReply) fail(text string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.messageID != 0 {
+		s.d.Bot.EditMessageText(s.ctx, s.chatID, s.messageID, "", text, nil)
+		return
+	}
+	s.d.Bot.SendMessage(s.ctx, s.chatID, s.threadID, s.replyToID, text, nil)
+}
+
+// splitStreamingThink is extractThinkContent for partial output where the
+// closing </think> may not have arrived yet.
+func splitStreamingThink(raw string) (string, string) {
+	start := strings.Index(raw, "<think>")
+	if start >= 0 && !strings.Contains(raw[start:], "</think>") {
+		return raw[start+len("<think>"):], strings.TrimSpace(raw[:start])
+	}
+	return extractThinkContent(raw)
+}
+
+func tail(s string, max int) string {
+	r := []rune(s)
+	if len(r) <= max {
+		return s
+	}
+	return "…" + string(r[len(r)-max:])
+}
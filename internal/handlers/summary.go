@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"strings"
+	"telechatbot/internal/database"
+	"telechatbot/internal/models"
+)
+
+const summaryPrompt = `You maintain a running summary of a chat between a user and an AI assistant.
+Merge the existing summary with the new messages into one updated summary.
+Keep decisions, facts about the user, agreed plans, open questions, names, numbers and code identifiers; drop small talk.
+Write in the language of the conversation, as short bullet points, at most about 300 words.
+Reply with the summary only.`
+
+// summaryMessage is injected ahead of the recent turns so the model knows
+// what happened before them.
+func summaryMessage(summary string) models.GroqMessage {
+	return models.GroqMessage{
+		Role:    "system",
+		Content: "Summary of the earlier conversation (those messages are not shown):\n" + summary,
+	}
+}
+
+// maybeSummarize folds older turns into the stored summary once the turns
+// not yet covered by it take more than half of the context budget. The
+// newest SummaryKeepTurns turns are always left verbatim. It runs in the
+// background after a reply; only one run per conversation at a time.
+func (d *Dispatcher) maybeSummarize(ctx context.Context, chatID int64, threadID int) {
+	key := ConversationKey{ChatID: chatID, ThreadID: threadID}
+	if _, running := d.summarizing.LoadOrStore(key, true); running {
+		return
+	}
+	defer d.summarizing.Delete(key)
+
+	summary, err := d.DB.GetSummary(chatID, threadID)
+	if err != nil {
+		log.Printf("[ERROR] Failed to load summary: %v", err)
+		return
+	}
+	turns, err := d.DB.GetHistoryAfter(chatID, threadID, summary.LastMessageID, maxHistoryRows)
+	if err != nil {
+		log.Printf("[ERROR] Failed to load history for summary: %v", err)
+		return
+	}
+	if len(turns) <= d.SummaryKeepTurns {
+		return
+	}
+
+	pending := 0
+	for _, t := range turns {
+		pending += d.Tokens.Count(t.Content)
+	}
+	if pending < d.ContextTokens/2 {
+		return
+	}
+
+	older := d.fitTranscript(turns[:len(turns)-d.SummaryKeepTurns], d.ContextTokens-d.Tokens.Count(summary.Text))
+
+	var transcript strings.Builder
+	for _, t := range older {
+		transcript.WriteString(t.Role + ": " + t.Content + "\n\n")
+	}
+
+	existing := summary.Text
+	if existing == "" {
+		existing = "(none yet)"
+	}
+	messages := []models.GroqMessage{
+		{Role: "system", Content: summaryPrompt},
+		{Role: "user", Content: "Existing summary:\n" + existing + "\n\nNew messages:\n" + transcript.String()},
+	}
+
+	aiContent, _, err := d.AI.SendChat(ctx, messages)
+	if err != nil {
+		log.Printf("[ERROR] Failed to summarize chat %d thread %d: %v", chatID, threadID, err)
+		return
+	}
+	_, text := extractThinkContent(aiContent)
+	if text = strings.TrimSpace(text); text == "" {
+		return
+	}
+
+	next := database.Summary{Text: text, LastMessageID: older[len(older)-1].ID}
+	if err := d.DB.SetSummary(chatID, threadID, next); err != nil {
+		log.Printf("[ERROR] Failed to save summary: %v", err)
+		return
+	}
+	log.Printf("[INFO] Summarized %d turns of chat %d thread %d", len(older), chatID, threadID)
+}
+
+// fitTranscript returns the oldest turns that fit in budget tokens, at least
+// one. A single oversized turn is cut down; the rest is picked up by the
+// next run.
+func (d *Dispatcher) fitTranscript(turns []database.ChatMessage, budget int) []database.ChatMessage {
+	var out []database.ChatMessage
+	for _, t := range turns {
+		cost := d.Tokens.Count(t.Content)
+		if cost > budget {
+			if len(out) == 0 {
+				keep := int(float64(budget) * d.Tokens.CharsPerToken)
+				if r := []rune(t.Content); keep > 0 && len(r) > keep {
+					t.Content = string(r[:keep]) + " …"
+				}
+				out = append(out, t)
+			}
+			break
+		}
+		budget -= cost
+		out = append(out, t)
+	}
+	return out
+}
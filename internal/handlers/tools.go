@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"strings"
+	"telechatbot/internal/api"
+	"telechatbot/internal/models"
+	"telechatbot/internal/tools"
+)
+
+// maxToolRounds caps how often the model may call tools for one reply; the
+// round after that must answer with text
+const maxToolRounds = 4
+
+// complete gets the answer for messages from ai, running the tool calls the
+// model makes in between. stream may be nil for a non-streaming request.
+func (d *Dispatcher) complete(ctx context.Context, ai api.ChatProvider, messages []models.GroqMessage, inv tools.Invocation, stream *streamReply) (api.ChatResult, error) {
+	var onDelta api.StreamHandler
+	if stream != nil {
+		onDelta = stream.onDelta
+	}
+
+	if d.Tools.Len() == 0 || !ai.Capabilities().Tools {
+		return ai.Complete(ctx, api.ChatRequest{Messages: messages}, onDelta)
+	}
+
+	defs := d.Tools.Definitions()
+	for round := 0; ; round++ {
+		req := api.ChatRequest{Messages: messages, Tools: defs, ToolChoice: "auto"}
+		if round == maxToolRounds {
+			req.ToolChoice = "none"
+		}
+
+		res, err := ai.Complete(ctx, req, onDelta)
+		if err != nil {
+			// Some models reject tools or produce malformed calls; an answer
+			// without tools beats no answer
+			if round == 0 && ctx.Err() == nil && (stream == nil || !stream.hasOutput()) {
+				log.Printf("[WARN] Request with tools failed, retrying without: %v", err)
+				return ai.Complete(ctx, api.ChatRequest{Messages: messages}, onDelta)
+			}
+			return res, err
+		}
+		if len(res.ToolCalls) == 0 || round == maxToolRounds {
+			return res, nil
+		}
+
+		names := make([]string, len(res.ToolCalls))
+		for i, call := range res.ToolCalls {
+			names[i] = "`" + call.Function.Name + "`"
+		}
+		log.Printf("[INFO] Model called %s in chat %d thread %d", strings.Join(names, ", "), inv.ChatID, inv.ThreadID)
+		if stream != nil {
+			stream.setStatus("🔧 " + strings.Join(names, ", ") + "…")
+		}
+
+		messages = append(messages, models.GroqMessage{
+			Role:      "assistant",
+			Content:   res.Content,
+			ToolCalls: res.ToolCalls,
+		})
+		for _, call := range res.ToolCalls {
+			messages = append(messages, models.GroqMessage{
+				Role:       "tool",
+				ToolCallID: call.ID,
+				Content:    d.Tools.Execute(ctx, inv, call),
+			})
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"telechatbot/internal/api"
+	"telechatbot/internal/models"
+	"telechatbot/internal/tools"
+	"testing"
+)
+
+// fakeChat answers Complete with the scripted results in order and records
+// the requests. Once the script runs out it answers "done".
+type fakeChat struct {
+	script   []api.ChatResult
+	err      error
+	requests []api.ChatRequest
+}
+
+func (f *fakeChat) SendChat(ctx context.Context, messages []models.GroqMessage) (string, string, error) {
+	res, err := f.Complete(ctx, api.ChatRequest{Messages: messages}, nil)
+	return res.Content, res.Reasoning, err
+}
+
+func (f *fakeChat) SendChatStream(ctx context.Context, messages []models.GroqMessage, onDelta api.StreamHandler) (string, string, error) {
+	res, err := f.Complete(ctx, api.ChatRequest{Messages: messages}, onDelta)
+	return res.Content, res.Reasoning, err
+}
+
+func (f *fakeChat) Complete(ctx context.Context, req api.ChatRequest, onDelta api.StreamHandler) (api.ChatResult, error) {
+	f.requests = append(f.requests, req)
+	if f.err != nil && len(req.Tools) > 0 {
+		return api.ChatResult{}, f.err
+	}
+	n := len(f.requests) - 1
+	if n < len(f.script) {
+		return f.script[n], nil
+	}
+	return api.ChatResult{Content: "done"}, nil
+}
+
+func (f *fakeChat) Capabilities() api.Capabilities { return api.Capabilities{Tools: true} }
+
+func calculatorCall(id, expr string) api.ChatResult {
+	return api.ChatResult{ToolCalls: []models.ToolCall{{
+		ID:       id,
+		Type:     "function",
+		Function: models.ToolCallFunction{Name: "calculator", Arguments: fmt.Sprintf(`{"expression":%q}`, expr)},
+	}}}
+}
+
+func TestCompleteRunsToolCalls(t *testing.T) {
+	d := &Dispatcher{Tools: tools.NewRegistry(tools.Calculator{})}
+	ai := &fakeChat{script: []api.ChatResult{
+		calculatorCall("call_1", "6*7"),
+		{Content: "The answer is 42."},
+	}}
+
+	res, err := d.complete(context.Background(), ai, []models.GroqMessage{{Role: "user", Content: "6 times 7?"}}, tools.Invocation{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Content != "The answer is 42." || len(ai.requests) != 2 {
+		t.Fatalf("got %q after %d requests", res.Content, len(ai.requests))
+	}
+
+	second := ai.requests[1].Messages
+	if len(second) != 3 {
+		t.Fatalf("second request has %d messages", len(second))
+	}
+	if second[1].Role != "assistant" || len(second[1].ToolCalls) != 1 {
+		t.Errorf("assistant turn %+v", second[1])
+	}
+	if second[2].Role != "tool" || second[2].ToolCallID != "call_1" || second[2].Content != "42" {
+		t.Errorf("tool turn %+v", second[2])
+	}
+	if ai.requests[0].ToolChoice != "auto" || len(ai.requests[0].Tools) != 1 {
+		t.Errorf("first request offered %d tools with choice %q", len(ai.requests[0].Tools), ai.requests[0].ToolChoice)
+	}
+}
+
+func TestCompleteStopsAfterMaxToolRounds(t *testing.T) {
+	d := &Dispatcher{Tools: tools.NewRegistry(tools.Calculator{})}
+	// The model would call tools forever
+	var script []api.ChatResult
+	for i := 0; i <= maxToolRounds+2; i++ {
+		script = append(script, calculatorCall(fmt.Sprint("call_", i), "1+1"))
+	}
+	script[maxToolRounds].Content = "giving up"
+	ai := &fakeChat{script: script}
+
+	res, err := d.complete(context.Background(), ai, []models.GroqMessage{{Role: "user", Content: "loop"}}, tools.Invocation{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ai.requests) != maxToolRounds+1 {
+		t.Fatalf("made %d requests, want %d", len(ai.requests), maxToolRounds+1)
+	}
+	if res.Content != "giving up" {
+		t.Errorf("got %q", res.Content)
+	}
+	for i, req := range ai.requests {
+		want := "auto"
+		if i == maxToolRounds {
+			want = "none"
+		}
+		if req.ToolChoice != want {
+			t.Errorf("request %d: tool choice %q, want %q", i, req.ToolChoice, want)
+		}
+	}
+	// Every round's calls were answered before the last request
+	if n := len(ai.requests[maxToolRounds].Messages); n != 1+2*maxToolRounds {
+		t.Errorf("last request has %d messages, want %d", n, 1+2*maxToolRounds)
+	}
+}
+
+func TestCompleteRetriesWithoutTools(t *testing.T) {
+	d := &Dispatcher{Tools: tools.NewRegistry(tools.Calculator{})}
+	ai := &fakeChat{err: errors.New("tools not supported")}
+
+	res, err := d.complete(context.Background(), ai, []models.GroqMessage{{Role: "user", Content: "hi"}}, tools.Invocation{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Content != "done" || len(ai.requests) != 2 || len(ai.requests[1].Tools) != 0 {
+		t.Errorf("got %q after %d requests", res.Content, len(ai.requests))
+	}
+
+	// Without tools registered the model is asked once, without tools
+	ai = &fakeChat{}
+	if _, err := (&Dispatcher{}).complete(context.Background(), ai, nil, tools.Invocation{}, nil); err != nil || len(ai.requests) != 1 || ai.requests[0].Tools != nil {
+		t.Errorf("got %v after %d requests", err, len(ai.requests))
+	}
+}
@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"telechatbot/internal/database"
+	"telechatbot/internal/render"
+	"time"
+)
+
+// reportTopN is how many users and chats the admin report lists
+const reportTopN = 5
+
+// handleUsage answers /usage with the user's own usage. Admins can ask for
+// the aggregated report with "/usage report [today|yesterday|YYYY-MM-DD]".
+func (d *Dispatcher) handleUsage(ctx context.Context, call CommandCall) {
+	msg, userLang := call.Msg, call.UserLang
+	threadID := messageThreadID(msg)
+	args := strings.Fields(call.Args)
+
+	if len(args) > 0 && args[0] == "report" {
+		if !d.isAdmin(msg.From.ID) {
+			d.Bot.SendMessage(ctx, msg.Chat.ID, threadID, msg.MessageID, d.Localizer.Get(userLang, "admin_only"), nil)
+			return
+		}
+		day := startOfDay(time.Now())
+		if len(args) > 1 {
+			switch args[1] {
+			case "today":
+			case "yesterday":
+				day = day.AddDate(0, 0, -1)
+			default:
+				t, err := time.ParseInLocation("2006-01-02", args[1], time.Local)
+				if err != nil {
+					d.Bot.SendMessage(ctx, msg.Chat.ID, threadID, msg.MessageID, "Usage: `/usage report [today|yesterday|YYYY-MM-DD]`", nil)
+					return
+				}
+				day = t
+			}
+		}
+		d.Bot.SendMessage(ctx, msg.Chat.ID, threadID, msg.MessageID, d.usageReport(day), nil)
+		return
+	}
+
+	now := time.Now()
+	var b strings.Builder
+	b.WriteString("📊 **" + render.EscapeMarkdown(d.Localizer.Get(userLang, "usage_title")) + "**")
+	for _, period := range []struct {
+		key   string
+		since time.Time
+	}{
+		{"usage_today", startOfDay(now)},
+		{"usage_month", startOfDay(now).AddDate(0, 0, -29)},
+	} {
+		totals, err := d.DB.UsageTotals(database.UsageFilter{Since: period.since, UserID: msg.From.ID}, database.UsageByModel)
+		if err != nil {
+			log.Printf("[ERROR] Failed to load usage of user %d: %v", msg.From.ID, err)
+			d.Bot.SendMessage(ctx, msg.Chat.ID, threadID, msg.MessageID, "Failed to load usage.", nil)
+			return
+		}
+		sum := d.sumUsage(totals)
+		line := d.Localizer.Get(userLang, "usage_none")
+		if sum.requests > 0 {
+			line = fmt.Sprintf(d.Localizer.Get(userLang, "usage_line"), sum.requests, sum.tokens(), sum.cost())
+		}
+		fmt.Fprintf(&b, "\n\n**%s**\n%s", render.EscapeMarkdown(d.Localizer.Get(userLang, period.key)), render.EscapeMarkdown(line))
+	}
+	d.Bot.SendMessage(ctx, msg.Chat.ID, threadID, msg.MessageID, b.String(), nil)
+}
+
+// RunUsageReports sends the admins the report of the previous day shortly
+// after every local midnight, until ctx is done.
+func (d *Dispatcher) RunUsageReports(ctx context.Context) {
+	for {
+		next := startOfDay(time.Now()).AddDate(0, 0, 1).Add(5 * time.Minute)
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		report := d.usageReport(startOfDay(time.Now()).AddDate(0, 0, -1))
+		for adminID := range d.Admins {
+			if _, err := d.Bot.SendMessage(ctx, adminID, 0, 0, report, nil); err != nil {
+				log.Printf("[WARN] Failed to send usage report to admin %d: %v", adminID, err)
+			}
+		}
+	}
+}
+
+// usageReport sums the ledger of one local day: totals per model and
+// purpose, and the users and chats that used the most tokens.
+func (d *Dispatcher) usageReport(day time.Time) string {
+	f := database.UsageFilter{Since: day, Until: day.AddDate(0, 0, 1)}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "📊 **Usage report %s**", day.Format("2006-01-02"))
+
+	byModel, err := d.DB.UsageTotals(f, database.UsageByModel)
+	if err != nil {
+		log.Printf("[ERROR] Failed to load usage report: %v", err)
+		return b.String() + "\n\nFailed to load usage."
+	}
+	if len(byModel) == 0 {
+		return b.String() + "\n\nNo requests."
+	}
+	all := d.sumUsage(byModel)
+	fmt.Fprintf(&b, "\n%d requests · %d in / %d out tokens · %s", all.requests, all.prompt, all.completion, all.cost())
+
+	b.WriteString("\n\n**Models**")
+	for _, t := range byModel {
+		s := d.sumUsage([]database.UsageTotal{t})
+		fmt.Fprintf(&b, "\n`%s` %d req · %d in / %d out", t.Model, t.Requests, t.PromptTokens, t.CompletionTokens)
+		if t.ReasoningTokens > 0 {
+			fmt.Fprintf(&b, " (%d reasoning)", t.ReasoningTokens)
+		}
+		fmt.Fprintf(&b, " · avg %s · %s", t.Latency.Round(10*time.Millisecond), s.cost())
+	}
+
+	for _, group := range []struct {
+		title, by string
+		limit     int
+	}{
+		{"Purposes", database.UsageByPurpose, 0},
+		{"Top users", database.UsageByUser, reportTopN},
+		{"Top chats", database.UsageByChat, reportTopN},
+	} {
+		totals, err := d.DB.UsageTotals(f, group.by)
+		if err != nil {
+			log.Printf("[ERROR] Failed to load usage by %s: %v", group.by, err)
+			continue
+		}
+		fmt.Fprintf(&b, "\n\n**%s**", group.title)
+		for i, s := range d.sumUsageBy(totals) {
+			if group.limit > 0 && i == group.limit {
+				break
+			}
+			key := s.key
+			if key == "0" {
+				key = "none"
+			}
+			fmt.Fprintf(&b, "\n`%s` %d req · %d tokens · %s", key, s.requests, s.tokens(), s.cost())
+		}
+	}
+	return b.String()
+}
+
+// usageSum adds up ledger totals and their cost. Models without a price
+// are counted in unpriced instead of cost.
+type usageSum struct {
+	key                string
+	requests           int
+	prompt, completion int
+	costUSD            float64
+	unpriced           int
+}
+
+func (s usageSum) tokens() int {
+	return s.prompt + s.completion
+}
+
+func (s usageSum) cost() string {
+	switch {
+	case s.unpriced > 0 && s.costUSD == 0:
+		return "cost unknown"
+	case s.unpriced > 0:
+		return fmt.Sprintf("$%.4f + unpriced", s.costUSD)
+	}
+	return fmt.Sprintf("$%.4f", s.costUSD)
+}
+
+func (d *Dispatcher) sumUsage(totals []database.UsageTotal) usageSum {
+	var s usageSum
+	for _, t := range totals {
+		s.requests += t.Requests
+		s.prompt += t.PromptTokens
+		s.completion += t.CompletionTokens
+		if c, ok := d.Prices.Cost(t.Model, t.PromptTokens, t.CompletionTokens); ok {
+			s.costUSD += c
+		} else if t.PromptTokens+t.CompletionTokens > 0 {
+			s.unpriced++
+		}
+	}
+	return s
+}
+
+// sumUsageBy sums the per-model totals of each key, most tokens first.
+func (d *Dispatcher) sumUsageBy(totals []database.UsageTotal) []usageSum {
+	byKey := make(map[string][]database.UsageTotal)
+	var keys []string
+	for _, t := range totals {
+		if _, ok := byKey[t.Key]; !ok {
+			keys = append(keys, t.Key)
+		}
+		byKey[t.Key] = append(byKey[t.Key], t)
+	}
+
+	sums := make([]usageSum, 0, len(keys))
+	for _, k := range keys {
+		s := d.sumUsage(byKey[k])
+		s.key = k
+		sums = append(sums, s)
+	}
+	sort.SliceStable(sums, func(i, j int) bool { return sums[i].tokens() > sums[j].tokens() })
+	return sums
+}
+
+func startOfDay(t time.Time) time.Time {
+	y, m, day := t.Date()
+	return time.Date(y, m, day, 0, 0, 0, 0, t.Location())
+}
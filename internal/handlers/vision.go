@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"telechatbot/internal/api"
+	"telechatbot/internal/models"
+)
+
+// maxImageBytes keeps the base64 data URL under the 4 MB most providers
+// accept for inline images.
+const maxImageBytes = 3 << 20
+
+// defaultImagePrompt is used for photos sent without a caption.
+const defaultImagePrompt = "Describe this image. If it shows an error or a problem, explain the cause and how to fix it."
+
+// imageAttachment returns the largest size of a photo, or a document that
+// is an image (screenshots sent uncompressed).
+func imageAttachment(msg *models.Message) (fileID string, size int64, ok bool) {
+	if len(msg.Photo) > 0 {
+		best := msg.Photo[0]
+		for _, p := range msg.Photo[1:] {
+			if p.Width*p.Height > best.Width*best.Height {
+				best = p
+			}
+		}
+		return best.FileID, best.FileSize, true
+	}
+	if msg.Document != nil && strings.HasPrefix(msg.Document.MimeType, "image/") {
+		return msg.Document.FileID, msg.Document.FileSize, true
+	}
+	return "", 0, false
+}
+
+// visionProvider is the provider used for messages with images: the
+// dedicated Vision provider, else the main one if it can see images.
+func (d *Dispatcher) visionProvider() api.ChatProvider {
+	if d.Vision != nil {
+		return d.Vision
+	}
+	if d.AI.Capabilities().Vision {
+		return d.AI
+	}
+	return nil
+}
+
+// downloadImage fetches the image of msg as a data URL.
+func (d *Dispatcher) downloadImage(ctx context.Context, msg *models.Message) (string, error) {
+	fileID, size, _ := imageAttachment(msg)
+	if size > maxImageBytes {
+		return "", errImageTooLarge
+	}
+
+	file, err := d.Bot.GetFile(ctx, fileID)
+	if err != nil {
+		return "", fmt.Errorf("getFile: %w", err)
+	}
+	if file.FileSize > maxImageBytes {
+		return "", errImageTooLarge
+	}
+	data, err := d.Bot.DownloadFile(ctx, file, maxImageBytes)
+	if err != nil {
+		return "", fmt.Errorf("download: %w", err)
+	}
+
+	// Telegram serves photos as JPEG; documents carry their own type
+	mimeType := http.DetectContentType(data)
+	if !strings.HasPrefix(mimeType, "image/") {
+		return "", fmt.Errorf("file is %s, not an image", mimeType)
+	}
+	return "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(data), nil
+}
+
+var errImageTooLarge = fmt.Errorf("image is larger than %d bytes", maxImageBytes)
+
+// imageMessage builds the multimodal user message for a photo. It replies
+// to the user itself when images can't be handled and then returns false.
+func (d *Dispatcher) imageMessage(ctx context.Context, msg *models.Message, text, userLang string) (models.GroqMessage, bool) {
+	threadID := messageThreadID(msg)
+	reply := func(key string) {
+		d.Bot.SendMessage(ctx, msg.Chat.ID, threadID, msg.MessageID, d.Localizer.Get(userLang, key), nil)
+	}
+
+	if d.visionProvider() == nil {
+		reply("image_unavailable")
+		return models.GroqMessage{}, false
+	}
+
+	dataURL, err := d.downloadImage(ctx, msg)
+	if err == errImageTooLarge {
+		reply("image_too_large")
+		return models.GroqMessage{}, false
+	}
+	if err != nil {
+		log.Printf("[ERROR] Failed to download image: %v", err)
+		reply("image_failed")
+		return models.GroqMessage{}, false
+	}
+
+	if text == "" {
+		text = defaultImagePrompt
+	}
+	return models.GroqMessage{
+		Role:    "user",
+		Content: text,
+		Parts:   []models.ContentPart{models.TextPart(text), models.ImagePart(dataURL)},
+	}, true
+}
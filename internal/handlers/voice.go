@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"telechatbot/internal/models"
+	"telechatbot/internal/render"
+)
+
+// audioAttachment returns the file of a voice note, audio file or video
+// note in msg, with a file name the transcription API can detect the
+// format from.
+func audioAttachment(msg *models.Message) (fileID, filename string, size int64, ok bool) {
+	switch {
+	case msg.Voice != nil:
+		return msg.Voice.FileID, "voice.ogg", msg.Voice.FileSize, true
+	case msg.Audio != nil:
+		name := msg.Audio.FileName
+		if name == "" {
+			name = "audio.mp3"
+		}
+		return msg.Audio.FileID, name, msg.Audio.FileSize, true
+	case msg.VideoNote != nil:
+		return msg.VideoNote.FileID, "video_note.mp4", msg.VideoNote.FileSize, true
+	}
+	return "", "", 0, false
+}
+
+// transcribeMessage downloads the audio of msg and returns its transcript.
+func (d *Dispatcher) transcribeMessage(ctx context.Context, msg *models.Message) (string, error) {
+	fileID, filename, _, _ := audioAttachment(msg)
+
+	file, err := d.Bot.GetFile(ctx, fileID)
+	if err != nil {
+		return "", fmt.Errorf("getFile: %w", err)
+	}
+	audio, err := d.Bot.DownloadFile(ctx, file, 0)
+	if err != nil {
+		return "", fmt.Errorf("download: %w", err)
+	}
+
+	transcript, err := d.Transcriber.Transcribe(ctx, filename, audio)
+	if err != nil {
+		return "", err
+	}
+	log.Printf("[INFO] Transcribed %s (%d bytes) in chat %d", filename, len(audio), msg.Chat.ID)
+	return transcript, nil
+}
+
+// voicePrompt turns a voice message into the text prompt: the transcript,
+// preceded by the caption if there is one. It replies to the user itself
+// when transcription is unavailable or fails, and then returns "".
+func (d *Dispatcher) voicePrompt(ctx context.Context, msg *models.Message, caption, userLang string) string {
+	threadID := messageThreadID(msg)
+
+	if d.Transcriber == nil {
+		d.Bot.SendMessage(ctx, msg.Chat.ID, threadID, msg.MessageID, d.Localizer.Get(userLang, "voice_unavailable"), nil)
+		return ""
+	}
+
+	d.Bot.SendChatAction(ctx, msg.Chat.ID, threadID, "typing")
+	transcript, err := d.transcribeMessage(ctx, msg)
+	if err != nil {
+		log.Printf("[ERROR] Failed to transcribe voice message: %v", err)
+		d.Bot.SendMessage(ctx, msg.Chat.ID, threadID, msg.MessageID, d.Localizer.Get(userLang, "voice_failed"), nil)
+		return ""
+	}
+	if transcript == "" {
+		d.Bot.SendMessage(ctx, msg.Chat.ID, threadID, msg.MessageID, d.Localizer.Get(userLang, "voice_empty"), nil)
+		return ""
+	}
+
+	if d.EchoTranscript {
+		echo := "🎙 " + render.EscapeMarkdown(transcript)
+		echo = "> " + strings.ReplaceAll(echo, "\n", "\n> ")
+		d.Bot.SendMessage(ctx, msg.Chat.ID, threadID, msg.MessageID, echo, nil)
+	}
+
+	if caption != "" {
+		return caption + "\n\n" + transcript
+	}
+	return transcript
+}
@@ -6,6 +6,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 )
 
 type Localizer struct {
@@ -40,6 +41,16 @@ func (l *Localizer) loadLanguage(langCode string) {
 	log.Printf("Loaded language: %s", langCode)
 }
 
+// Languages returns the codes of the loaded languages, sorted.
+func (l *Localizer) Languages() []string {
+	codes := make([]string, 0, len(l.translations))
+	for code := range l.translations {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
 func (l *Localizer) Get(langCode, key string) string {
 	if texts, ok := l.translations[langCode]; ok {
 		if val, ok := texts[key]; ok {
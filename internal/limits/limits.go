@@ -0,0 +1,161 @@
+// Package limits keeps single users and chats from exhausting the API
+// keys: requests per minute and tokens per day, per user, per chat and for
+// the whole bot. Daily token budgets are read from the token_usage ledger,
+// so a restart doesn't reset them; minute windows are kept in memory.
+package limits
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"telechatbot/internal/database"
+	"time"
+)
+
+// Limits of one scope; 0 means unlimited.
+type Limits struct {
+	RequestsPerMinute int
+	TokensPerDay      int
+}
+
+// Tier is the set of limits that applies in a chat.
+type Tier struct {
+	User Limits
+	Chat Limits
+}
+
+// Scopes a limit can apply to
+const (
+	ScopeUser   = "user"
+	ScopeChat   = "chat"
+	ScopeGlobal = "global"
+)
+
+// Denial says which limit was hit and when it frees up again.
+type Denial struct {
+	Scope string
+	// Tokens is true for a daily token budget, false for the request rate
+	Tokens  bool
+	ResetIn time.Duration
+}
+
+// Limiter decides whether a request may go to the model. It is safe for
+// concurrent use; a nil Limiter allows everything.
+type Limiter struct {
+	DB *database.DB
+
+	Default Tier
+	// Trusted applies in TrustedChats instead of Default
+	Trusted      Tier
+	TrustedChats map[int64]bool
+	Global       Limits
+	// Exempt users (admins) are never limited
+	Exempt map[int64]bool
+
+	mu      sync.Mutex
+	windows map[string][]time.Time
+	checks  int
+}
+
+func NewLimiter(db *database.DB) *Limiter {
+	return &Limiter{
+		DB:           db,
+		TrustedChats: make(map[int64]bool),
+		Exempt:       make(map[int64]bool),
+		windows:      make(map[string][]time.Time),
+	}
+}
+
+type check struct {
+	scope  string
+	key    string
+	limits Limits
+	filter database.UsageFilter
+}
+
+// Allow checks a request of userID in chatID (0 for inline messages) and
+// counts it against the minute windows if it may go ahead. Daily budgets
+// are compared with the tokens already recorded today, so the request that
+// crosses a budget is still answered.
+func (l *Limiter) Allow(userID, chatID int64) (Denial, bool) {
+	if l == nil || l.Exempt[userID] {
+		return Denial{}, true
+	}
+
+	tier := l.Default
+	if l.TrustedChats[chatID] {
+		tier = l.Trusted
+	}
+	checks := []check{{ScopeUser, fmt.Sprintf("u%d", userID), tier.User, database.UsageFilter{UserID: userID}}}
+	if chatID != 0 {
+		checks = append(checks, check{ScopeChat, fmt.Sprintf("c%d", chatID), tier.Chat, database.UsageFilter{ChatID: chatID}})
+	}
+	checks = append(checks, check{ScopeGlobal, "global", l.Global, database.UsageFilter{}})
+
+	now := time.Now()
+	today := startOfDay(now)
+	for _, c := range checks {
+		if c.limits.TokensPerDay <= 0 {
+			continue
+		}
+		c.filter.Since = today
+		used, err := l.DB.UsageTokens(c.filter)
+		if err != nil {
+			// Better to answer than to lock everyone out on a DB hiccup
+			log.Printf("[ERROR] Failed to read %s token usage: %v", c.scope, err)
+			continue
+		}
+		if used >= c.limits.TokensPerDay {
+			return Denial{Scope: c.scope, Tokens: true, ResetIn: today.AddDate(0, 0, 1).Sub(now)}, false
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Every window must have room before the request is counted in any
+	for _, c := range checks {
+		if c.limits.RequestsPerMinute <= 0 {
+			continue
+		}
+		w := prune(l.windows[c.key], now)
+		l.windows[c.key] = w
+		if len(w) >= c.limits.RequestsPerMinute {
+			return Denial{Scope: c.scope, ResetIn: w[0].Add(time.Minute).Sub(now)}, false
+		}
+	}
+	for _, c := range checks {
+		if c.limits.RequestsPerMinute > 0 {
+			l.windows[c.key] = append(l.windows[c.key], now)
+		}
+	}
+
+	l.checks++
+	if l.checks%1000 == 0 {
+		l.sweep(now)
+	}
+	return Denial{}, true
+}
+
+// prune drops requests older than a minute.
+func prune(w []time.Time, now time.Time) []time.Time {
+	i := 0
+	for i < len(w) && now.Sub(w[i]) >= time.Minute {
+		i++
+	}
+	return w[i:]
+}
+
+// sweep forgets users and chats without requests in the last minute.
+func (l *Limiter) sweep(now time.Time) {
+	for key, w := range l.windows {
+		if len(prune(w, now)) == 0 {
+			delete(l.windows, key)
+		}
+	}
+}
+
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
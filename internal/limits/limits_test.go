@@ -0,0 +1,187 @@
+package limits
+
+import (
+	"path/filepath"
+	"telechatbot/internal/database"
+	"testing"
+	"time"
+)
+
+func newTestLimiter(t *testing.T) *Limiter {
+	t.Helper()
+	db, err := database.OpenDB(filepath.Join(t.TempDir(), "bot.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Conn.Close() })
+	if _, err := db.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	return NewLimiter(db)
+}
+
+// allowN makes n requests and returns how many were allowed and the last
+// denial.
+func allowN(l *Limiter, userID, chatID int64, n int) (int, Denial) {
+	allowed := 0
+	var last Denial
+	for i := 0; i < n; i++ {
+		d, ok := l.Allow(userID, chatID)
+		if ok {
+			allowed++
+		} else {
+			last = d
+		}
+	}
+	return allowed, last
+}
+
+// age moves every recorded request back by d.
+func age(l *Limiter, d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, w := range l.windows {
+		for i := range w {
+			w[i] = w[i].Add(-d)
+		}
+	}
+}
+
+func TestUserRequestsPerMinute(t *testing.T) {
+	l := newTestLimiter(t)
+	l.Default.User.RequestsPerMinute = 3
+
+	allowed, denial := allowN(l, 1, 100, 5)
+	if allowed != 3 || denial.Scope != ScopeUser || denial.Tokens {
+		t.Fatalf("allowed %d, denial %+v", allowed, denial)
+	}
+	if denial.ResetIn <= 0 || denial.ResetIn > time.Minute {
+		t.Errorf("reset in %s", denial.ResetIn)
+	}
+
+	// Other users have their own window
+	if _, ok := l.Allow(2, 100); !ok {
+		t.Error("second user denied")
+	}
+
+	// The window slides: requests older than a minute no longer count
+	age(l, time.Minute)
+	if allowed, _ := allowN(l, 1, 100, 5); allowed != 3 {
+		t.Errorf("allowed %d after a minute, want 3", allowed)
+	}
+}
+
+func TestChatRequestsPerMinute(t *testing.T) {
+	l := newTestLimiter(t)
+	l.Default.Chat.RequestsPerMinute = 4
+	l.Trusted.Chat.RequestsPerMinute = 10
+	l.TrustedChats[200] = true
+
+	allowed := 0
+	for user := int64(1); user <= 6; user++ {
+		if _, ok := l.Allow(user, 100); ok {
+			allowed++
+		}
+	}
+	if allowed != 4 {
+		t.Errorf("allowed %d requests in the chat, want 4", allowed)
+	}
+	if d, ok := l.Allow(7, 100); ok || d.Scope != ScopeChat {
+		t.Errorf("got %+v, %v", d, ok)
+	}
+
+	// Trusted chats use their own tier, inline messages have no chat
+	if allowed, _ := allowN(l, 1, 200, 12); allowed != 10 {
+		t.Errorf("allowed %d in the trusted chat, want 10", allowed)
+	}
+	if allowed, _ := allowN(l, 1, 0, 6); allowed != 6 {
+		t.Errorf("allowed %d inline requests, want 6", allowed)
+	}
+}
+
+func TestGlobalRequestsPerMinute(t *testing.T) {
+	l := newTestLimiter(t)
+	l.Default.User.RequestsPerMinute = 2
+	l.Global.RequestsPerMinute = 3
+
+	// A request denied by the user limit does not use up the global window
+	if allowed, _ := allowN(l, 1, 100, 4); allowed != 2 {
+		t.Fatalf("allowed %d, want 2", allowed)
+	}
+	if _, ok := l.Allow(2, 101); !ok {
+		t.Fatal("third request denied")
+	}
+	if d, ok := l.Allow(3, 102); ok || d.Scope != ScopeGlobal {
+		t.Errorf("got %+v, %v", d, ok)
+	}
+}
+
+func TestDailyTokenBudget(t *testing.T) {
+	l := newTestLimiter(t)
+	l.Default.User.TokensPerDay = 1000
+	l.Default.Chat.TokensPerDay = 5000
+	l.Global.TokensPerDay = 10000
+
+	record := func(userID, chatID int64, tokens int) {
+		t.Helper()
+		if err := l.DB.AddUsage(database.UsageRecord{UserID: userID, ChatID: chatID, PromptTokens: tokens / 2, CompletionTokens: tokens - tokens/2}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The request that crosses the budget was allowed; the next is not
+	record(1, 100, 999)
+	if _, ok := l.Allow(1, 100); !ok {
+		t.Fatal("denied below the budget")
+	}
+	record(1, 100, 500)
+	d, ok := l.Allow(1, 100)
+	if ok || d.Scope != ScopeUser || !d.Tokens {
+		t.Fatalf("got %+v, %v", d, ok)
+	}
+	if d.ResetIn <= 0 || d.ResetIn > 24*time.Hour {
+		t.Errorf("reset in %s, want before midnight", d.ResetIn)
+	}
+
+	if _, ok := l.Allow(2, 100); !ok {
+		t.Error("other user denied")
+	}
+	record(2, 100, 900)
+	record(3, 100, 900)
+	record(4, 100, 900)
+	record(5, 100, 900)
+	if d, ok := l.Allow(6, 100); ok || d.Scope != ScopeChat {
+		t.Errorf("chat budget: got %+v, %v", d, ok)
+	}
+
+	record(7, 101, 900)
+	record(8, 102, 900)
+	record(9, 103, 900)
+	record(10, 104, 900)
+	record(11, 105, 900)
+	record(12, 106, 900)
+	if d, ok := l.Allow(13, 107); ok || d.Scope != ScopeGlobal {
+		t.Errorf("global budget: got %+v, %v", d, ok)
+	}
+}
+
+func TestExemptUsers(t *testing.T) {
+	l := newTestLimiter(t)
+	l.Default.User.RequestsPerMinute = 1
+	l.Global.RequestsPerMinute = 1
+	l.Global.TokensPerDay = 1
+	l.Exempt[42] = true
+	l.DB.AddUsage(database.UsageRecord{UserID: 1, PromptTokens: 10})
+
+	if allowed, _ := allowN(l, 42, 100, 10); allowed != 10 {
+		t.Errorf("admin allowed %d of 10", allowed)
+	}
+	if _, ok := l.Allow(1, 100); ok {
+		t.Error("non-exempt user allowed over the global budget")
+	}
+
+	var nilLimiter *Limiter
+	if _, ok := nilLimiter.Allow(1, 100); !ok {
+		t.Error("nil limiter denied a request")
+	}
+}
@@ -1,27 +1,168 @@
 package models
 
+import "encoding/json"
+
 // Request structure for Groq/OpenAI compatible APIs
 type GroqChatRequest struct {
-	Model    string        `json:"model"`
-	Messages []GroqMessage `json:"messages"`
-}
+	Model      string        `json:"model"`
+	Messages   []GroqMessage `json:"messages"`
+	Stream     bool          `json:"stream,omitempty"`
+	Tools      []Tool        `json:"tools,omitempty"`
+	ToolChoice string        `json:"tool_choice,omitempty"` // "auto", "none" or "required"
 
+	// StreamOptions asks for a final usage chunk when streaming
+	StreamOptions *StreamOptions `json:"stream_options,omitempty"`
+}
 
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
 
 type GroqMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role      string `json:"role"`
+	Content   string `json:"content"`
 	Reasoning string `json:"reasoning,omitempty"`
+
+	// ToolCalls is set on assistant messages that call tools, ToolCallID
+	// on the "tool" role message carrying a call's result
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+
+	// Parts replaces Content in requests when set, for multimodal input
+	// (text plus images). Only vision-capable models accept it.
+	Parts []ContentPart `json:"-"`
+}
+
+// ContentPart is one element of a multimodal "content" array
+type ContentPart struct {
+	Type     string    `json:"type"` // "text" or "image_url"
+	Text     string    `json:"text,omitempty"`
+	ImageURL *ImageURL `json:"image_url,omitempty"`
+}
+
+// ImageURL is either an http(s) URL or a "data:image/...;base64," URL
+type ImageURL struct {
+	URL    string `json:"url"`
+	Detail string `json:"detail,omitempty"`
+}
+
+func TextPart(text string) ContentPart {
+	return ContentPart{Type: "text", Text: text}
+}
+
+func ImagePart(url string) ContentPart {
+	return ContentPart{Type: "image_url", ImageURL: &ImageURL{URL: url}}
+}
+
+// MarshalJSON sends Parts as the content array when present, so plain
+// text messages keep the simple string form every server understands.
+func (m GroqMessage) MarshalJSON() ([]byte, error) {
+	type plain GroqMessage
+	if len(m.Parts) == 0 {
+		return json.Marshal(plain(m))
+	}
+	return json.Marshal(struct {
+		Role      string        `json:"role"`
+		Content   []ContentPart `json:"content"`
+		Reasoning string        `json:"reasoning,omitempty"`
+	}{m.Role, m.Parts, m.Reasoning})
 }
 
 // Response structure
 type GroqChatResponse struct {
 	ID      string       `json:"id"`
+	Model   string       `json:"model"`
 	Choices []GroqChoice `json:"choices"`
+	Usage   *GroqUsage   `json:"usage,omitempty"`
+}
+
+// GroqUsage is the token count of one completion
+type GroqUsage struct {
+	PromptTokens            int `json:"prompt_tokens"`
+	CompletionTokens        int `json:"completion_tokens"`
+	TotalTokens             int `json:"total_tokens"`
+	CompletionTokensDetails *struct {
+		ReasoningTokens int `json:"reasoning_tokens"`
+	} `json:"completion_tokens_details,omitempty"`
+}
+
+// ReasoningTokens is the part of CompletionTokens spent thinking, 0 if
+// the server doesn't say.
+func (u *GroqUsage) ReasoningTokens() int {
+	if u == nil || u.CompletionTokensDetails == nil {
+		return 0
+	}
+	return u.CompletionTokensDetails.ReasoningTokens
 }
 
 type GroqChoice struct {
 	Index        int         `json:"index"`
 	Message      GroqMessage `json:"message"`
 	FinishReason string      `json:"finish_reason"`
-}
\ No newline at end of file
+}
+
+// Streaming chunk structure ("stream": true, sent as SSE "data:" lines)
+type GroqStreamChunk struct {
+	ID      string             `json:"id"`
+	Model   string             `json:"model"`
+	Choices []GroqStreamChoice `json:"choices"`
+	Error   *GroqStreamError   `json:"error,omitempty"`
+
+	// Usage comes in the last chunk when include_usage is set; Groq puts
+	// it in x_groq instead
+	Usage *GroqUsage `json:"usage,omitempty"`
+	XGroq *struct {
+		Usage *GroqUsage `json:"usage,omitempty"`
+	} `json:"x_groq,omitempty"`
+}
+
+type GroqStreamChoice struct {
+	Index        int             `json:"index"`
+	Delta        GroqStreamDelta `json:"delta"`
+	FinishReason *string         `json:"finish_reason"`
+}
+
+type GroqStreamDelta struct {
+	Role      string          `json:"role,omitempty"`
+	Content   string          `json:"content"`
+	Reasoning string          `json:"reasoning,omitempty"`
+	ToolCalls []ToolCallDelta `json:"tool_calls,omitempty"`
+}
+
+// ToolCallDelta is a fragment of a tool call in a stream. Fragments with
+// the same Index belong to one call; Arguments arrive in pieces.
+type ToolCallDelta struct {
+	Index    int              `json:"index"`
+	ID       string           `json:"id,omitempty"`
+	Type     string           `json:"type,omitempty"`
+	Function ToolCallFunction `json:"function"`
+}
+
+type GroqStreamError struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+}
+
+// Tool is a function the model may call ("tools" in the request)
+type Tool struct {
+	Type     string       `json:"type"` // always "function"
+	Function ToolFunction `json:"function"`
+}
+
+type ToolFunction struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Parameters  json.RawMessage `json:"parameters"` // JSON schema of the arguments
+}
+
+// ToolCall is a call the model wants to make
+type ToolCall struct {
+	ID       string           `json:"id"`
+	Type     string           `json:"type"`
+	Function ToolCallFunction `json:"function"`
+}
+
+type ToolCallFunction struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments"` // JSON encoded
+}
@@ -1,16 +1,72 @@
 package models
 
-type TelegramResponse struct {
-	Ok     bool            `json:"ok"`
-	Result []Update        `json:"result"`
+import "encoding/json"
+
+// APIResponse is the envelope of every Bot API response
+type APIResponse struct {
+	Ok          bool                `json:"ok"`
+	Result      json.RawMessage     `json:"result"`
+	ErrorCode   int                 `json:"error_code"`
+	Description string              `json:"description"`
+	Parameters  *ResponseParameters `json:"parameters"`
+}
+
+type ResponseParameters struct {
+	MigrateToChatID int64 `json:"migrate_to_chat_id"`
+	RetryAfter      int   `json:"retry_after"`
+}
+
+type GetFileRequest struct {
+	FileID string `json:"file_id"`
+}
+
+// File is the result of getFile. FilePath is valid for at least an hour.
+type File struct {
+	FileID       string `json:"file_id"`
+	FileUniqueID string `json:"file_unique_id"`
+	FileSize     int64  `json:"file_size,omitempty"`
+	FilePath     string `json:"file_path,omitempty"`
+}
+
+type GetUpdatesRequest struct {
+	Offset         int      `json:"offset"`
+	Timeout        int      `json:"timeout"`
+	AllowedUpdates []string `json:"allowed_updates,omitempty"`
 }
 
 type Update struct {
-	UpdateID      int            `json:"update_id"`
-	Message       *Message       `json:"message"`
-	CallbackQuery *CallbackQuery `json:"callback_query"`
-	InlineQuery        *InlineQuery        `json:"inline_query"`          // Tambahan
+	UpdateID           int                 `json:"update_id"`
+	Message            *Message            `json:"message"`
+	CallbackQuery      *CallbackQuery      `json:"callback_query"`
+	InlineQuery        *InlineQuery        `json:"inline_query"` // Tambahan
 	ChosenInlineResult *ChosenInlineResult `json:"chosen_inline_result"`
+	MyChatMember       *ChatMemberUpdated  `json:"my_chat_member"` // status bot di chat berubah (ditambahkan, dikeluarkan)
+}
+
+// ChatMemberUpdated reports a change of a member's status in a chat
+type ChatMemberUpdated struct {
+	Chat          *Chat      `json:"chat"`
+	From          *User      `json:"from"` // who made the change
+	Date          int64      `json:"date"`
+	OldChatMember ChatMember `json:"old_chat_member"`
+	NewChatMember ChatMember `json:"new_chat_member"`
+}
+
+// ChatMember is a user's membership in a chat. Status is "creator",
+// "administrator", "member", "restricted", "left" or "kicked".
+type ChatMember struct {
+	Status string `json:"status"`
+	User   *User  `json:"user"`
+}
+
+// IsAdmin reports whether the member can manage the chat.
+func (m ChatMember) IsAdmin() bool {
+	return m.Status == "creator" || m.Status == "administrator"
+}
+
+// IsPresent reports whether the member is in the chat.
+func (m ChatMember) IsPresent() bool {
+	return m.Status != "left" && m.Status != "kicked"
 }
 
 type InlineQuery struct {
@@ -34,11 +90,11 @@ type AnswerInlineQueryRequest struct {
 }
 
 type InlineQueryResult struct {
-	Type                string               `json:"type"` // "article"
-	ID                  string               `json:"id"`
-	Title               string               `json:"title"`
-	Description         string               `json:"description,omitempty"`
-	InputMessageContent InputMessageContent  `json:"input_message_content"`
+	Type                string                `json:"type"` // "article"
+	ID                  string                `json:"id"`
+	Title               string                `json:"title"`
+	Description         string                `json:"description,omitempty"`
+	InputMessageContent InputMessageContent   `json:"input_message_content"`
 	ReplyMarkup         *InlineKeyboardMarkup `json:"reply_markup,omitempty"` // Opsional
 }
 
@@ -48,14 +104,30 @@ type InputMessageContent struct {
 }
 
 type Message struct {
-	MessageID       int             `json:"message_id"`
-	MessageThreadID int             `json:"message_thread_id"`
-	InlineMessageID string               `json:"inline_message_id,omitempty"` // Tambahan untuk mode inline
-	From            *User           `json:"from"`
-	Chat            *Chat           `json:"chat"`
-	Text            string          `json:"text"`
-	IsTopicMessage  bool            `json:"is_topic_message"`
-	ReplyToMessage  *Message        `json:"reply_to_message"` // Added for reply detection
+	MessageID       int      `json:"message_id"`
+	MessageThreadID int      `json:"message_thread_id"`
+	InlineMessageID string   `json:"inline_message_id,omitempty"` // Tambahan untuk mode inline
+	From            *User    `json:"from"`
+	Chat            *Chat    `json:"chat"`
+	Text            string   `json:"text"`
+	IsTopicMessage  bool     `json:"is_topic_message"`
+	ReplyToMessage  *Message `json:"reply_to_message"` // Added for reply detection
+
+	// Entities mark commands, mentions, links, ... in Text (or Caption)
+	Entities        []MessageEntity `json:"entities,omitempty"`
+	CaptionEntities []MessageEntity `json:"caption_entities,omitempty"`
+
+	// Media messages carry their text in Caption instead of Text
+	Caption   string      `json:"caption,omitempty"`
+	Voice     *Voice      `json:"voice,omitempty"`
+	Audio     *Audio      `json:"audio,omitempty"`
+	VideoNote *VideoNote  `json:"video_note,omitempty"`
+	Photo     []PhotoSize `json:"photo,omitempty"` // all sizes, smallest first
+	Document  *Document   `json:"document,omitempty"`
+
+	// Service message sent when a group is upgraded to a supergroup
+	MigrateToChatID   int64 `json:"migrate_to_chat_id,omitempty"`
+	MigrateFromChatID int64 `json:"migrate_from_chat_id,omitempty"`
 }
 
 type CallbackQuery struct {
@@ -65,6 +137,14 @@ type CallbackQuery struct {
 	Data    string   `json:"data"`
 }
 
+// MessageEntity is a special part of a message text. Offset and Length
+// are in UTF-16 code units.
+type MessageEntity struct {
+	Type   string `json:"type"` // "bot_command", "mention", "url", ...
+	Offset int    `json:"offset"`
+	Length int    `json:"length"`
+}
+
 type User struct {
 	ID           int64  `json:"id"`
 	FirstName    string `json:"first_name"`
@@ -74,26 +154,27 @@ type User struct {
 
 type Chat struct {
 	ID               int64  `json:"id"`
-	Type             string `json:"type"` 
+	Type             string `json:"type"`
+	Title            string `json:"title,omitempty"`
 	HasTopicsEnabled bool   `json:"has_topics_enabled"`
 }
 
 type SendMessageRequest struct {
-	ChatID          int64       `json:"chat_id"`
-	MessageThreadID int         `json:"message_thread_id,omitempty"`
-	Text            string      `json:"text"`
-	ParseMode       string      `json:"parse_mode,omitempty"`
+	ChatID           int64       `json:"chat_id"`
+	MessageThreadID  int         `json:"message_thread_id,omitempty"`
+	Text             string      `json:"text"`
+	ParseMode        string      `json:"parse_mode,omitempty"`
 	ReplyToMessageID int         `json:"reply_to_message_id,omitempty"` // Added this
-	ReplyMarkup     interface{} `json:"reply_markup,omitempty"`
+	ReplyMarkup      interface{} `json:"reply_markup,omitempty"`
 }
 
 type EditMessageTextRequest struct {
-	ChatID          int64       `json:"chat_id,omitempty"`           // <--- WAJIB ADA omitempty
-	MessageID       int         `json:"message_id,omitempty"`        // <--- WAJIB ADA omitempty
-	InlineMessageID string      `json:"inline_message_id,omitempty"`
-	Text        string      `json:"text"`
-	ParseMode   string      `json:"parse_mode,omitempty"`
-	ReplyMarkup     InlineKeyboardMarkup `json:"reply_markup,omitempty"` // Pastikan type ini sesuai struct Anda
+	ChatID          int64                 `json:"chat_id,omitempty"`    // <--- WAJIB ADA omitempty
+	MessageID       int                   `json:"message_id,omitempty"` // <--- WAJIB ADA omitempty
+	InlineMessageID string                `json:"inline_message_id,omitempty"`
+	Text            string                `json:"text"`
+	ParseMode       string                `json:"parse_mode,omitempty"`
+	ReplyMarkup     *InlineKeyboardMarkup `json:"reply_markup,omitempty"` // nil = keyboard dihapus
 }
 
 type SendChatActionRequest struct {
@@ -103,14 +184,59 @@ type SendChatActionRequest struct {
 }
 
 type SendMessageDraftRequest struct {
-	ChatID          int64  `json:"chat_id"`
-	MessageThreadID int    `json:"message_thread_id,omitempty"`
-	DraftID         string `json:"draft_id"`
-	Text            string `json:"text"`
-	ParseMode       string `json:"parse_mode,omitempty"`
+	ChatID           int64  `json:"chat_id"`
+	MessageThreadID  int    `json:"message_thread_id,omitempty"`
+	DraftID          string `json:"draft_id"`
+	Text             string `json:"text"`
+	ParseMode        string `json:"parse_mode,omitempty"`
 	ReplyToMessageID int    `json:"reply_to_message_id,omitempty"` // Added this
 }
 
+type AnswerCallbackQueryRequest struct {
+	CallbackQueryID string `json:"callback_query_id"`
+}
+
+type DeleteWebhookRequest struct {
+	DropPendingUpdates bool `json:"drop_pending_updates"`
+}
+
+type SetWebhookRequest struct {
+	URL            string   `json:"url"`
+	SecretToken    string   `json:"secret_token,omitempty"`
+	AllowedUpdates []string `json:"allowed_updates,omitempty"`
+}
+
+type GetChatMemberRequest struct {
+	ChatID int64 `json:"chat_id"`
+	UserID int64 `json:"user_id"`
+}
+
+type LeaveChatRequest struct {
+	ChatID int64 `json:"chat_id"`
+}
+
+// BotCommand is one entry of the command menu.
+type BotCommand struct {
+	Command     string `json:"command"`
+	Description string `json:"description"`
+}
+
+// BotCommandScope selects who sees a command menu: "default",
+// "all_private_chats", "all_group_chats", "all_chat_administrators", or
+// "chat" with ChatID.
+type BotCommandScope struct {
+	Type   string `json:"type"`
+	ChatID int64  `json:"chat_id,omitempty"`
+}
+
+// MyCommandsRequest is the body of setMyCommands (with Commands),
+// getMyCommands and deleteMyCommands.
+type MyCommandsRequest struct {
+	Commands     []BotCommand     `json:"commands,omitempty"`
+	Scope        *BotCommandScope `json:"scope,omitempty"`
+	LanguageCode string           `json:"language_code,omitempty"`
+}
+
 type EditForumTopicRequest struct {
 	ChatID          int64  `json:"chat_id"`
 	MessageThreadID int    `json:"message_thread_id"`
@@ -124,4 +250,50 @@ type InlineKeyboardMarkup struct {
 type InlineKeyboardButton struct {
 	Text         string `json:"text"`
 	CallbackData string `json:"callback_data"`
-}
\ No newline at end of file
+}
+
+// Voice is a voice note recorded in Telegram (OGG/Opus)
+type Voice struct {
+	FileID       string `json:"file_id"`
+	FileUniqueID string `json:"file_unique_id"`
+	Duration     int    `json:"duration"`
+	MimeType     string `json:"mime_type,omitempty"`
+	FileSize     int64  `json:"file_size,omitempty"`
+}
+
+// Audio is a music/audio file sent as such
+type Audio struct {
+	FileID       string `json:"file_id"`
+	FileUniqueID string `json:"file_unique_id"`
+	Duration     int    `json:"duration"`
+	FileName     string `json:"file_name,omitempty"`
+	MimeType     string `json:"mime_type,omitempty"`
+	FileSize     int64  `json:"file_size,omitempty"`
+}
+
+// VideoNote is a round video message (MP4)
+type VideoNote struct {
+	FileID       string `json:"file_id"`
+	FileUniqueID string `json:"file_unique_id"`
+	Length       int    `json:"length"`
+	Duration     int    `json:"duration"`
+	FileSize     int64  `json:"file_size,omitempty"`
+}
+
+// PhotoSize is one resolution of a photo
+type PhotoSize struct {
+	FileID       string `json:"file_id"`
+	FileUniqueID string `json:"file_unique_id"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+	FileSize     int64  `json:"file_size,omitempty"`
+}
+
+// Document is a file sent as a file (including uncompressed images)
+type Document struct {
+	FileID       string `json:"file_id"`
+	FileUniqueID string `json:"file_unique_id"`
+	FileName     string `json:"file_name,omitempty"`
+	MimeType     string `json:"mime_type,omitempty"`
+	FileSize     int64  `json:"file_size,omitempty"`
+}
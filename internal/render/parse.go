@@ -0,0 +1,501 @@
+// Package render converts the CommonMark-ish Markdown produced by LLMs into
+// text that Telegram accepts: HTML or MarkdownV2 with every special
+// character escaped, or plain text as a last resort.
+//
+// The parser is deliberately forgiving. Anything it does not understand,
+// including unclosed markers in half-streamed answers, is kept as literal
+// text, so the output can always be parsed by Telegram.
+package render
+
+import (
+	"regexp"
+	"strings"
+)
+
+type blockKind int
+
+const (
+	blockParagraph blockKind = iota
+	blockHeading
+	blockCode
+	blockQuote
+	blockListItem
+	blockTable
+	blockRule
+)
+
+type block struct {
+	kind     blockKind
+	text     string     // paragraph, heading and list item text
+	lang     string     // code block language tag
+	level    int        // list nesting level
+	marker   string     // list marker: "-" or "1."
+	rows     [][]string // table cells
+	children []block    // blockquote content
+}
+
+var (
+	reHeading  = regexp.MustCompile(`^\s{0,3}(#{1,6})\s+(.*?)\s*#*\s*$`)
+	reRule     = regexp.MustCompile(`^\s{0,3}((\*\s*){3,}|(-\s*){3,}|(_\s*){3,})$`)
+	reListItem = regexp.MustCompile(`^(\s*)([-*+]|\d{1,9}[.)])\s+(.*)$`)
+	reQuote    = regexp.MustCompile(`^\s{0,3}>\s?(.*)$`)
+	reFence    = regexp.MustCompile("^(\\s*)(```+|~~~+)\\s*([^`\\s]*)")
+	reTableSep = regexp.MustCompile(`^\s*\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?\s*$`)
+)
+
+func parseBlocks(md string) []block {
+	md = strings.ReplaceAll(md, "\r\n", "\n")
+	lines := strings.Split(md, "\n")
+
+	var blocks []block
+	for i := 0; i < len(lines); {
+		line := lines[i]
+
+		if strings.TrimSpace(line) == "" {
+			i++
+			continue
+		}
+
+		if m := reFence.FindStringSubmatch(line); m != nil {
+			indent, fence, lang := len(m[1]), m[2], m[3]
+			var code []string
+			i++
+			for ; i < len(lines); i++ {
+				trimmed := strings.TrimSpace(lines[i])
+				if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+					i++
+					break
+				}
+				code = append(code, trimIndent(lines[i], indent))
+			}
+			blocks = append(blocks, block{kind: blockCode, lang: lang, text: strings.Join(code, "\n")})
+			continue
+		}
+
+		if m := reHeading.FindStringSubmatch(line); m != nil {
+			blocks = append(blocks, block{kind: blockHeading, level: len(m[1]), text: m[2]})
+			i++
+			continue
+		}
+
+		if reRule.MatchString(line) {
+			blocks = append(blocks, block{kind: blockRule})
+			i++
+			continue
+		}
+
+		if isTableStart(lines, i) {
+			var rows [][]string
+			rows = append(rows, splitTableRow(lines[i]))
+			i += 2 // header and separator
+			for ; i < len(lines) && strings.Contains(lines[i], "|") && strings.TrimSpace(lines[i]) != ""; i++ {
+				rows = append(rows, splitTableRow(lines[i]))
+			}
+			blocks = append(blocks, block{kind: blockTable, rows: rows})
+			continue
+		}
+
+		if reQuote.MatchString(line) {
+			var quoted []string
+			for ; i < len(lines); i++ {
+				m := reQuote.FindStringSubmatch(lines[i])
+				if m == nil {
+					break
+				}
+				quoted = append(quoted, m[1])
+			}
+			blocks = append(blocks, block{kind: blockQuote, children: parseBlocks(strings.Join(quoted, "\n"))})
+			continue
+		}
+
+		if m := reListItem.FindStringSubmatch(line); m != nil {
+			indent := len(strings.ReplaceAll(m[1], "\t", "    "))
+			text := m[3]
+			i++
+			// Continuation lines are indented deeper than the marker
+			for ; i < len(lines); i++ {
+				next := lines[i]
+				if strings.TrimSpace(next) == "" || startsBlock(lines, i) {
+					break
+				}
+				if leadingSpaces(next) <= indent {
+					break
+				}
+				text += "\n" + strings.TrimSpace(next)
+			}
+			blocks = append(blocks, block{kind: blockListItem, level: indent / 2, marker: m[2], text: text})
+			continue
+		}
+
+		var para []string
+		for ; i < len(lines); i++ {
+			if strings.TrimSpace(lines[i]) == "" || (len(para) > 0 && startsBlock(lines, i)) {
+				break
+			}
+			para = append(para, strings.TrimSpace(lines[i]))
+		}
+		blocks = append(blocks, block{kind: blockParagraph, text: strings.Join(para, "\n")})
+	}
+
+	return blocks
+}
+
+// startsBlock reports whether lines[i] begins a new non-paragraph block.
+func startsBlock(lines []string, i int) bool {
+	line := lines[i]
+	return reFence.MatchString(line) || reHeading.MatchString(line) || reRule.MatchString(line) ||
+		reQuote.MatchString(line) || reListItem.MatchString(line) || isTableStart(lines, i)
+}
+
+func isTableStart(lines []string, i int) bool {
+	return i+1 < len(lines) && strings.Contains(lines[i], "|") &&
+		strings.Contains(lines[i+1], "-") && reTableSep.MatchString(lines[i+1])
+}
+
+func splitTableRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	line = strings.TrimSuffix(line, "|")
+	cells := strings.Split(line, "|")
+	for i := range cells {
+		cells[i] = strings.TrimSpace(cells[i])
+	}
+	return cells
+}
+
+func leadingSpaces(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " \t"))
+}
+
+func trimIndent(line string, indent int) string {
+	n := leadingSpaces(line)
+	if n > indent {
+		n = indent
+	}
+	return line[n:]
+}
+
+type inlineKind int
+
+const (
+	inlineText inlineKind = iota
+	inlineCode
+	inlineBold
+	inlineItalic
+	inlineStrike
+	inlineLink
+)
+
+type inline struct {
+	kind     inlineKind
+	text     string // text and code content
+	url      string // link target
+	children []inline
+
+	// from and to delimit the content in the parsed string (children are
+	// relative to from); open and close are the markers around it
+	from, to    int
+	open, close string
+}
+
+// parseInline splits text into formatting spans. Markers without a valid
+// closing partner stay literal text.
+func parseInline(s string) []inline {
+	var out []inline
+	var buf strings.Builder
+
+	flush := func() {
+		if buf.Len() > 0 {
+			out = append(out, inline{kind: inlineText, text: buf.String()})
+			buf.Reset()
+		}
+	}
+	span := func(kind inlineKind, from, to int, delim string) {
+		flush()
+		out = append(out, inline{kind: kind, children: parseInline(s[from:to]), from: from, to: to, open: delim, close: delim})
+	}
+
+	for i := 0; i < len(s); {
+		c := s[i]
+
+		switch {
+		case c == '\\' && i+1 < len(s) && isASCIIPunct(s[i+1]):
+			buf.WriteByte(s[i+1])
+			i += 2
+			continue
+
+		case c == '`':
+			n := runLength(s, i, '`')
+			if j := findCodeClose(s, i+n, n); j >= 0 {
+				flush()
+				code := s[i+n : j]
+				if len(code) > 2 && code[0] == ' ' && code[len(code)-1] == ' ' {
+					code = code[1 : len(code)-1]
+				}
+				out = append(out, inline{kind: inlineCode, text: code, from: i + n, to: j, open: s[i : i+n], close: s[i : i+n]})
+				i = j + n
+				continue
+			}
+			buf.WriteString(s[i : i+n])
+			i += n
+			continue
+
+		case strings.HasPrefix(s[i:], "**") || strings.HasPrefix(s[i:], "__"):
+			delim := s[i : i+2]
+			if canOpen(s, i, delim) {
+				if j := findClose(s, i+2, delim); j >= 0 {
+					span(inlineBold, i+2, j, delim)
+					i = j + 2
+					continue
+				}
+			}
+
+		case strings.HasPrefix(s[i:], "~~"):
+			if canOpen(s, i, "~~") {
+				if j := findClose(s, i+2, "~~"); j >= 0 {
+					span(inlineStrike, i+2, j, "~~")
+					i = j + 2
+					continue
+				}
+			}
+
+		case c == '*' || c == '_':
+			delim := s[i : i+1]
+			if canOpen(s, i, delim) {
+				if j := findClose(s, i+1, delim); j >= 0 {
+					span(inlineItalic, i+1, j, delim)
+					i = j + 1
+					continue
+				}
+			}
+
+		case c == '[':
+			if text, url, end, ok := parseLink(s, i); ok {
+				flush()
+				out = append(out, inline{kind: inlineLink, url: url, children: parseInline(text),
+					from: i + 1, to: i + 1 + len(text), open: "[", close: "](" + url + ")"})
+				i = end
+				continue
+			}
+
+		case c == '<':
+			if end := strings.IndexByte(s[i:], '>'); end > 0 {
+				target := s[i+1 : i+end]
+				if (strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://")) && !strings.ContainsAny(target, " <") {
+					flush()
+					out = append(out, inline{kind: inlineLink, url: target, children: []inline{{kind: inlineText, text: target}}})
+					i += end + 1
+					continue
+				}
+			}
+		}
+
+		// Repeated markers that did not open a span are literal as a whole
+		if c == '*' || c == '_' || c == '~' {
+			n := runLength(s, i, c)
+			buf.WriteString(s[i : i+n])
+			i += n
+			continue
+		}
+
+		buf.WriteByte(c)
+		i++
+	}
+
+	flush()
+	return out
+}
+
+// canOpen checks that the delimiter at i is followed by non-space and, for
+// underscores, not inside a word (so snake_case stays intact).
+func canOpen(s string, i int, delim string) bool {
+	next := i + len(delim)
+	if next >= len(s) || isSpace(s[next]) {
+		return false
+	}
+	if delim[0] == '_' && i > 0 && isWordChar(s[i-1]) {
+		return false
+	}
+	return true
+}
+
+// findClose finds the matching closing delimiter starting at from, skipping
+// code spans and, for single markers, double markers of the same char.
+func findClose(s string, from int, delim string) int {
+	for j := from; j < len(s); j++ {
+		if s[j] == '\\' {
+			j++
+			continue
+		}
+		if s[j] == '`' {
+			n := runLength(s, j, '`')
+			if k := findCodeClose(s, j+n, n); k >= 0 {
+				j = k + n - 1
+				continue
+			}
+			j += n - 1
+			continue
+		}
+		if !strings.HasPrefix(s[j:], delim) || j == from {
+			continue
+		}
+		if len(delim) == 1 && j+1 < len(s) && s[j+1] == delim[0] {
+			// part of a double marker, e.g. **bold** inside *italic*
+			if k := findClose(s, j+2, delim+delim); k >= 0 {
+				j = k + 1
+			} else {
+				j++
+			}
+			continue
+		}
+		if isSpace(s[j-1]) {
+			continue
+		}
+		// In "**bold *italic***" the double marker is the last two, so
+		// the inner span closes first
+		if n := runLength(s, j, delim[0]); len(delim) == 2 && n > 2 && unclosedSingle(s[from:j], delim[0]) {
+			j += n - 2
+		}
+		end := j + len(delim)
+		if delim[0] == '_' && end < len(s) && isWordChar(s[end]) {
+			continue
+		}
+		return j
+	}
+	return -1
+}
+
+// unclosedSingle reports whether s opens a single c marker that s doesn't
+// close.
+func unclosedSingle(s string, c byte) bool {
+	for k := 0; k < len(s); k++ {
+		if s[k] == '\\' {
+			k++
+			continue
+		}
+		if s[k] != c {
+			continue
+		}
+		if n := runLength(s, k, c); n > 1 {
+			k += n - 1
+			continue
+		}
+		if canOpen(s, k, s[k:k+1]) && findClose(s, k+1, s[k:k+1]) < 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func findCodeClose(s string, from, n int) int {
+	for j := from; j < len(s); {
+		if s[j] != '`' {
+			j++
+			continue
+		}
+		m := runLength(s, j, '`')
+		if m == n {
+			return j
+		}
+		j += m
+	}
+	return -1
+}
+
+// parseLink parses [text](url) starting at i.
+func parseLink(s string, i int) (text, url string, end int, ok bool) {
+	depth := 0
+	closeText := -1
+	for j := i; j < len(s); j++ {
+		if s[j] == '\\' {
+			j++
+			continue
+		}
+		if s[j] == '[' {
+			depth++
+		} else if s[j] == ']' {
+			depth--
+			if depth == 0 {
+				closeText = j
+				break
+			}
+		}
+	}
+	if closeText < 0 || closeText+1 >= len(s) || s[closeText+1] != '(' {
+		return "", "", 0, false
+	}
+
+	depth = 0
+	for j := closeText + 1; j < len(s); j++ {
+		if s[j] == '(' {
+			depth++
+		} else if s[j] == ')' {
+			depth--
+			if depth == 0 {
+				target := strings.TrimSpace(s[closeText+2 : j])
+				// Drop an optional "title"
+				if k := strings.IndexAny(target, " \t"); k >= 0 {
+					target = target[:k]
+				}
+				target = strings.Trim(target, "<>")
+				if target == "" || strings.ContainsAny(target, "\n") {
+					return "", "", 0, false
+				}
+				return s[i+1 : closeText], target, j + 1, true
+			}
+		}
+	}
+	return "", "", 0, false
+}
+
+func runLength(s string, i int, c byte) int {
+	n := 0
+	for i+n < len(s) && s[i+n] == c {
+		n++
+	}
+	return n
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n'
+}
+
+func isWordChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+}
+
+func isASCIIPunct(c byte) bool {
+	return strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) >= 0
+}
+
+// SpansAt returns the markers of the inline spans in s whose content
+// encloses byte offset at, outermost first: what must be closed before at
+// and opened again after it to cut s there without breaking formatting.
+func SpansAt(s string, at int) (open, close []string) {
+	var walk func(nodes []inline, base int)
+	walk = func(nodes []inline, base int) {
+		for _, n := range nodes {
+			if n.open == "" || at <= base+n.from || at >= base+n.to {
+				continue
+			}
+			open = append(open, n.open)
+			close = append(close, n.close)
+			walk(n.children, base+n.from)
+		}
+	}
+	walk(parseInline(s), 0)
+	return open, close
+}
+
+// EscapeMarkdown escapes text so it is shown literally when embedded in a
+// Markdown template that goes through the renderer (user names, queries).
+func EscapeMarkdown(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if strings.IndexByte("\\`*_~[]()<>#+-|!.", s[i]) >= 0 {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,275 @@
+package render
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Telegram parse modes supported by Render
+const (
+	ModeHTML       = "HTML"
+	ModeMarkdownV2 = "MarkdownV2"
+)
+
+// Render converts Markdown for the given Telegram parse mode. Any other
+// mode (including "") returns plain text.
+func Render(md, mode string) string {
+	switch mode {
+	case ModeHTML:
+		return ToHTML(md)
+	case ModeMarkdownV2:
+		return ToMarkdownV2(md)
+	}
+	return ToPlain(md)
+}
+
+// ToHTML renders Markdown as Telegram HTML (parse_mode "HTML").
+func ToHTML(md string) string {
+	return renderBlocks(parseBlocks(md), htmlEmitter{}, false)
+}
+
+// ToMarkdownV2 renders Markdown as Telegram MarkdownV2.
+func ToMarkdownV2(md string) string {
+	return renderBlocks(parseBlocks(md), markdownV2Emitter{}, false)
+}
+
+// ToPlain strips all formatting, for sending without a parse mode.
+func ToPlain(md string) string {
+	return renderBlocks(parseBlocks(md), plainEmitter{}, false)
+}
+
+// emitter produces the output syntax of one parse mode. Arguments to
+// bold/italic/strike/link/quote are already rendered.
+type emitter interface {
+	text(s string) string
+	code(s string) string
+	pre(code, lang string) string
+	bold(inner string) string
+	italic(inner string) string
+	strike(inner string) string
+	link(inner, url string) string
+	quote(inner string) string
+}
+
+func renderBlocks(blocks []block, e emitter, inQuote bool) string {
+	var b strings.Builder
+
+	for i, bl := range blocks {
+		if i > 0 {
+			if bl.kind == blockListItem && blocks[i-1].kind == blockListItem {
+				b.WriteString("\n")
+			} else {
+				b.WriteString("\n\n")
+			}
+		}
+
+		switch bl.kind {
+		case blockParagraph:
+			b.WriteString(renderInline(parseInline(bl.text), e))
+		case blockHeading:
+			b.WriteString(e.bold(renderInline(parseInline(bl.text), e)))
+		case blockCode:
+			b.WriteString(e.pre(bl.text, bl.lang))
+		case blockQuote:
+			inner := renderBlocks(bl.children, e, true)
+			// Telegram does not support nested blockquotes
+			if inQuote {
+				b.WriteString(inner)
+			} else {
+				b.WriteString(e.quote(inner))
+			}
+		case blockListItem:
+			b.WriteString(e.text(strings.Repeat("   ", bl.level) + listBullet(bl)))
+			b.WriteString(renderInline(parseInline(taskText(bl.text)), e))
+		case blockTable:
+			b.WriteString(e.pre(formatTable(bl.rows), ""))
+		case blockRule:
+			b.WriteString(e.text("———"))
+		}
+	}
+
+	return b.String()
+}
+
+func listBullet(bl block) string {
+	if bl.marker[0] >= '0' && bl.marker[0] <= '9' {
+		return strings.TrimRight(bl.marker, ".)") + ". "
+	}
+	if strings.HasPrefix(bl.text, "[ ] ") || strings.HasPrefix(strings.ToLower(bl.text), "[x] ") {
+		return ""
+	}
+	if bl.level > 0 {
+		return "◦ "
+	}
+	return "• "
+}
+
+func taskText(text string) string {
+	switch {
+	case strings.HasPrefix(text, "[ ] "):
+		return "☐ " + text[4:]
+	case strings.HasPrefix(strings.ToLower(text), "[x] "):
+		return "☑ " + text[4:]
+	}
+	return text
+}
+
+func renderInline(nodes []inline, e emitter) string {
+	var b strings.Builder
+	for _, n := range nodes {
+		var out string
+		switch n.kind {
+		case inlineText:
+			out = e.text(n.text)
+		case inlineCode:
+			out = e.code(n.text)
+		case inlineBold:
+			out = e.bold(renderInline(n.children, e))
+		case inlineItalic:
+			out = e.italic(renderInline(n.children, e))
+		case inlineStrike:
+			out = e.strike(renderInline(n.children, e))
+		case inlineLink:
+			out = e.link(renderInline(n.children, e), n.url)
+		}
+
+		// MarkdownV2 reads "__" as underline; \r separates adjacent italics
+		if _, ok := e.(markdownV2Emitter); ok && strings.HasSuffix(b.String(), "_") &&
+			!strings.HasSuffix(b.String(), "\\_") && strings.HasPrefix(out, "_") {
+			b.WriteString("\r")
+		}
+		b.WriteString(out)
+	}
+	return b.String()
+}
+
+// plainInline is the text of nodes without any markup.
+func plainInline(nodes []inline) string {
+	return renderInline(nodes, plainEmitter{})
+}
+
+// formatTable lays out a Markdown table as aligned monospace text.
+func formatTable(rows [][]string) string {
+	var widths []int
+	cells := make([][]string, len(rows))
+	for i, row := range rows {
+		cells[i] = make([]string, len(row))
+		for j, cell := range row {
+			text := plainInline(parseInline(cell))
+			cells[i][j] = text
+			if j >= len(widths) {
+				widths = append(widths, 0)
+			}
+			if w := utf8.RuneCountInString(text); w > widths[j] {
+				widths[j] = w
+			}
+		}
+	}
+
+	var lines []string
+	for i, row := range cells {
+		var parts []string
+		for j, w := range widths {
+			text := ""
+			if j < len(row) {
+				text = row[j]
+			}
+			parts = append(parts, text+strings.Repeat(" ", w-utf8.RuneCountInString(text)))
+		}
+		lines = append(lines, strings.TrimRight(strings.Join(parts, " | "), " "))
+
+		if i == 0 {
+			var sep []string
+			for _, w := range widths {
+				sep = append(sep, strings.Repeat("-", w))
+			}
+			lines = append(lines, strings.Join(sep, "-+-"))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+type htmlEmitter struct{}
+
+var htmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+var htmlAttrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+
+func (htmlEmitter) text(s string) string   { return htmlEscaper.Replace(s) }
+func (htmlEmitter) code(s string) string   { return "<code>" + htmlEscaper.Replace(s) + "</code>" }
+func (htmlEmitter) bold(s string) string   { return "<b>" + s + "</b>" }
+func (htmlEmitter) italic(s string) string { return "<i>" + s + "</i>" }
+func (htmlEmitter) strike(s string) string { return "<s>" + s + "</s>" }
+func (htmlEmitter) quote(s string) string  { return "<blockquote>" + s + "</blockquote>" }
+
+func (htmlEmitter) pre(code, lang string) string {
+	if lang = safeLang(lang); lang != "" {
+		return `<pre><code class="language-` + lang + `">` + htmlEscaper.Replace(code) + "</code></pre>"
+	}
+	return "<pre>" + htmlEscaper.Replace(code) + "</pre>"
+}
+
+func (htmlEmitter) link(inner, url string) string {
+	return `<a href="` + htmlAttrEscaper.Replace(url) + `">` + inner + "</a>"
+}
+
+type markdownV2Emitter struct{}
+
+// Every one of these must be escaped outside of code in MarkdownV2
+const markdownV2Special = "_*[]()~`>#+-=|{}.!\\"
+
+func escapeMarkdownV2(s, special string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if strings.IndexByte(special, s[i]) >= 0 {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func (markdownV2Emitter) text(s string) string   { return escapeMarkdownV2(s, markdownV2Special) }
+func (markdownV2Emitter) code(s string) string   { return "`" + escapeMarkdownV2(s, "`\\") + "`" }
+func (markdownV2Emitter) bold(s string) string   { return "*" + s + "*" }
+func (markdownV2Emitter) italic(s string) string { return "_" + s + "_" }
+func (markdownV2Emitter) strike(s string) string { return "~" + s + "~" }
+
+func (markdownV2Emitter) pre(code, lang string) string {
+	return "```" + safeLang(lang) + "\n" + escapeMarkdownV2(code, "`\\") + "\n```"
+}
+
+func (markdownV2Emitter) link(inner, url string) string {
+	return "[" + inner + "](" + escapeMarkdownV2(url, ")\\") + ")"
+}
+
+func (markdownV2Emitter) quote(s string) string {
+	return ">" + strings.ReplaceAll(s, "\n", "\n>")
+}
+
+type plainEmitter struct{}
+
+func (plainEmitter) text(s string) string         { return s }
+func (plainEmitter) code(s string) string         { return s }
+func (plainEmitter) pre(code, lang string) string { return code }
+func (plainEmitter) bold(s string) string         { return s }
+func (plainEmitter) italic(s string) string       { return s }
+func (plainEmitter) strike(s string) string       { return s }
+func (plainEmitter) quote(s string) string        { return "> " + strings.ReplaceAll(s, "\n", "\n> ") }
+
+func (plainEmitter) link(inner, url string) string {
+	if inner == url {
+		return url
+	}
+	return inner + " (" + url + ")"
+}
+
+// safeLang keeps only characters that are valid in a language tag.
+func safeLang(lang string) string {
+	var b strings.Builder
+	for _, r := range lang {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("+-#_.", r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,213 @@
+package render
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMarkdownV2EscapesSpecialCharacters(t *testing.T) {
+	for _, c := range markdownV2Special {
+		in := "a " + string(c) + " b"
+		if c == '\\' {
+			// A lone backslash before a space is literal in the input
+			in = "a \\ b"
+		}
+		want := "a \\" + string(c) + " b"
+		if got := ToMarkdownV2(in); got != want {
+			t.Errorf("ToMarkdownV2(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	for _, tc := range []struct {
+		name, md, html, mdv2, plain string
+	}{
+		{
+			name:  "escaping",
+			md:    `1 < 2 & 3 > 2. "Done"!`,
+			html:  `1 &lt; 2 &amp; 3 &gt; 2. "Done"!`,
+			mdv2:  `1 < 2 & 3 \> 2\. "Done"\!`,
+			plain: `1 < 2 & 3 > 2. "Done"!`,
+		},
+		{
+			name:  "backslash escapes",
+			md:    `\*not italic\* and 2\_000`,
+			html:  `*not italic* and 2_000`,
+			mdv2:  `\*not italic\* and 2\_000`,
+			plain: `*not italic* and 2_000`,
+		},
+		{
+			name:  "emphasis",
+			md:    "**bold** *italic* __also bold__ _also italic_ ~~gone~~",
+			html:  "<b>bold</b> <i>italic</i> <b>also bold</b> <i>also italic</i> <s>gone</s>",
+			mdv2:  "*bold* _italic_ *also bold* _also italic_ ~gone~",
+			plain: "bold italic also bold also italic gone",
+		},
+		{
+			name:  "nested emphasis",
+			md:    "*italic with **bold** inside*",
+			html:  "<i>italic with <b>bold</b> inside</i>",
+			mdv2:  "_italic with *bold* inside_",
+			plain: "italic with bold inside",
+		},
+		{
+			name:  "adjacent italics",
+			md:    "*one*_two_",
+			html:  "<i>one</i><i>two</i>",
+			mdv2:  "_one_\r_two_",
+			plain: "onetwo",
+		},
+		{
+			name:  "inner span closing with the outer",
+			md:    "**bold *italic*** and *a **b***",
+			html:  "<b>bold <i>italic</i></b> and <i>a <b>b</b></i>",
+			mdv2:  "*bold _italic_* and _a *b*_",
+			plain: "bold italic and a b",
+		},
+		{
+			name:  "snake_case",
+			md:    "call my_func_name now",
+			html:  "call my_func_name now",
+			mdv2:  `call my\_func\_name now`,
+			plain: "call my_func_name now",
+		},
+		{
+			name:  "unclosed markers",
+			md:    "**bold without end and *star and `tick and ~~strike",
+			html:  "**bold without end and *star and `tick and ~~strike",
+			mdv2:  "\\*\\*bold without end and \\*star and \\`tick and \\~\\~strike",
+			plain: "**bold without end and *star and `tick and ~~strike",
+		},
+		{
+			name:  "inline code",
+			md:    "run `a_b * <c>` and ``x ` y``",
+			html:  "run <code>a_b * &lt;c&gt;</code> and <code>x ` y</code>",
+			mdv2:  "run `a_b * <c>` and `x \\` y`",
+			plain: "run a_b * <c> and x ` y",
+		},
+		{
+			name:  "link",
+			md:    "see [the docs](https://example.com/a_b?x=1&y=2)",
+			html:  `see <a href="https://example.com/a_b?x=1&amp;y=2">the docs</a>`,
+			mdv2:  `see [the docs](https://example.com/a_b?x=1&y=2)`,
+			plain: "see the docs (https://example.com/a_b?x=1&y=2)",
+		},
+		{
+			name:  "link with parentheses in the URL",
+			md:    "[Go (language)](https://en.wikipedia.org/wiki/Go_(programming_language)) rocks",
+			html:  `<a href="https://en.wikipedia.org/wiki/Go_(programming_language)">Go (language)</a> rocks`,
+			mdv2:  `[Go \(language\)](https://en.wikipedia.org/wiki/Go_(programming_language\)) rocks`,
+			plain: "Go (language) (https://en.wikipedia.org/wiki/Go_(programming_language)) rocks",
+		},
+		{
+			name:  "autolink",
+			md:    "<https://example.com>",
+			html:  `<a href="https://example.com">https://example.com</a>`,
+			mdv2:  `[https://example\.com](https://example.com)`,
+			plain: "https://example.com",
+		},
+		{
+			name:  "code block with language",
+			md:    "```go\nif a < b && c {\n\tfmt.Println(\"`x`\")\n}\n```",
+			html:  "<pre><code class=\"language-go\">if a &lt; b &amp;&amp; c {\n\tfmt.Println(\"`x`\")\n}</code></pre>",
+			mdv2:  "```go\nif a < b && c {\n\tfmt.Println(\"\\`x\\`\")\n}\n```",
+			plain: "if a < b && c {\n\tfmt.Println(\"`x`\")\n}",
+		},
+		{
+			name:  "code block with unsafe language tag",
+			md:    "```c\"><b>\nint x;\n```",
+			html:  "<pre><code class=\"language-cb\">int x;</code></pre>",
+			mdv2:  "```cb\nint x;\n```",
+			plain: "int x;",
+		},
+		{
+			name:  "unclosed code block",
+			md:    "text\n\n```python\nprint(1)",
+			html:  "text\n\n<pre><code class=\"language-python\">print(1)</code></pre>",
+			mdv2:  "text\n\n```python\nprint(1)\n```",
+			plain: "text\n\nprint(1)",
+		},
+		{
+			name:  "heading and rule",
+			md:    "# Title #\n\n---\n\nBody",
+			html:  "<b>Title</b>\n\n———\n\nBody",
+			mdv2:  "*Title*\n\n———\n\nBody",
+			plain: "Title\n\n———\n\nBody",
+		},
+		{
+			name:  "lists",
+			md:    "- one\n  - nested\n- [x] done\n- [ ] todo\n\n1. first\n2) second",
+			html:  "• one\n   ◦ nested\n☑ done\n☐ todo\n1. first\n2. second",
+			mdv2:  "• one\n   ◦ nested\n☑ done\n☐ todo\n1\\. first\n2\\. second",
+			plain: "• one\n   ◦ nested\n☑ done\n☐ todo\n1. first\n2. second",
+		},
+		{
+			name:  "quote",
+			md:    "> quoted **text**\n> second line",
+			html:  "<blockquote>quoted <b>text</b>\nsecond line</blockquote>",
+			mdv2:  ">quoted *text*\n>second line",
+			plain: "> quoted text\n> second line",
+		},
+		{
+			name:  "nested quotes",
+			md:    "> outer\n> > inner",
+			html:  "<blockquote>outer\n\ninner</blockquote>",
+			mdv2:  ">outer\n>\n>inner",
+			plain: "> outer\n> \n> inner",
+		},
+		{
+			name:  "table",
+			md:    "| Name | Qty |\n|:-----|----:|\n| **apple** | 3 |\n| kiwi & co | 12 |",
+			html:  "<pre>Name      | Qty\n----------+----\napple     | 3\nkiwi &amp; co | 12</pre>",
+			mdv2:  "```\nName      | Qty\n----------+----\napple     | 3\nkiwi & co | 12\n```",
+			plain: "Name      | Qty\n----------+----\napple     | 3\nkiwi & co | 12",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Render(tc.md, ModeHTML); got != tc.html {
+				t.Errorf("HTML:\ngot  %q\nwant %q", got, tc.html)
+			}
+			if got := Render(tc.md, ModeMarkdownV2); got != tc.mdv2 {
+				t.Errorf("MarkdownV2:\ngot  %q\nwant %q", got, tc.mdv2)
+			}
+			if got := Render(tc.md, ""); got != tc.plain {
+				t.Errorf("plain:\ngot  %q\nwant %q", got, tc.plain)
+			}
+		})
+	}
+}
+
+func TestEscapeMarkdown(t *testing.T) {
+	for _, s := range []string{
+		"**not bold** _x_ [link](url) `code`",
+		"a\\b <tag> #1 + 2 - 3 | ! .",
+		"snake_case_name",
+	} {
+		if got := ToPlain(EscapeMarkdown(s)); got != s {
+			t.Errorf("ToPlain(EscapeMarkdown(%q)) = %q", s, got)
+		}
+		if got := ToHTML(EscapeMarkdown(s)); strings.Contains(got, "<b>") || strings.Contains(got, "<a ") || strings.Contains(got, "<code>") {
+			t.Errorf("ToHTML(EscapeMarkdown(%q)) = %q has markup", s, got)
+		}
+	}
+}
+
+func TestSpansAt(t *testing.T) {
+	s := "**bold *it* and [link `c d` x](https://u) end** tail"
+	for _, tc := range []struct {
+		at          int
+		open, close string
+	}{
+		{0, "", ""},
+		{6, "**", "**"},
+		{9, "** *", "** *"},
+		{24, "** [ `", "** ](https://u) `"},
+		{strings.Index(s, " tail"), "", ""},
+	} {
+		open, close := SpansAt(s, tc.at)
+		if strings.Join(open, " ") != tc.open || strings.Join(close, " ") != tc.close {
+			t.Errorf("SpansAt(%d) = %q, %q, want %q, %q", tc.at, open, close, tc.open, tc.close)
+		}
+	}
+}
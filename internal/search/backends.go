@@ -0,0 +1,90 @@
+package search
+
+import (
+	"context"
+	"html"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// SearXNG queries a SearXNG instance. The instance must have the json
+// format enabled (search.formats in settings.yml).
+type SearXNG struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+func (s *SearXNG) Name() string { return "searxng" }
+
+func (s *SearXNG) Search(ctx context.Context, query string, limit int) ([]Result, error) {
+	q := url.Values{"q": {query}, "format": {"json"}, "safesearch": {"1"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.BaseURL+"/search?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var body struct {
+		Results []struct {
+			Title   string `json:"title"`
+			URL     string `json:"url"`
+			Content string `json:"content"`
+		} `json:"results"`
+	}
+	if err := getJSON(s.Client, req, &body); err != nil {
+		return nil, err
+	}
+
+	results := make([]Result, 0, len(body.Results))
+	for _, r := range body.Results {
+		results = append(results, Result{Title: r.Title, URL: r.URL, Snippet: r.Content})
+	}
+	return clean(results, limit), nil
+}
+
+const braveURL = "https://api.search.brave.com/res/v1/web/search"
+
+// Brave queries the Brave Search API.
+type Brave struct {
+	BaseURL string
+	APIKey  string
+	Client  *http.Client
+}
+
+func (b *Brave) Name() string { return "brave" }
+
+func (b *Brave) Search(ctx context.Context, query string, limit int) ([]Result, error) {
+	q := url.Values{"q": {query}}
+	if limit > 0 && limit <= 20 {
+		q.Set("count", strconv.Itoa(limit))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.BaseURL+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Subscription-Token", b.APIKey)
+
+	var body struct {
+		Web struct {
+			Results []struct {
+				Title       string `json:"title"`
+				URL         string `json:"url"`
+				Description string `json:"description"`
+			} `json:"results"`
+		} `json:"web"`
+	}
+	if err := getJSON(b.Client, req, &body); err != nil {
+		return nil, err
+	}
+
+	results := make([]Result, 0, len(body.Web.Results))
+	for _, r := range body.Web.Results {
+		// Brave returns HTML entities in titles and descriptions
+		results = append(results, Result{
+			Title:   html.UnescapeString(r.Title),
+			URL:     r.URL,
+			Snippet: html.UnescapeString(stripTags(r.Description)),
+		})
+	}
+	return clean(results, limit), nil
+}
@@ -0,0 +1,127 @@
+// Package search queries web search backends for the web_search tool.
+// Backends are JSON APIs selected by name and configured by URL.
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const defaultTimeout = 15 * time.Second
+
+// Result is one search hit.
+type Result struct {
+	Title   string
+	URL     string
+	Snippet string
+}
+
+// Provider is a web search backend.
+type Provider interface {
+	Name() string
+	Search(ctx context.Context, query string, limit int) ([]Result, error)
+}
+
+// New builds a provider by name: "searxng" (baseURL of the instance is
+// required) or "brave" (apiKey required). client may be nil.
+func New(name, baseURL, apiKey string, client *http.Client) (Provider, error) {
+	if client == nil {
+		client = &http.Client{Timeout: defaultTimeout}
+	}
+	baseURL = strings.TrimRight(baseURL, "/")
+
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "searxng", "searx":
+		if baseURL == "" {
+			return nil, fmt.Errorf("SEARCH_BASE_URL is required for searxng")
+		}
+		return &SearXNG{BaseURL: baseURL, Client: client}, nil
+	case "brave":
+		if apiKey == "" {
+			return nil, fmt.Errorf("SEARCH_API_KEY is required for brave")
+		}
+		if baseURL == "" {
+			baseURL = braveURL
+		}
+		return &Brave{BaseURL: baseURL, APIKey: apiKey, Client: client}, nil
+	}
+	return nil, fmt.Errorf("unknown search provider %q", name)
+}
+
+// getJSON sends req and decodes a 200 response into v.
+func getJSON(client *http.Client, req *http.Request, v interface{}) error {
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("search API error %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// clean drops results without a URL and cuts the list to limit.
+func clean(results []Result, limit int) []Result {
+	out := results[:0]
+	for _, r := range results {
+		r.Title = strings.TrimSpace(r.Title)
+		r.URL = strings.TrimSpace(r.URL)
+		r.Snippet = strings.TrimSpace(stripTags(r.Snippet))
+		if r.URL == "" {
+			continue
+		}
+		if r.Title == "" {
+			r.Title = r.URL
+		}
+		out = append(out, r)
+		if limit > 0 && len(out) == limit {
+			break
+		}
+	}
+	return out
+}
+
+// stripTags removes the <strong> highlighting some backends put in snippets.
+func stripTags(s string) string {
+	var b strings.Builder
+	in := false
+	for _, r := range s {
+		switch {
+		case r == '<':
+			in = true
+		case r == '>' && in:
+			in = false
+		case !in:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// Fake returns fixed results, for tests.
+type Fake struct {
+	Results []Result
+	Err     error
+	// Queries records what was searched
+	Queries []string
+}
+
+func (f *Fake) Name() string { return "fake" }
+
+func (f *Fake) Search(ctx context.Context, query string, limit int) ([]Result, error) {
+	f.Queries = append(f.Queries, query)
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	results := append([]Result(nil), f.Results...)
+	return clean(results, limit), nil
+}
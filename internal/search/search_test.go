@@ -0,0 +1,79 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSearXNG(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/search" || r.URL.Query().Get("q") != "go 1.24" || r.URL.Query().Get("format") != "json" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		fmt.Fprint(w, `{"results":[
+			{"title":" Go 1.24 ","url":"https://go.dev/doc/go1.24","content":"Release <b>notes</b>"},
+			{"title":"no url","url":""},
+			{"title":"","url":"https://example.com/x","content":"x"},
+			{"title":"over the limit","url":"https://example.com/y"}]}`)
+	}))
+	defer srv.Close()
+
+	p, err := New("searxng", srv.URL+"/", "", srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := p.Search(context.Background(), "go 1.24", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Result{
+		{Title: "Go 1.24", URL: "https://go.dev/doc/go1.24", Snippet: "Release notes"},
+		{Title: "https://example.com/x", URL: "https://example.com/x", Snippet: "x"},
+	}
+	if len(results) != len(want) || results[0] != want[0] || results[1] != want[1] {
+		t.Errorf("got %+v", results)
+	}
+}
+
+func TestBrave(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Subscription-Token") != "key" {
+			http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("count") != "3" {
+			t.Errorf("count %q, want 3", r.URL.Query().Get("count"))
+		}
+		fmt.Fprint(w, `{"web":{"results":[{"title":"Tom &amp; Jerry","url":"https://example.com","description":"A <strong>cat</strong> &amp; mouse"}]}}`)
+	}))
+	defer srv.Close()
+
+	p, _ := New("brave", srv.URL, "key", srv.Client())
+	results, err := p.Search(context.Background(), "tom", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Title != "Tom & Jerry" || results[0].Snippet != "A cat & mouse" {
+		t.Errorf("got %+v", results)
+	}
+
+	p, _ = New("brave", srv.URL, "wrong", srv.Client())
+	if _, err := p.Search(context.Background(), "tom", 3); err == nil {
+		t.Error("no error for a 401 response")
+	}
+}
+
+func TestNewRequiresConfig(t *testing.T) {
+	for _, tc := range []struct{ name, baseURL, key string }{
+		{"searxng", "", ""},
+		{"brave", "", ""},
+		{"bing", "https://example.com", "key"},
+	} {
+		if _, err := New(tc.name, tc.baseURL, tc.key, nil); err == nil {
+			t.Errorf("New(%q, %q, %q) accepted", tc.name, tc.baseURL, tc.key)
+		}
+	}
+}
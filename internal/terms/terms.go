@@ -0,0 +1,31 @@
+// Package terms splits text into the words used for lexical matching, shared
+// by document ranking and the hash embedder.
+package terms
+
+import (
+	"strings"
+	"unicode"
+)
+
+// stopWords are too common to say anything about relevance (English and
+// Indonesian, the languages the bot is localized for).
+var stopWords = map[string]bool{
+	"the": true, "and": true, "for": true, "are": true, "was": true, "what": true, "this": true,
+	"that": true, "with": true, "how": true, "does": true, "can": true, "you": true, "from": true,
+	"about": true, "into": true, "which": true, "who": true, "why": true, "when": true, "where": true,
+	"yang": true, "dan": true, "di": true, "ke": true, "dari": true, "ini": true, "itu": true,
+	"apa": true, "untuk": true, "dengan": true, "bagaimana": true, "adalah": true, "ada": true,
+}
+
+// Split lowercases text and splits it into words worth matching on.
+func Split(text string) []string {
+	var terms []string
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	}) {
+		if len([]rune(w)) >= 2 && !stopWords[w] {
+			terms = append(terms, w)
+		}
+	}
+	return terms
+}
@@ -0,0 +1,282 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Calculator evaluates arithmetic expressions, so the model does not have
+// to do sums in its head.
+type Calculator struct{}
+
+func (Calculator) Name() string { return "calculator" }
+
+func (Calculator) Description() string {
+	return "Evaluate an arithmetic expression exactly. Supports + - * / % ^, parentheses and the functions sqrt, abs, round, floor, ceil, ln, log10, sin, cos, tan, plus the constants pi and e."
+}
+
+func (Calculator) Parameters() json.RawMessage {
+	return json.RawMessage(`{
+		"type": "object",
+		"properties": {
+			"expression": {"type": "string", "description": "The expression, e.g. (12.5 * 4) ^ 2 / sqrt(2)"}
+		},
+		"required": ["expression"]
+	}`)
+}
+
+func (Calculator) Call(ctx context.Context, inv Invocation, args json.RawMessage) (string, error) {
+	var in struct {
+		Expression string `json:"expression"`
+	}
+	if err := decodeArgs(args, &in); err != nil {
+		return "", err
+	}
+
+	v, err := Evaluate(in.Expression)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatFloat(v, 'g', 15, 64), nil
+}
+
+// Evaluate computes expr with the usual precedence; ^ is right-associative
+// and binds tighter than unary minus (-2^2 = -4).
+func Evaluate(expr string) (float64, error) {
+	p := &exprParser{src: []rune(expr)}
+	v, err := p.parseSum()
+	if err != nil {
+		return 0, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.src) {
+		return 0, fmt.Errorf("unexpected %q at position %d", p.src[p.pos], p.pos+1)
+	}
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, fmt.Errorf("result is not a finite number")
+	}
+	return v, nil
+}
+
+// exprParser is a small recursive-descent parser:
+//
+//	sum     = product { ("+" | "-") product }
+//	product = unary { ("*" | "/" | "%") unary }
+//	unary   = ("+" | "-") unary | power
+//	power   = atom [ "^" unary ]
+//	atom    = number | name [ "(" sum ")" ] | "(" sum ")"
+type exprParser struct {
+	src   []rune
+	pos   int
+	depth int
+}
+
+const maxExprDepth = 100
+
+func (p *exprParser) skipSpace() {
+	for p.pos < len(p.src) && unicode.IsSpace(p.src[p.pos]) {
+		p.pos++
+	}
+}
+
+// accept consumes r if it is the next non-space rune.
+func (p *exprParser) accept(r rune) bool {
+	p.skipSpace()
+	if p.pos < len(p.src) && p.src[p.pos] == r {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) parseSum() (float64, error) {
+	v, err := p.parseProduct()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		switch {
+		case p.accept('+'):
+			r, err := p.parseProduct()
+			if err != nil {
+				return 0, err
+			}
+			v += r
+		case p.accept('-'):
+			r, err := p.parseProduct()
+			if err != nil {
+				return 0, err
+			}
+			v -= r
+		default:
+			return v, nil
+		}
+	}
+}
+
+func (p *exprParser) parseProduct() (float64, error) {
+	v, err := p.parseUnary()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		var op rune
+		switch {
+		case p.accept('*'), p.accept('×'):
+			op = '*'
+		case p.accept('/'), p.accept('÷'), p.accept(':'):
+			op = '/'
+		case p.accept('%'):
+			op = '%'
+		default:
+			return v, nil
+		}
+
+		r, err := p.parseUnary()
+		if err != nil {
+			return 0, err
+		}
+		switch op {
+		case '*':
+			v *= r
+		case '/':
+			if r == 0 {
+				return 0, fmt.Errorf("division by zero")
+			}
+			v /= r
+		case '%':
+			if r == 0 {
+				return 0, fmt.Errorf("modulo by zero")
+			}
+			v = math.Mod(v, r)
+		}
+	}
+}
+
+func (p *exprParser) parseUnary() (float64, error) {
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > maxExprDepth {
+		return 0, fmt.Errorf("expression is nested too deeply")
+	}
+
+	if p.accept('-') {
+		v, err := p.parseUnary()
+		return -v, err
+	}
+	if p.accept('+') {
+		return p.parseUnary()
+	}
+	return p.parsePower()
+}
+
+func (p *exprParser) parsePower() (float64, error) {
+	base, err := p.parseAtom()
+	if err != nil {
+		return 0, err
+	}
+	if !p.accept('^') {
+		return base, nil
+	}
+	exp, err := p.parseUnary()
+	if err != nil {
+		return 0, err
+	}
+	return math.Pow(base, exp), nil
+}
+
+var exprFuncs = map[string]func(float64) float64{
+	"sqrt":  math.Sqrt,
+	"abs":   math.Abs,
+	"round": math.Round,
+	"floor": math.Floor,
+	"ceil":  math.Ceil,
+	"ln":    math.Log,
+	"log":   math.Log10,
+	"log10": math.Log10,
+	"sin":   math.Sin,
+	"cos":   math.Cos,
+	"tan":   math.Tan,
+}
+
+var exprConsts = map[string]float64{
+	"pi": math.Pi,
+	"e":  math.E,
+}
+
+func (p *exprParser) parseAtom() (float64, error) {
+	p.skipSpace()
+	if p.pos >= len(p.src) {
+		return 0, fmt.Errorf("unexpected end of expression")
+	}
+
+	if p.accept('(') {
+		v, err := p.parseSum()
+		if err != nil {
+			return 0, err
+		}
+		if !p.accept(')') {
+			return 0, fmt.Errorf("missing closing parenthesis")
+		}
+		return v, nil
+	}
+
+	start := p.pos
+	r := p.src[p.pos]
+	switch {
+	case unicode.IsDigit(r) || r == '.':
+		for p.pos < len(p.src) && (unicode.IsDigit(p.src[p.pos]) || p.src[p.pos] == '.' || p.src[p.pos] == '_') {
+			p.pos++
+		}
+		// Exponent, e.g. 1.5e-3
+		if p.pos < len(p.src) && (p.src[p.pos] == 'e' || p.src[p.pos] == 'E') {
+			end := p.pos + 1
+			if end < len(p.src) && (p.src[end] == '+' || p.src[end] == '-') {
+				end++
+			}
+			if end < len(p.src) && unicode.IsDigit(p.src[end]) {
+				p.pos = end
+				for p.pos < len(p.src) && unicode.IsDigit(p.src[p.pos]) {
+					p.pos++
+				}
+			}
+		}
+		text := strings.ReplaceAll(string(p.src[start:p.pos]), "_", "")
+		v, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid number %q", text)
+		}
+		return v, nil
+
+	case unicode.IsLetter(r):
+		for p.pos < len(p.src) && (unicode.IsLetter(p.src[p.pos]) || unicode.IsDigit(p.src[p.pos])) {
+			p.pos++
+		}
+		name := strings.ToLower(string(p.src[start:p.pos]))
+		if c, ok := exprConsts[name]; ok {
+			return c, nil
+		}
+		fn, ok := exprFuncs[name]
+		if !ok {
+			return 0, fmt.Errorf("unknown name %q", name)
+		}
+		if !p.accept('(') {
+			return 0, fmt.Errorf("%s needs parentheses, e.g. %s(2)", name, name)
+		}
+		arg, err := p.parseSum()
+		if err != nil {
+			return 0, err
+		}
+		if !p.accept(')') {
+			return 0, fmt.Errorf("missing closing parenthesis after %s(", name)
+		}
+		return fn(arg), nil
+	}
+
+	return 0, fmt.Errorf("unexpected %q at position %d", r, p.pos+1)
+}
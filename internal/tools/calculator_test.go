@@ -0,0 +1,84 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestEvaluate(t *testing.T) {
+	for expr, want := range map[string]float64{
+		"1 + 2 * 3":          7,
+		"(1 + 2) * 3":        9,
+		"10 - 4 - 3":         3,
+		"100 / 10 / 5":       2,
+		"7 % 4":              3,
+		"2 ^ 3 ^ 2":          512,
+		"-2 ^ 2":             -4,
+		"(-2) ^ 2":           4,
+		"2 ^ -1":             0.5,
+		"--3":                3,
+		"+4":                 4,
+		"1_000_000 * 2":      2e6,
+		"1.5e-3 * 2e3":       3,
+		".5 + .25":           0.75,
+		"3 × 4 ÷ 2":          6,
+		"9 : 3":              3,
+		"sqrt(16) + abs(-2)": 6,
+		"round(2.5)":         3,
+		"floor(-1.5)":        -2,
+		"ceil(1.2)":          2,
+		"ln(e)":              1,
+		"log(1000)":          3,
+		"log10(0.01)":        -2,
+		"cos(0)":             1,
+		"SQRT(PI * PI)":      math.Pi,
+		"  2*(3+(4-1))  ":    12,
+	} {
+		got, err := Evaluate(expr)
+		if err != nil {
+			t.Errorf("Evaluate(%q): %v", expr, err)
+			continue
+		}
+		if math.Abs(got-want) > 1e-9 {
+			t.Errorf("Evaluate(%q) = %v, want %v", expr, got, want)
+		}
+	}
+}
+
+func TestEvaluateErrors(t *testing.T) {
+	for expr, want := range map[string]string{
+		"":                             "unexpected end of expression",
+		"1 +":                          "unexpected end of expression",
+		"1 / 0":                        "division by zero",
+		"5 % 0":                        "modulo by zero",
+		"(1 + 2":                       "missing closing parenthesis",
+		"sqrt(4":                       "missing closing parenthesis after sqrt(",
+		"sqrt 4":                       "sqrt needs parentheses",
+		"foo(1)":                       `unknown name "foo"`,
+		"1 2":                          `unexpected '2' at position 3`,
+		"1 + $":                        `unexpected '$' at position 5`,
+		"1.2.3":                        `invalid number "1.2.3"`,
+		"sqrt(-1)":                     "not a finite number",
+		"10 ^ 400":                     "not a finite number",
+		strings.Repeat("-", 200) + "1": "nested too deeply",
+		strings.Repeat("(", 200) + "1": "nested too deeply",
+	} {
+		_, err := Evaluate(expr)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Evaluate(%.20q): got error %v, want %q", expr, err, want)
+		}
+	}
+}
+
+func TestCalculatorCall(t *testing.T) {
+	out, err := Calculator{}.Call(context.Background(), Invocation{}, json.RawMessage(`{"expression":"0.1 + 0.2"}`))
+	if err != nil || out != "0.3" {
+		t.Errorf("got %q, %v", out, err)
+	}
+	if _, err := (Calculator{}).Call(context.Background(), Invocation{}, json.RawMessage(`{"expression":1}`)); err == nil || !strings.Contains(err.Error(), "invalid arguments") {
+		t.Errorf("got error %v", err)
+	}
+}
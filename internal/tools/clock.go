@@ -0,0 +1,64 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	// Timezone names must work on hosts without /usr/share/zoneinfo
+	_ "time/tzdata"
+)
+
+// Clock tells the current date and time, which the model otherwise does
+// not know.
+type Clock struct {
+	// DefaultZone is used when the model passes no timezone; nil means UTC
+	DefaultZone *time.Location
+	// Now is replaceable for tests
+	Now func() time.Time
+}
+
+func NewClock(defaultZone *time.Location) *Clock {
+	return &Clock{DefaultZone: defaultZone, Now: time.Now}
+}
+
+func (c *Clock) Name() string { return "current_time" }
+
+func (c *Clock) Description() string {
+	return "Get the current date, time and weekday, optionally in an IANA timezone such as Asia/Jakarta or Europe/London."
+}
+
+func (c *Clock) Parameters() json.RawMessage {
+	return json.RawMessage(`{
+		"type": "object",
+		"properties": {
+			"timezone": {"type": "string", "description": "IANA timezone name; defaults to the bot's timezone"}
+		}
+	}`)
+}
+
+func (c *Clock) Call(ctx context.Context, inv Invocation, args json.RawMessage) (string, error) {
+	var in struct {
+		Timezone string `json:"timezone"`
+	}
+	if err := decodeArgs(args, &in); err != nil {
+		return "", err
+	}
+
+	loc := c.DefaultZone
+	if loc == nil {
+		loc = time.UTC
+	}
+	if tz := strings.TrimSpace(in.Timezone); tz != "" {
+		l, err := time.LoadLocation(tz)
+		if err != nil {
+			return "", fmt.Errorf("unknown timezone %q", tz)
+		}
+		loc = l
+	}
+
+	now := c.Now().In(loc)
+	return fmt.Sprintf("%s (%s, %s)", now.Format("2006-01-02 15:04:05 -07:00"), now.Weekday(), loc), nil
+}
@@ -0,0 +1,57 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"telechatbot/internal/webfetch"
+)
+
+// FetchURL lets the model read a web page.
+type FetchURL struct {
+	Fetcher *webfetch.Fetcher
+}
+
+func NewFetchURL(f *webfetch.Fetcher) *FetchURL {
+	return &FetchURL{Fetcher: f}
+}
+
+func (t *FetchURL) Name() string { return "fetch_url" }
+
+func (t *FetchURL) Description() string {
+	return "Download a web page (HTML, plain text or PDF) and return its title and text. Use it to read links the user shares or pages you need to answer."
+}
+
+func (t *FetchURL) Parameters() json.RawMessage {
+	return json.RawMessage(`{
+		"type": "object",
+		"properties": {
+			"url": {"type": "string", "description": "Absolute http or https URL"}
+		},
+		"required": ["url"]
+	}`)
+}
+
+func (t *FetchURL) Call(ctx context.Context, inv Invocation, args json.RawMessage) (string, error) {
+	var in struct {
+		URL string `json:"url"`
+	}
+	if err := decodeArgs(args, &in); err != nil {
+		return "", err
+	}
+
+	page, err := t.Fetcher.Fetch(ctx, in.URL)
+	if err != nil {
+		return "", err
+	}
+
+	inv.Sources.Add(page.Title, page.URL)
+
+	var b strings.Builder
+	if page.Title != "" {
+		fmt.Fprintf(&b, "Title: %s\n", page.Title)
+	}
+	fmt.Fprintf(&b, "URL: %s\n\n%s", page.URL, page.Text)
+	return b.String(), nil
+}
@@ -0,0 +1,99 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"telechatbot/internal/database"
+)
+
+const (
+	historySearchLimit = 8
+	historySnippetLen  = 400
+)
+
+// HistorySearch looks up earlier messages of the current conversation,
+// including those no longer in the prompt.
+type HistorySearch struct {
+	DB *database.DB
+}
+
+func NewHistorySearch(db *database.DB) *HistorySearch {
+	return &HistorySearch{DB: db}
+}
+
+func (h *HistorySearch) Name() string { return "conversation_search" }
+
+func (h *HistorySearch) Description() string {
+	return "Search earlier messages of this conversation for a word or phrase. Use it when the user refers to something discussed before that is not in the visible context."
+}
+
+func (h *HistorySearch) Parameters() json.RawMessage {
+	return json.RawMessage(`{
+		"type": "object",
+		"properties": {
+			"query": {"type": "string", "description": "Word or exact phrase to look for"}
+		},
+		"required": ["query"]
+	}`)
+}
+
+func (h *HistorySearch) Call(ctx context.Context, inv Invocation, args json.RawMessage) (string, error) {
+	var in struct {
+		Query string `json:"query"`
+	}
+	if err := decodeArgs(args, &in); err != nil {
+		return "", err
+	}
+	query := strings.TrimSpace(in.Query)
+	if query == "" {
+		return "", fmt.Errorf("query is empty")
+	}
+
+	found, err := h.DB.SearchHistory(inv.ChatID, inv.ThreadID, query, historySearchLimit)
+	if err != nil {
+		return "", fmt.Errorf("history lookup failed: %v", err)
+	}
+	if len(found) == 0 {
+		return fmt.Sprintf("No earlier messages contain %q.", query), nil
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d earlier messages contain %q (newest first):\n", len(found), query)
+	for _, m := range found {
+		fmt.Fprintf(&b, "\n#%d %s: %s\n", m.ID, m.Role, snippet(m.Content, query, historySnippetLen))
+	}
+	return b.String(), nil
+}
+
+// snippet cuts text to about max runes around the first match of query.
+func snippet(text, query string, max int) string {
+	r := []rune(text)
+	if len(r) <= max {
+		return text
+	}
+
+	at := 0
+	if i := strings.Index(strings.ToLower(text), strings.ToLower(query)); i >= 0 && i <= len(text) {
+		at = len([]rune(text[:i]))
+	}
+	start := at - max/3
+	if start < 0 {
+		start = 0
+	}
+	end := start + max
+	if end > len(r) {
+		end = len(r)
+		start = end - max
+	}
+
+	out := string(r[start:end])
+	if start > 0 {
+		out = "…" + out
+	}
+	if end < len(r) {
+		out += "…"
+	}
+	return out
+}
@@ -0,0 +1,82 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"telechatbot/internal/search"
+)
+
+const (
+	defaultSearchResults = 5
+	maxSearchResults     = 10
+)
+
+// WebSearch exposes a search.Provider to the model.
+type WebSearch struct {
+	Provider search.Provider
+	// Results is how many hits are returned when the model doesn't ask
+	Results int
+}
+
+func NewWebSearch(p search.Provider) *WebSearch {
+	return &WebSearch{Provider: p, Results: defaultSearchResults}
+}
+
+func (t *WebSearch) Name() string { return "web_search" }
+
+func (t *WebSearch) Description() string {
+	return "Search the web for current information. Returns numbered results with title, URL and snippet. Use fetch_url to read a result in full if the snippet is not enough."
+}
+
+func (t *WebSearch) Parameters() json.RawMessage {
+	return json.RawMessage(`{
+		"type": "object",
+		"properties": {
+			"query": {"type": "string", "description": "Search query, in the language most likely to find good results"},
+			"count": {"type": "integer", "description": "Number of results, 1-10"}
+		},
+		"required": ["query"]
+	}`)
+}
+
+func (t *WebSearch) Call(ctx context.Context, inv Invocation, args json.RawMessage) (string, error) {
+	var in struct {
+		Query string `json:"query"`
+		Count int    `json:"count"`
+	}
+	if err := decodeArgs(args, &in); err != nil {
+		return "", err
+	}
+	query := strings.TrimSpace(in.Query)
+	if query == "" {
+		return "", fmt.Errorf("query is empty")
+	}
+	count := in.Count
+	if count <= 0 {
+		count = t.Results
+	}
+	if count > maxSearchResults {
+		count = maxSearchResults
+	}
+
+	results, err := t.Provider.Search(ctx, query, count)
+	if err != nil {
+		return "", fmt.Errorf("search failed: %v", err)
+	}
+	if len(results) == 0 {
+		return fmt.Sprintf("No results for %q.", query), nil
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Results for %q. Cite what you use as Markdown links [Title](URL) with these exact URLs:\n", query)
+	for i, r := range results {
+		inv.Sources.Add(r.Title, r.URL)
+		fmt.Fprintf(&b, "\n[%d] %s\nURL: %s\n", i+1, r.Title, r.URL)
+		if r.Snippet != "" {
+			fmt.Fprintf(&b, "%s\n", r.Snippet)
+		}
+	}
+	return b.String(), nil
+}
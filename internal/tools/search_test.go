@@ -0,0 +1,104 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"telechatbot/internal/search"
+	"testing"
+)
+
+func TestWebSearchFormatsResults(t *testing.T) {
+	fake := &search.Fake{Results: []search.Result{
+		{Title: "Go 1.24 released", URL: "https://go.dev/blog/go1.24", Snippet: "The <strong>Go</strong> team is happy to announce"},
+		{Title: "", URL: "https://example.com/untitled"},
+		{Title: "No URL, dropped", URL: ""},
+	}}
+	inv := Invocation{Sources: &Sources{}}
+
+	out, err := NewWebSearch(fake).Call(context.Background(), inv, json.RawMessage(`{"query":"  go release  "}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `Results for "go release". Cite what you use as Markdown links [Title](URL) with these exact URLs:
+
+[1] Go 1.24 released
+URL: https://go.dev/blog/go1.24
+The Go team is happy to announce
+
+[2] https://example.com/untitled
+URL: https://example.com/untitled
+`
+	if out != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out, want)
+	}
+	if len(fake.Queries) != 1 || fake.Queries[0] != "go release" {
+		t.Errorf("searched %q", fake.Queries)
+	}
+	if got := inv.Sources.List(); len(got) != 2 || got[0].URL != "https://go.dev/blog/go1.24" || got[1].Title != "https://example.com/untitled" {
+		t.Errorf("sources %+v", got)
+	}
+}
+
+func TestWebSearchCount(t *testing.T) {
+	var results []search.Result
+	for i := 0; i < 20; i++ {
+		results = append(results, search.Result{Title: "r", URL: "https://example.com/" + string(rune('a'+i))})
+	}
+	ws := NewWebSearch(&search.Fake{Results: results})
+
+	for args, want := range map[string]int{
+		`{"query":"q"}`:            defaultSearchResults,
+		`{"query":"q","count":2}`:  2,
+		`{"query":"q","count":50}`: maxSearchResults,
+	} {
+		out, err := ws.Call(context.Background(), Invocation{}, json.RawMessage(args))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Count(out, "\nURL: "); got != want {
+			t.Errorf("%s: %d results, want %d", args, got, want)
+		}
+	}
+}
+
+func TestWebSearchErrors(t *testing.T) {
+	if out, err := NewWebSearch(&search.Fake{}).Call(context.Background(), Invocation{}, json.RawMessage(`{"query":"nothing"}`)); err != nil || out != `No results for "nothing".` {
+		t.Errorf("got %q, %v", out, err)
+	}
+	if _, err := NewWebSearch(&search.Fake{}).Call(context.Background(), Invocation{}, json.RawMessage(`{"query":" "}`)); err == nil {
+		t.Error("empty query accepted")
+	}
+	fake := &search.Fake{Err: errors.New("backend down")}
+	if _, err := NewWebSearch(fake).Call(context.Background(), Invocation{}, json.RawMessage(`{"query":"q"}`)); err == nil || !strings.Contains(err.Error(), "backend down") {
+		t.Errorf("got error %v", err)
+	}
+}
+
+func TestSourcesDedup(t *testing.T) {
+	var nilSources *Sources
+	nilSources.Add("ignored", "https://example.com")
+	if nilSources.List() != nil {
+		t.Error("nil Sources returned a list")
+	}
+
+	s := &Sources{}
+	s.Add("First", "https://a.example")
+	s.Add("Second", "https://b.example")
+	s.Add("First again", "https://a.example")
+	s.Add("No URL", "")
+	got := s.List()
+	if len(got) != 2 || got[0] != (Source{"First", "https://a.example"}) || got[1] != (Source{"Second", "https://b.example"}) {
+		t.Errorf("got %+v", got)
+	}
+
+	// Two searches with overlapping results share one list
+	fake := &search.Fake{Results: []search.Result{{Title: "B", URL: "https://b.example"}, {Title: "C", URL: "https://c.example"}}}
+	if _, err := NewWebSearch(fake).Call(context.Background(), Invocation{Sources: s}, json.RawMessage(`{"query":"q"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.List(); len(got) != 3 || got[2].URL != "https://c.example" {
+		t.Errorf("got %+v", got)
+	}
+}
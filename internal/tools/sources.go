@@ -0,0 +1,44 @@
+package tools
+
+import "sync"
+
+// Source is a page a tool showed to the model.
+type Source struct {
+	Title string
+	URL   string
+}
+
+// Sources collects the pages seen while answering one message, so the
+// reply can list real links instead of whatever the model remembers.
+// A nil *Sources ignores Add.
+type Sources struct {
+	mu   sync.Mutex
+	list []Source
+	seen map[string]bool
+}
+
+func (s *Sources) Add(title, url string) {
+	if s == nil || url == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.seen == nil {
+		s.seen = make(map[string]bool)
+	}
+	if s.seen[url] {
+		return
+	}
+	s.seen[url] = true
+	s.list = append(s.list, Source{Title: title, URL: url})
+}
+
+// List returns the sources in the order they were added.
+func (s *Sources) List() []Source {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Source(nil), s.list...)
+}
@@ -0,0 +1,153 @@
+// Package tools holds the functions the model can call during a reply.
+// Each tool describes its arguments with a JSON schema; the dispatcher
+// offers Registry.Definitions() to the model and runs the calls it makes.
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"telechatbot/internal/models"
+	"time"
+)
+
+// callTimeout bounds a single tool call so a stuck tool cannot hold the
+// reply forever
+const callTimeout = 30 * time.Second
+
+// maxResultLen keeps tool output from eating the whole context window
+const maxResultLen = 12000
+
+// Tool is one function the model can call.
+type Tool interface {
+	// Name is what the model calls, [a-zA-Z0-9_-] only
+	Name() string
+	Description() string
+	// Parameters is the JSON schema of the arguments object
+	Parameters() json.RawMessage
+	// Call runs the tool. The returned text is passed to the model as is;
+	// errors are reported to the model too, so it can retry or explain.
+	Call(ctx context.Context, inv Invocation, args json.RawMessage) (string, error)
+}
+
+// Invocation tells a tool where it was called from.
+type Invocation struct {
+	ChatID   int64
+	ThreadID int
+	UserID   int64
+	// Sources collects pages shown to the model for citation; may be nil
+	Sources *Sources
+}
+
+// Registry is a set of tools by name. It is safe for concurrent use.
+type Registry struct {
+	mu    sync.RWMutex
+	tools map[string]Tool
+}
+
+func NewRegistry(tools ...Tool) *Registry {
+	r := &Registry{tools: make(map[string]Tool)}
+	for _, t := range tools {
+		r.Register(t)
+	}
+	return r
+}
+
+// Register adds t, replacing a tool with the same name.
+func (r *Registry) Register(t Tool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.tools[t.Name()]; exists {
+		log.Printf("[WARN] Tool %q registered twice, keeping the last one", t.Name())
+	}
+	r.tools[t.Name()] = t
+}
+
+// Get looks up a tool. A nil registry has none.
+func (r *Registry) Get(name string) (Tool, bool) {
+	if r == nil {
+		return nil, false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, ok := r.tools[name]
+	return t, ok
+}
+
+// Len reports how many tools are registered. A nil registry is empty.
+func (r *Registry) Len() int {
+	if r == nil {
+		return 0
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.tools)
+}
+
+// Definitions returns the tools in the request format, sorted by name so
+// the prompt stays the same between requests.
+func (r *Registry) Definitions() []models.Tool {
+	if r == nil {
+		return nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	defs := make([]models.Tool, 0, len(r.tools))
+	for _, t := range r.tools {
+		defs = append(defs, models.Tool{
+			Type: "function",
+			Function: models.ToolFunction{
+				Name:        t.Name(),
+				Description: t.Description(),
+				Parameters:  t.Parameters(),
+			},
+		})
+	}
+	sort.Slice(defs, func(i, j int) bool { return defs[i].Function.Name < defs[j].Function.Name })
+	return defs
+}
+
+// Execute runs one tool call and returns the text for the "tool" message.
+// Unknown tools, bad arguments and failures become an error text for the
+// model instead of failing the reply.
+func (r *Registry) Execute(ctx context.Context, inv Invocation, call models.ToolCall) string {
+	t, ok := r.Get(call.Function.Name)
+	if !ok {
+		return fmt.Sprintf("error: unknown tool %q", call.Function.Name)
+	}
+
+	args := json.RawMessage(call.Function.Arguments)
+	if len(args) == 0 {
+		args = json.RawMessage("{}")
+	}
+	if !json.Valid(args) {
+		return "error: arguments are not valid JSON"
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, callTimeout)
+	defer cancel()
+
+	start := time.Now()
+	result, err := t.Call(ctx, inv, args)
+	if err != nil {
+		log.Printf("[WARN] Tool %s failed after %v: %v", t.Name(), time.Since(start).Round(time.Millisecond), err)
+		return "error: " + err.Error()
+	}
+
+	if r := []rune(result); len(r) > maxResultLen {
+		result = string(r[:maxResultLen]) + "\n[truncated]"
+	}
+	return result
+}
+
+// decodeArgs unmarshals the call arguments into v with a readable error.
+func decodeArgs(args json.RawMessage, v interface{}) error {
+	if err := json.Unmarshal(args, v); err != nil {
+		return fmt.Errorf("invalid arguments: %v", err)
+	}
+	return nil
+}
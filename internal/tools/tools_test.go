@@ -0,0 +1,81 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"telechatbot/internal/models"
+	"testing"
+)
+
+func toolCall(name, args string) models.ToolCall {
+	return models.ToolCall{ID: "call_1", Type: "function", Function: models.ToolCallFunction{Name: name, Arguments: args}}
+}
+
+// echoTool returns a fixed text.
+type echoTool struct{ text string }
+
+func (echoTool) Name() string                { return "echo" }
+func (echoTool) Description() string         { return "Echo" }
+func (echoTool) Parameters() json.RawMessage { return json.RawMessage(`{"type":"object"}`) }
+
+func (e echoTool) Call(ctx context.Context, inv Invocation, args json.RawMessage) (string, error) {
+	return e.text, nil
+}
+
+func TestRegistryExecute(t *testing.T) {
+	r := NewRegistry(Calculator{})
+	call := func(name, args string) string {
+		return r.Execute(context.Background(), Invocation{}, toolCall(name, args))
+	}
+
+	if got := call("calculator", `{"expression":"6*7"}`); got != "42" {
+		t.Errorf("got %q", got)
+	}
+	if got := call("no_such_tool", `{}`); got != `error: unknown tool "no_such_tool"` {
+		t.Errorf("unknown tool: got %q", got)
+	}
+	if got := call("calculator", `{"expression":`); got != "error: arguments are not valid JSON" {
+		t.Errorf("invalid JSON: got %q", got)
+	}
+	// Missing arguments are an empty object, so the tool reports the error
+	if got := call("calculator", ``); got != "error: unexpected end of expression" {
+		t.Errorf("no arguments: got %q", got)
+	}
+	if got := call("calculator", `{"expression":"1/0"}`); got != "error: division by zero" {
+		t.Errorf("tool error: got %q", got)
+	}
+
+	var nilRegistry *Registry
+	if _, ok := nilRegistry.Get("calculator"); ok || nilRegistry.Len() != 0 {
+		t.Error("nil registry has tools")
+	}
+}
+
+func TestRegistryTruncatesResults(t *testing.T) {
+	r := NewRegistry(echoTool{strings.Repeat("é", maxResultLen+10)})
+	got := r.Execute(context.Background(), Invocation{}, toolCall("echo", `{}`))
+	if !strings.HasSuffix(got, "\n[truncated]") || len([]rune(got)) != maxResultLen+len("\n[truncated]") {
+		t.Errorf("got %d runes", len([]rune(got)))
+	}
+}
+
+func TestRegistryDefinitions(t *testing.T) {
+	r := NewRegistry(echoTool{}, Calculator{}, NewWebSearch(nil))
+	defs := r.Definitions()
+	var names []string
+	for _, d := range defs {
+		if d.Type != "function" || !json.Valid(d.Function.Parameters) {
+			t.Errorf("bad definition %+v", d)
+		}
+		names = append(names, d.Function.Name)
+	}
+	if got := strings.Join(names, ","); got != "calculator,echo,web_search" {
+		t.Errorf("got %s", got)
+	}
+
+	var none *Registry
+	if defs := none.Definitions(); defs != nil || none.Len() != 0 {
+		t.Errorf("nil registry: got %+v", defs)
+	}
+}
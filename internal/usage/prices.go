@@ -0,0 +1,75 @@
+package usage
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Price is what a model costs in USD per million tokens.
+type Price struct {
+	Input  float64
+	Output float64
+}
+
+// Prices maps model names (lower case) to their price.
+type Prices map[string]Price
+
+// DefaultPrices are Groq's list prices at the time of writing; MODEL_PRICES
+// overrides and extends them.
+var DefaultPrices = Prices{
+	"llama-3.1-8b-instant":                          {0.05, 0.08},
+	"llama-3.3-70b-versatile":                       {0.59, 0.79},
+	"meta-llama/llama-4-scout-17b-16e-instruct":     {0.11, 0.34},
+	"meta-llama/llama-4-maverick-17b-128e-instruct": {0.20, 0.60},
+	"openai/gpt-oss-20b":                            {0.10, 0.50},
+	"openai/gpt-oss-120b":                           {0.15, 0.75},
+	"qwen/qwen3-32b":                                {0.29, 0.59},
+	"moonshotai/kimi-k2-instruct":                   {1.00, 3.00},
+}
+
+// ParsePrices reads "model=input/output" entries separated by commas or
+// semicolons, prices in USD per million tokens, on top of DefaultPrices.
+func ParsePrices(s string) (Prices, error) {
+	prices := make(Prices, len(DefaultPrices))
+	for m, p := range DefaultPrices {
+		prices[m] = p
+	}
+
+	for _, entry := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ';' }) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		eq := strings.LastIndex(entry, "=")
+		if eq <= 0 {
+			return nil, fmt.Errorf("price %q: want model=input/output", entry)
+		}
+		model := strings.ToLower(strings.TrimSpace(entry[:eq]))
+		in, out, ok := strings.Cut(entry[eq+1:], "/")
+		if !ok {
+			return nil, fmt.Errorf("price %q: want model=input/output", entry)
+		}
+		var p Price
+		var err error
+		if p.Input, err = strconv.ParseFloat(strings.TrimSpace(in), 64); err != nil {
+			return nil, fmt.Errorf("price %q: %v", entry, err)
+		}
+		if p.Output, err = strconv.ParseFloat(strings.TrimSpace(out), 64); err != nil {
+			return nil, fmt.Errorf("price %q: %v", entry, err)
+		}
+		prices[model] = p
+	}
+	return prices, nil
+}
+
+// Cost returns the USD cost of the tokens, and false for a model without
+// a price. Reasoning tokens are billed as output, they are part of the
+// completion tokens already.
+func (p Prices) Cost(model string, promptTokens, completionTokens int) (float64, bool) {
+	price, ok := p[strings.ToLower(model)]
+	if !ok {
+		return 0, false
+	}
+	return (float64(promptTokens)*price.Input + float64(completionTokens)*price.Output) / 1e6, true
+}
@@ -0,0 +1,58 @@
+package usage
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParsePrices(t *testing.T) {
+	prices, err := ParsePrices(" my-model = 1.5/3 ; LLAMA-3.1-8B-INSTANT=0.1/0.2, org/model=v2=0/0.25,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for model, want := range map[string]Price{
+		"my-model":             {1.5, 3},
+		"llama-3.1-8b-instant": {0.1, 0.2}, // overrides the default
+		"org/model=v2":         {0, 0.25},  // the price follows the last "="
+		"qwen/qwen3-32b":       DefaultPrices["qwen/qwen3-32b"],
+	} {
+		if got, ok := prices[model]; !ok || got != want {
+			t.Errorf("%s: got %+v, %v, want %+v", model, got, ok, want)
+		}
+	}
+	// The defaults themselves are not changed
+	if DefaultPrices["llama-3.1-8b-instant"] != (Price{0.05, 0.08}) {
+		t.Error("DefaultPrices modified")
+	}
+
+	if prices, err := ParsePrices(""); err != nil || len(prices) != len(DefaultPrices) {
+		t.Errorf("empty: got %d prices, %v", len(prices), err)
+	}
+	for _, bad := range []string{"model", "=1/2", "model=1", "model=a/2", "model=1/b"} {
+		if _, err := ParsePrices(bad); err == nil {
+			t.Errorf("%q: no error", bad)
+		}
+	}
+}
+
+func TestCost(t *testing.T) {
+	prices := Prices{"m": {Input: 0.5, Output: 2}}
+
+	for _, tt := range []struct {
+		model              string
+		prompt, completion int
+		want               float64
+		ok                 bool
+	}{
+		{"m", 1_000_000, 0, 0.5, true},
+		{"m", 0, 1_000_000, 2, true},
+		{"M", 2000, 500, 0.002, true},
+		{"m", 0, 0, 0, true},
+		{"unknown", 1000, 1000, 0, false},
+	} {
+		got, ok := prices.Cost(tt.model, tt.prompt, tt.completion)
+		if ok != tt.ok || math.Abs(got-tt.want) > 1e-12 {
+			t.Errorf("Cost(%s, %d, %d) = %g, %v, want %g, %v", tt.model, tt.prompt, tt.completion, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+// Package usage records what every completion request costs and who it
+// was for. Handlers put a Scope in the request context; the Recorder,
+// installed as the providers' UsageHandler, writes it to the ledger.
+package usage
+
+import (
+	"context"
+	"log"
+	"telechatbot/internal/api"
+	"telechatbot/internal/database"
+)
+
+// Purposes of a request, stored with each ledger row
+const (
+	PurposeChat    = "chat"
+	PurposeVision  = "vision"
+	PurposeTitle   = "title"
+	PurposeInline  = "inline"
+	PurposeSummary = "summary"
+	PurposeOther   = "other"
+)
+
+// Scope is who a request is made for. Zero IDs mean "none".
+type Scope struct {
+	UserID   int64
+	ChatID   int64
+	ThreadID int
+	Purpose  string
+}
+
+type scopeKey struct{}
+
+// WithScope attaches s to ctx.
+func WithScope(ctx context.Context, s Scope) context.Context {
+	return context.WithValue(ctx, scopeKey{}, s)
+}
+
+// WithPurpose keeps the scope of ctx but changes its purpose.
+func WithPurpose(ctx context.Context, purpose string) context.Context {
+	s := FromContext(ctx)
+	s.Purpose = purpose
+	return WithScope(ctx, s)
+}
+
+// FromContext returns the scope of ctx, or a zero Scope.
+func FromContext(ctx context.Context) Scope {
+	s, _ := ctx.Value(scopeKey{}).(Scope)
+	return s
+}
+
+// Recorder writes usage to the database.
+type Recorder struct {
+	DB *database.DB
+}
+
+// Record implements api.UsageHandler.
+func (r *Recorder) Record(ctx context.Context, u api.Usage) {
+	s := FromContext(ctx)
+	if s.Purpose == "" {
+		s.Purpose = PurposeOther
+	}
+	err := r.DB.AddUsage(database.UsageRecord{
+		UserID:           s.UserID,
+		ChatID:           s.ChatID,
+		ThreadID:         s.ThreadID,
+		Purpose:          s.Purpose,
+		Provider:         u.Provider,
+		Model:            u.Model,
+		KeyIndex:         u.KeyIndex,
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		ReasoningTokens:  u.ReasoningTokens,
+		Latency:          u.Latency,
+	})
+	if err != nil {
+		log.Printf("[ERROR] Failed to record usage of %s: %v", u.Model, err)
+	}
+}
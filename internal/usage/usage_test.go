@@ -0,0 +1,46 @@
+package usage
+
+import (
+	"context"
+	"path/filepath"
+	"telechatbot/internal/api"
+	"telechatbot/internal/database"
+	"testing"
+	"time"
+)
+
+func TestRecorderWritesScope(t *testing.T) {
+	db, err := database.OpenDB(filepath.Join(t.TempDir(), "bot.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Conn.Close() })
+	if _, err := db.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	r := &Recorder{DB: db}
+
+	ctx := WithScope(context.Background(), Scope{UserID: 1, ChatID: -100, ThreadID: 7, Purpose: PurposeChat})
+	r.Record(ctx, api.Usage{Provider: "groq", Model: "m", PromptTokens: 100, CompletionTokens: 20, ReasoningTokens: 5, Latency: 300 * time.Millisecond})
+	r.Record(WithPurpose(ctx, PurposeTitle), api.Usage{Model: "m", PromptTokens: 10, CompletionTokens: 2})
+	// Requests made outside of a handler have no scope
+	r.Record(context.Background(), api.Usage{Model: "m", PromptTokens: 1})
+
+	totals, err := db.UsageTotals(database.UsageFilter{}, database.UsageByPurpose)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]database.UsageTotal)
+	for _, tt := range totals {
+		got[tt.Key] = tt
+	}
+	if c := got[PurposeChat]; c.PromptTokens != 100 || c.CompletionTokens != 20 || c.ReasoningTokens != 5 || c.Latency != 300*time.Millisecond {
+		t.Errorf("chat: %+v", c)
+	}
+	if got[PurposeTitle].PromptTokens != 10 || got[PurposeOther].PromptTokens != 1 {
+		t.Errorf("got %+v", totals)
+	}
+	if tokens, _ := db.UsageTokens(database.UsageFilter{UserID: 1, ChatID: -100}); tokens != 132 {
+		t.Errorf("user tokens %d, want 132", tokens)
+	}
+}
@@ -0,0 +1,281 @@
+// Package webfetch downloads web pages and turns them into plain text for
+// the model, with limits on size, time and content type.
+package webfetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"telechatbot/internal/documents"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	DefaultMaxBytes = 2 << 20
+	DefaultTimeout  = 15 * time.Second
+	maxRedirects    = 5
+	userAgent       = "Mozilla/5.0 (compatible; telechatbot/1.0; +https://core.telegram.org/bots)"
+)
+
+var (
+	ErrUnsupportedType = errors.New("unsupported content type")
+	ErrTooLarge        = errors.New("page too large")
+	ErrBlockedAddress  = errors.New("address not allowed")
+	ErrNoText          = errors.New("page has no readable text")
+)
+
+// StatusError is returned for non-2xx responses.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("server answered %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// Page is a fetched page as text.
+type Page struct {
+	URL         string // final URL after redirects
+	Title       string
+	ContentType string
+	Text        string
+}
+
+// Fetcher downloads pages. Client is used as is, so tests can pass one that
+// reaches an httptest server; NewFetcher(nil) builds a client that refuses
+// to connect to loopback, private and link-local addresses, since the URLs
+// come from chat users.
+type Fetcher struct {
+	Client   *http.Client
+	MaxBytes int64
+	Timeout  time.Duration
+}
+
+func NewFetcher(client *http.Client) *Fetcher {
+	if client == nil {
+		client = publicClient()
+	}
+	return &Fetcher{Client: client, MaxBytes: DefaultMaxBytes, Timeout: DefaultTimeout}
+}
+
+// blockedPrefixes are the address ranges the public client never dials:
+// loopback, private, link-local, CGNAT (cloud metadata lives there too),
+// benchmarking, documentation, multicast and reserved ranges, and the
+// IPv6 translation prefixes that can reach any of them.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("169.254.0.0/16"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("192.88.99.0/24"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("224.0.0.0/4"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+
+	netip.MustParsePrefix("::/128"),
+	netip.MustParsePrefix("::1/128"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("100::/64"),
+	netip.MustParsePrefix("2001::/32"),
+	netip.MustParsePrefix("2001:db8::/32"),
+	netip.MustParsePrefix("2002::/16"),
+	netip.MustParsePrefix("fc00::/7"),
+	netip.MustParsePrefix("fe80::/10"),
+	netip.MustParsePrefix("ff00::/8"),
+}
+
+// publicClient only dials public addresses. The check runs on the resolved
+// IP at connect time, so redirects and DNS tricks are covered too.
+func publicClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip, err := netip.ParseAddr(host)
+			if err != nil || !isPublic(ip) {
+				return fmt.Errorf("%w: %s", ErrBlockedAddress, host)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil
+	return &http.Client{Transport: transport}
+}
+
+func isPublic(ip netip.Addr) bool {
+	// IPv4-mapped addresses are checked as IPv4, zones would make every
+	// Contains false
+	ip = ip.Unmap().WithZone("")
+	if !ip.IsValid() {
+		return false
+	}
+	for _, p := range blockedPrefixes {
+		if p.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// Fetch downloads rawURL and extracts its text. HTML, plain text, JSON,
+// XML and PDF are accepted.
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (*Page, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("not an http(s) URL: %q", rawURL)
+	}
+
+	timeout := f.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,text/plain;q=0.9,application/pdf;q=0.8,*/*;q=0.5")
+
+	client := *f.Client
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maxRedirects {
+			return fmt.Errorf("too many redirects")
+		}
+		if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+			return fmt.Errorf("redirect to unsupported scheme %q", req.URL.Scheme)
+		}
+		return nil
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, &StatusError{StatusCode: resp.StatusCode}
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	kind := classify(mediaType)
+	if kind == kindUnsupported {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedType, mediaType)
+	}
+
+	maxBytes := f.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxBytes
+	}
+	if kind == kindPDF && resp.ContentLength > maxBytes {
+		return nil, ErrTooLarge
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxBytes {
+		// Truncated HTML or text is still useful, a cut PDF is not
+		if kind == kindPDF {
+			return nil, ErrTooLarge
+		}
+		data = data[:maxBytes]
+		// Don't let a rune cut in half make the page look non-UTF-8
+		for i := 0; i < utf8.UTFMax && len(data) > 0 && !utf8.Valid(data); i++ {
+			if r, _ := utf8.DecodeLastRune(data); r != utf8.RuneError {
+				break
+			}
+			data = data[:len(data)-1]
+		}
+	}
+
+	page := &Page{URL: resp.Request.URL.String(), ContentType: mediaType}
+	switch kind {
+	case kindHTML:
+		page.Title, page.Text = HTMLToText(decodeText(data))
+	case kindPDF:
+		text, err := documents.Extract("page.pdf", mediaType, data)
+		if err != nil {
+			switch {
+			case errors.Is(err, documents.ErrNoText):
+				return nil, ErrNoText
+			case errors.Is(err, documents.ErrPDFTooLarge):
+				return nil, ErrTooLarge
+			}
+			return nil, err
+		}
+		page.Text = text
+	default:
+		page.Text = strings.TrimSpace(decodeText(data))
+	}
+
+	if strings.TrimSpace(page.Text) == "" {
+		return nil, ErrNoText
+	}
+	return page, nil
+}
+
+type contentKind int
+
+const (
+	kindUnsupported contentKind = iota
+	kindHTML
+	kindText
+	kindPDF
+)
+
+func classify(mediaType string) contentKind {
+	switch {
+	case mediaType == "text/html", mediaType == "application/xhtml+xml":
+		return kindHTML
+	case mediaType == "application/pdf":
+		return kindPDF
+	case strings.HasPrefix(mediaType, "text/"),
+		mediaType == "application/json", strings.HasSuffix(mediaType, "+json"),
+		mediaType == "application/xml", strings.HasSuffix(mediaType, "+xml"):
+		return kindText
+	case mediaType == "":
+		// Missing header: most servers that forget it serve HTML
+		return kindHTML
+	}
+	return kindUnsupported
+}
+
+// decodeText returns data as UTF-8. Pages that are not valid UTF-8 are
+// read as Windows-1252/Latin-1, the usual legacy charset; anything else
+// would need conversion tables we don't carry.
+func decodeText(data []byte) string {
+	if utf8.Valid(data) {
+		return string(data)
+	}
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
@@ -0,0 +1,153 @@
+package webfetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+// serve starts a server answering with the given content type and body.
+func serve(t *testing.T, contentType, body string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestFetchRejectsContentType(t *testing.T) {
+	srv := serve(t, "image/png", "\x89PNG")
+	_, err := NewFetcher(srv.Client()).Fetch(context.Background(), srv.URL)
+	if !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("got error %v, want ErrUnsupportedType", err)
+	}
+}
+
+func TestFetchTruncatesText(t *testing.T) {
+	// The cut falls inside "é", which must be dropped, not kept half
+	srv := serve(t, "text/plain; charset=utf-8", "abcdefghé and more text")
+	f := NewFetcher(srv.Client())
+	f.MaxBytes = 9
+
+	page, err := f.Fetch(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Text != "abcdefgh" {
+		t.Errorf("got %q, want %q", page.Text, "abcdefgh")
+	}
+}
+
+func TestFetchPDFTooLarge(t *testing.T) {
+	body := "%PDF-1.4\n" + strings.Repeat("x", 100)
+	for _, chunked := range []bool{false, true} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/pdf")
+			if chunked {
+				// No Content-Length: the size is only known while reading
+				w.(http.Flusher).Flush()
+			}
+			fmt.Fprint(w, body)
+		}))
+		f := NewFetcher(srv.Client())
+		f.MaxBytes = 50
+
+		_, err := f.Fetch(context.Background(), srv.URL)
+		srv.Close()
+		if !errors.Is(err, ErrTooLarge) {
+			t.Errorf("chunked=%v: got error %v, want ErrTooLarge", chunked, err)
+		}
+	}
+}
+
+func TestFetchHTML(t *testing.T) {
+	srv := serve(t, "text/html; charset=utf-8", `<!doctype html>
+<html><head><title>The &amp; Title</title>
+<style>body { color: red }</style><script>var x = 1;</script></head>
+<body><nav>Menu</nav><h1>Heading</h1><p>First paragraph.</p><p>Second <b>bold</b> one.</p></body></html>`)
+
+	page, err := NewFetcher(srv.Client()).Fetch(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Title != "The & Title" {
+		t.Errorf("title %q", page.Title)
+	}
+	for _, want := range []string{"Heading", "First paragraph.", "Second bold one."} {
+		if !strings.Contains(page.Text, want) {
+			t.Errorf("text %q does not contain %q", page.Text, want)
+		}
+	}
+	for _, unwanted := range []string{"color: red", "var x"} {
+		if strings.Contains(page.Text, unwanted) {
+			t.Errorf("text %q contains %q", page.Text, unwanted)
+		}
+	}
+}
+
+func TestFetchRedirectLimit(t *testing.T) {
+	hops := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hops++
+		http.Redirect(w, r, fmt.Sprintf("/hop%d", hops), http.StatusFound)
+	}))
+	defer srv.Close()
+
+	_, err := NewFetcher(srv.Client()).Fetch(context.Background(), srv.URL)
+	if err == nil || !strings.Contains(err.Error(), "too many redirects") {
+		t.Errorf("got error %v, want too many redirects", err)
+	}
+	if hops != maxRedirects {
+		t.Errorf("server saw %d requests, want %d", hops, maxRedirects)
+	}
+}
+
+func TestPublicClientRefusesLoopback(t *testing.T) {
+	srv := serve(t, "text/plain", "secret")
+	_, err := NewFetcher(nil).Fetch(context.Background(), srv.URL)
+	if !errors.Is(err, ErrBlockedAddress) {
+		t.Errorf("got error %v, want ErrBlockedAddress", err)
+	}
+}
+
+func TestIsPublic(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"1.1.1.1":              true,
+		"93.184.216.34":        true,
+		"2606:4700::1111":      true,
+		"0.0.0.0":              false,
+		"0.1.2.3":              false,
+		"10.1.2.3":             false,
+		"100.64.0.1":           false,
+		"100.100.100.200":      false,
+		"127.0.0.1":            false,
+		"169.254.169.254":      false,
+		"172.16.0.1":           false,
+		"192.168.1.1":          false,
+		"198.18.0.1":           false,
+		"224.0.0.1":            false,
+		"255.255.255.255":      false,
+		"::":                   false,
+		"::1":                  false,
+		"::ffff:127.0.0.1":     false,
+		"::ffff:1.1.1.1":       true,
+		"64:ff9b::a9fe:a9fe":   false,
+		"fc00::1":              false,
+		"fe80::1%eth0":         false,
+		"ff02::1":              false,
+		"2002:7f00:1::":        false,
+		"2001:db8::1":          false,
+		"2001:4860:4860::8888": true,
+	} {
+		if got := isPublic(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("isPublic(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
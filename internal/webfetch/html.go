@@ -0,0 +1,200 @@
+package webfetch
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// Elements whose content is never text for the reader
+var skipElements = map[string]bool{
+	"script": true, "style": true, "noscript": true, "template": true,
+	"svg": true, "canvas": true, "iframe": true, "object": true,
+	"title": true, "select": true, "button": true, "form": true,
+}
+
+// Page furniture, skipped when the page has a <main> or <article>
+var boilerplateElements = map[string]bool{
+	"nav": true, "footer": true, "aside": true,
+}
+
+// Elements that start a new line
+var blockElements = map[string]bool{
+	"p": true, "div": true, "section": true, "article": true, "main": true,
+	"br": true, "hr": true, "tr": true, "table": true, "ul": true, "ol": true,
+	"dl": true, "dt": true, "dd": true, "pre": true, "blockquote": true,
+	"figure": true, "figcaption": true, "h1": true, "h2": true, "h3": true,
+	"h4": true, "h5": true, "h6": true, "li": true, "header": true,
+	"footer": true, "nav": true, "aside": true, "details": true, "summary": true,
+}
+
+var itemElements = map[string]bool{"li": true, "tr": true, "dt": true, "dd": true}
+
+var (
+	reTitle    = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	reMain     = regexp.MustCompile(`(?is)<(main|article)[\s>]`)
+	reSpaces   = regexp.MustCompile(`[ \t\f\r\v\x{00a0}]+`)
+	reBlankRun = regexp.MustCompile(`\n{3,}`)
+)
+
+// HTMLToText returns the title and readable text of an HTML document. It
+// is a tolerant tag scanner, not a full parser: scripts, styles and (if the
+// page marks its main content) navigation are dropped, block elements
+// become line breaks and list items get a dash.
+func HTMLToText(doc string) (title, text string) {
+	if m := reTitle.FindStringSubmatch(doc); m != nil {
+		title = strings.TrimSpace(reSpaces.ReplaceAllString(html.UnescapeString(m[1]), " "))
+	}
+	skipBoilerplate := reMain.MatchString(doc)
+
+	var b strings.Builder
+	skip := "" // element whose content is being skipped
+	depth := 0 // nesting of skip inside itself
+	inPre := 0 // inside <pre>, whitespace is kept
+	pos := 0
+	for pos < len(doc) {
+		lt := strings.IndexByte(doc[pos:], '<')
+		if lt < 0 {
+			if skip == "" {
+				writeText(&b, doc[pos:], inPre > 0)
+			}
+			break
+		}
+		if skip == "" {
+			writeText(&b, doc[pos:pos+lt], inPre > 0)
+		}
+		pos += lt
+
+		// A "<" that does not start a tag is text, e.g. "a < b"
+		if pos+1 < len(doc) && !isTagStart(doc[pos+1]) {
+			if skip == "" {
+				b.WriteString("<")
+			}
+			pos++
+			continue
+		}
+
+		// Comments and doctype
+		if strings.HasPrefix(doc[pos:], "<!--") {
+			end := strings.Index(doc[pos+4:], "-->")
+			if end < 0 {
+				break
+			}
+			pos += 4 + end + 3
+			continue
+		}
+
+		gt := strings.IndexByte(doc[pos:], '>')
+		if gt < 0 {
+			break
+		}
+		tag := doc[pos+1 : pos+gt]
+		pos += gt + 1
+
+		closing := strings.HasPrefix(tag, "/")
+		name := strings.ToLower(strings.TrimLeft(tag, "/"))
+		if i := strings.IndexAny(name, " \t\r\n/"); i >= 0 {
+			name = name[:i]
+		}
+		if name == "" || name[0] == '!' || name[0] == '?' {
+			continue
+		}
+		selfClosing := strings.HasSuffix(tag, "/")
+
+		if skip != "" {
+			if name == skip && !selfClosing {
+				if closing {
+					depth--
+				} else {
+					depth++
+				}
+				if depth == 0 {
+					skip = ""
+				}
+			}
+			continue
+		}
+
+		if !closing && !selfClosing && (skipElements[name] || (skipBoilerplate && boilerplateElements[name])) {
+			skip, depth = name, 1
+			continue
+		}
+
+		if name == "pre" {
+			if closing && inPre > 0 {
+				inPre--
+			} else if !closing {
+				inPre++
+			}
+		}
+
+		if blockElements[name] {
+			// Items are separated by their opening tag only, so lists and
+			// tables don't get blank lines between rows
+			if !closing || !itemElements[name] {
+				b.WriteString("\n")
+			}
+			if !closing {
+				switch name {
+				case "li":
+					b.WriteString("- ")
+				case "h1", "h2", "h3":
+					b.WriteString("\n" + strings.Repeat("#", int(name[1]-'0')) + " ")
+				}
+			}
+		} else if name == "td" || name == "th" {
+			b.WriteString(" ")
+		} else if name == "img" && !closing {
+			if alt := attr(tag, "alt"); alt != "" {
+				b.WriteString("[" + alt + "]")
+			}
+		}
+	}
+
+	return title, tidy(b.String())
+}
+
+func isTagStart(c byte) bool {
+	return c == '/' || c == '!' || c == '?' || (c|0x20 >= 'a' && c|0x20 <= 'z')
+}
+
+// writeText appends decoded text; outside <pre> runs of whitespace are one space.
+func writeText(b *strings.Builder, raw string, pre bool) {
+	t := html.UnescapeString(raw)
+	if !pre {
+		t = strings.ReplaceAll(t, "\n", " ")
+		t = reSpaces.ReplaceAllString(t, " ")
+	}
+	b.WriteString(t)
+}
+
+var reAttr = regexp.MustCompile(`(?i)\b([a-z-]+)\s*=\s*("([^"]*)"|'([^']*)'|([^\s>]+))`)
+
+func attr(tag, name string) string {
+	for _, m := range reAttr.FindAllStringSubmatch(tag, -1) {
+		if strings.EqualFold(m[1], name) {
+			return strings.TrimSpace(html.UnescapeString(m[3] + m[4] + m[5]))
+		}
+	}
+	return ""
+}
+
+// tidy trims every line and collapses runs of blank lines.
+func tidy(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		// Keep indentation from <pre>, drop the single space left over from
+		// collapsed markup whitespace
+		l = strings.TrimRight(l, " \t")
+		if strings.HasPrefix(l, " ") && !strings.HasPrefix(l, "  ") {
+			l = l[1:]
+		}
+		if l == "-" {
+			l = ""
+		}
+		lines[i] = l
+	}
+	out := strings.Join(lines, "\n")
+	out = reBlankRun.ReplaceAllString(out, "\n\n")
+	return strings.TrimSpace(out)
+}